@@ -20,6 +20,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/stolostron/search-aggregator/pkg/clustermgmt"
 	"github.com/stolostron/search-aggregator/pkg/config"
 	"github.com/stolostron/search-aggregator/pkg/dbconnector"
@@ -42,6 +43,13 @@ func main() {
 	if commit, ok := os.LookupEnv("VCS_REF"); ok {
 		glog.Info("Built from git commit: ", commit)
 	}
+	if err = config.LoadError(); err != nil {
+		glog.Fatal(err)
+	}
+
+	if err = config.WatchReload(nil); err != nil {
+		glog.Warning("Unable to watch the config file, reload the config with SIGHUP. ", err)
+	}
 
 	dbconnector.GetIndexes()
 	go dbconnector.RedisWatcher()
@@ -55,16 +63,36 @@ func main() {
 
 	router.HandleFunc("/liveness", handlers.LivenessProbe).Methods("GET")
 	router.HandleFunc("/readiness", handlers.ReadinessProbe).Methods("GET")
-	router.HandleFunc("/aggregator/clusters/{id}/sync", handlers.SyncResources).Methods("POST")
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	router.HandleFunc("/aggregator/status", handlers.RequireDebugEndpoints(handlers.GetAggregatorStatus)).Methods("GET")
+	router.HandleFunc("/aggregator/config", handlers.RequireDebugEndpoints(handlers.GetAggregatorConfig)).Methods("GET")
+	router.HandleFunc("/aggregator/clusters/{id}/status", handlers.GetClusterStatus).Methods("GET")
+	router.HandleFunc("/aggregator/clusters/{id}/sync", handlers.VerifyClientCertificate(
+		handlers.AuthenticateCollector(handlers.SyncResources))).Methods("POST")
 
-	// Configure TLS
-	cfg := &tls.Config{
-		MinVersion:               tls.VersionTLS12,
-		CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
-		PreferServerCipherSuites: true,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-		},
+	// Configure TLS. The server certificate is reloaded when it's rotated, without a restart.
+	cfg, err := config.ServerTLSConfig()
+	if err != nil {
+		glog.Fatal("Invalid TLS configuration. ", err)
+	}
+	certificates, err := config.NewCertificateReloader(config.Cfg.TLSCertFile, config.Cfg.TLSKeyFile)
+	if err != nil {
+		glog.Fatal("Error loading the server certificate. ", err,
+			" Use ./setup.sh to generate certificates for local development.")
+	}
+	if err = certificates.Watch(nil); err != nil {
+		glog.Warning("Unable to watch the server certificate, it won't be reloaded when it's rotated. ", err)
+	}
+	cfg.GetCertificate = certificates.GetCertificate
+	// Verify the collector client certificates. The certificates are optional during the handshake because
+	// the probes don't have one, the sync route rejects requests without a certificate.
+	if config.Cfg.ClientCAFile != "" {
+		clientCAs, err := config.LoadCertPool(config.Cfg.ClientCAFile)
+		if err != nil {
+			glog.Fatal("Error loading the client CA from ", config.Cfg.ClientCAFile, ". ", err)
+		}
+		cfg.ClientCAs = clientCAs
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
 	}
 	srv := &http.Server{
 		Addr:              config.Cfg.AggregatorAddress,
@@ -77,6 +105,5 @@ func main() {
 	}
 
 	glog.Info("Listening on: ", config.Cfg.AggregatorAddress)
-	log.Fatal(srv.ListenAndServeTLS("./sslcert/tls.crt", "./sslcert/tls.key"),
-		" Use ./setup.sh to generate certificates for local development.")
+	log.Fatal(srv.ListenAndServeTLS("", "")) // The certificate comes from cfg.GetCertificate.
 }
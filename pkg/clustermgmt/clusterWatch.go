@@ -67,6 +67,10 @@ func WatchClusters() {
 	managedClusterInfoInformer.AddEventHandler(handlers)
 	klusterletAddonConfigInformer.AddEventHandler(handlers)
 
+	registerInformer("cluster.open-cluster-management.io/v1", managedClusterInformer)
+	registerInformer("internal.open-cluster-management.io/v1beta1", managedClusterInfoInformer)
+	registerInformer("agent.open-cluster-management.io/v1", klusterletAddonConfigInformer)
+
 	// Periodically check if the ManagedCluster/ManagedClusterInfo resource exists
 	go stopAndStartInformer("cluster.open-cluster-management.io/v1", managedClusterInformer)
 	go stopAndStartInformer("internal.open-cluster-management.io/v1beta1", managedClusterInfoInformer)
@@ -94,8 +98,9 @@ func stopAndStartInformer(groupVersion string, informer cache.SharedIndexInforme
 				informerRunning = true
 				go informer.Run(stopper)
 			}
+			setInformerState(groupVersion, informer, informerRunning)
 		}
-		time.Sleep(time.Duration(config.Cfg.RediscoverRateMS) * time.Millisecond)
+		config.Sleep(config.RediscoverRate)
 	}
 }
 
@@ -83,3 +83,19 @@ func Test_transformKlusterletAddonConfig(t *testing.T) {
 		"iam-policy-controller": true, "policy-controller": true, "search-collector": true}
 	assert.Equal(t, testAddons, result.Properties["addon"], "Test property: addon")
 }
+
+func Test_InformersSynced(t *testing.T) {
+	informerStates = make(map[string]*informerState)
+	synced, _ := InformersSynced()
+	assert.False(t, synced, "Not synced before the informers are registered.")
+
+	registerInformer("cluster.open-cluster-management.io/v1", nil)
+	synced, status := InformersSynced()
+	assert.False(t, synced, "Not synced before the resource is checked.")
+	assert.Equal(t, map[string]bool{"cluster.open-cluster-management.io/v1": false}, status)
+
+	// The informer isn't running because the resource isn't installed.
+	setInformerState("cluster.open-cluster-management.io/v1", nil, false)
+	synced, _ = InformersSynced()
+	assert.True(t, synced, "An informer that isn't running counts as synced.")
+}
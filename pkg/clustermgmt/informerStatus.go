@@ -0,0 +1,52 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package clustermgmt
+
+import (
+	"sync"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// State of an informer managed by stopAndStartInformer.
+type informerState struct {
+	checked  bool // The API server has been checked for the resource at least once.
+	informer cache.SharedIndexInformer
+	running  bool
+}
+
+// Tracks the cluster informers by group version, used by the readiness probe.
+var (
+	informerStates      = make(map[string]*informerState)
+	informerStatesMutex = sync.RWMutex{}
+)
+
+// Registers an informer before its resource has been checked, so it counts as not synced.
+func registerInformer(groupVersion string, informer cache.SharedIndexInformer) {
+	informerStatesMutex.Lock()
+	defer informerStatesMutex.Unlock()
+	informerStates[groupVersion] = &informerState{informer: informer}
+}
+
+func setInformerState(groupVersion string, informer cache.SharedIndexInformer, running bool) {
+	informerStatesMutex.Lock()
+	defer informerStatesMutex.Unlock()
+	informerStates[groupVersion] = &informerState{checked: true, informer: informer, running: running}
+}
+
+// InformersSynced returns whether all the cluster informers have synced, and the sync status of each one
+// keyed by group version. An informer that isn't running because its resource isn't installed counts as synced.
+func InformersSynced() (bool, map[string]bool) {
+	informerStatesMutex.RLock()
+	defer informerStatesMutex.RUnlock()
+
+	status := make(map[string]bool, len(informerStates))
+	allSynced := len(informerStates) > 0 // Not synced until WatchClusters has checked the resources.
+	for groupVersion, state := range informerStates {
+		synced := state.checked && (!state.running || state.informer.HasSynced())
+		status[groupVersion] = synced
+		allSynced = allSynced && synced
+	}
+	return allSynced, status
+}
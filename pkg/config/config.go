@@ -12,6 +12,7 @@ Copyright (c) 2020 Red Hat, Inc.
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -21,58 +22,168 @@ import (
 )
 
 const (
-	AGGREGATOR_API_VERSION          = "2.4.0"
-	DEFAULT_AGGREGATOR_ADDRESS      = ":3010"
-	DEFAULT_EDGE_BUILD_RATE_MS      = 15000  // 15 sec
-	DEFAULT_HTTP_TIMEOUT            = 300000 // 5 min, to fix the EOF response at the collector
-	DEFAULT_REDISCOVER_RATE_MS      = 300000 // 5 min
-	DEFAULT_REDIS_HOST              = "localhost"
-	DEFAULT_REDIS_PORT              = "6379"
-	DEFAULT_REDIS_WATCH_INTERVAL    = 15000 // 15 seconds
-	DEFAULT_REQUEST_LIMIT           = 10    // Max number of concurrent requests.
-	DEFAULT_SKIP_CLUSTER_VALIDATION = "false"
+	AGGREGATOR_API_VERSION            = "2.4.0"
+	DEFAULT_AGGREGATOR_ADDRESS        = ":3010"
+	DEFAULT_BATCH_SIZE                = 500   // Max number of resources or edges written by a single query.
+	DEFAULT_BATCH_SIZE_MIN            = 10    // Batches don't shrink below this size.
+	DEFAULT_BATCH_TARGET_LATENCY_MS   = 1000  // 1 sec
+	DEFAULT_BATCH_WORKERS             = 1     // Batches of an operation are written one at a time.
+	DEFAULT_BATCH_WORKERS_LIMIT       = 16    // Leaves connections in the pool (max 20) for reads and probes.
+	DEFAULT_CIRCUIT_BREAKER_OPEN_MS   = 10000 // 10 sec
+	DEFAULT_CIRCUIT_BREAKER_THRESHOLD = 5     // Consecutive Redis connection failures that open the circuit.
+	DEFAULT_DB_BACKEND                = "redisgraph"
+	DEFAULT_DEBUG_ENDPOINTS           = "false"
+	DEFAULT_EDGE_BUILD_RATE_MS        = 15000  // 15 sec
+	DEFAULT_HTTP_TIMEOUT              = 300000 // 5 min, to fix the EOF response at the collector
+	DEFAULT_MAX_REQUEST_BODY_MB       = 512    // Decompressed size of a sync request.
+	DEFAULT_READINESS_TIMEOUT_MS      = 5000   // 5 sec
+	DEFAULT_REDISCOVER_RATE_MS        = 300000 // 5 min
+	DEFAULT_REDIS_CA_FILE             = "./rediscert/redis.crt"
+	DEFAULT_REDIS_HOST                = "localhost"
+	DEFAULT_REDIS_PORT                = "6379"
+	DEFAULT_REDIS_SENTINEL_MASTER     = "mymaster"
+	DEFAULT_REDIS_WATCH_INTERVAL      = 15000 // 15 seconds
+	DEFAULT_REPLAY_CACHE_SIZE         = 5     // Responses kept per cluster to answer retried requests.
+	DEFAULT_REQUEST_LIMIT             = 10    // Max number of concurrent requests.
+	DEFAULT_REQUEST_QUEUE_LIMIT       = 100   // Max number of requests waiting for admission.
+	DEFAULT_REQUEST_QUEUE_WAIT_MS     = 10000 // 10 sec
+	DEFAULT_REQUEST_SEQUENCE_CHECK    = "false"
+	DEFAULT_SKIP_CLUSTER_VALIDATION   = "false"
+	DEFAULT_STREAMING_DECODE          = "false"
+	DEFAULT_SYNC_ALLOWED_IDENTITIES   = "system:serviceaccount:{cluster}:search-collector"
+	DEFAULT_SYNC_AUTHENTICATION       = "false"
+	DEFAULT_SYNC_RETRY_ATTEMPTS       = 3   // Retries of a query after a transient Redis failure.
+	DEFAULT_SYNC_RETRY_BACKOFF_MS     = 200 // Delay before the first retry, doubled for each retry.
+	DEFAULT_TLS_CERT_FILE             = "./sslcert/tls.crt"
+	DEFAULT_TLS_CIPHER_SUITES         = "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384" // Only used up to TLS 1.2.
+	DEFAULT_TLS_KEY_FILE              = "./sslcert/tls.key"
+	DEFAULT_TLS_MIN_VERSION           = "1.2"
 )
 
 // Define a config type to hold our config properties.
 type Config struct {
-	AggregatorAddress     string // address for collector <-> aggregator
-	EdgeBuildRateMS       int    // rate at which intercluster edges should be build
-	HTTPTimeout           int    // timeout when the http server should drop connections
-	KubeConfig            string // Local kubeconfig path
-	RedisHost             string // host path for redis
-	RedisPassword         string // password for redis
-	RedisPort             string // port for redis
-	RedisSSHPort          string // ssh port for redis
-	RedisWatchRate        int    // rate at which Redis Ping hapens to check health
-	RediscoverRateMS      int    // time in MS we should check on cluster resource type
-	RequestLimit          int    // Max number of concurrent requests. Used to prevent from overloading Redis.
-	SkipClusterValidation string // Skips cluster validation. Intended only for performance tests.
+	AggregatorAddress       string // address for collector <-> aggregator
+	BatchSize               int    // Max number of resources or edges written to the graph by a single query.
+	BatchSizeMin            int    // Min size of the batches, they shrink down to it after slow or failed queries.
+	BatchTargetLatencyMS    int    // Batches grow while their queries take less than this, and shrink when slower.
+	BatchWorkers            int    // Max number of batches of a single operation written concurrently.
+	BatchWorkersLimit       int    // Max number of batches written concurrently by all the requests.
+	ClientCAFile            string // CA to verify the collector client certificates, mTLS is disabled if empty
+	CircuitBreakerOpenMS    int    // Time the circuit stays open before a request probes Redis again.
+	CircuitBreakerThreshold int    // Consecutive Redis connection failures that open the circuit, 0 disables it.
+	ConfigFile              string // YAML file with the settings, keyed by environment variable name.
+	DBBackend               string // redisgraph, or memory to keep the graph in process for local development
+	DebugEndpoints          string // Serves the aggregator status and config, they don't require authentication.
+	EdgeBuildRateMS         int    // rate at which intercluster edges should be build
+	HTTPTimeout             int    // timeout when the http server should drop connections
+	KubeConfig              string // Local kubeconfig path
+	MaxRequestBodyMB        int    // Max size of a sync request body in MB, after it's decompressed.
+	ReadinessTimeoutMS      int    // timeout for the Redis checks done by the readiness probe
+	RedisCAFile             string // CA to verify the Redis server certificate.
+	RedisCertFile           string // Client certificate for mutual TLS with Redis.
+	RedisHost               string // host path for redis
+	RedisKeyFile            string // Key of the client certificate for mutual TLS with Redis.
+	RedisPassword           string // password for redis
+	RedisPasswordFile       string // File with the password for redis, e.g. mounted from a secret.
+	RedisPort               string // port for redis
+	RedisSentinelAddresses  string // Comma separated host:port of the Redis Sentinels, enables the Sentinel mode.
+	RedisSentinelMaster     string // Name of the master monitored by the Sentinels.
+	RedisSSHPort            string // ssh port for redis
+	RedisUser               string // ACL username for redis, authenticates with the default user when empty.
+	RedisWatchRate          int    // rate at which Redis Ping hapens to check health
+	RediscoverRateMS        int    // time in MS we should check on cluster resource type
+	ReplayCacheSize         int    // Number of sync responses kept per cluster to answer retries of the same request.
+	RequestLimit            int    // Max number of concurrent requests. Used to prevent from overloading Redis.
+	RequestQueueLimit       int    // Max number of requests waiting for admission when RequestLimit is reached.
+	RequestQueueWaitMS      int    // time in MS a request waits for admission before it's rejected
+	RequestSequenceCheck    string // Rejects sync requests whose RequestId isn't the last successful one + 1.
+	SkipClusterValidation   string // Skips cluster validation. Intended only for performance tests.
+	StreamingDecode         string // Applies sync requests in batches while decoding, instead of decoding them first.
+	SyncAllowedIdentities   string // Comma separated users or groups allowed to sync a cluster, {cluster} is replaced.
+	SyncAuthentication      string // Requires sync requests to have a bearer token validated with a TokenReview.
+	SyncRetryAttempts       int    // Retries of a query that failed with a transient Redis error during a sync.
+	SyncRetryBackoffMS      int    // Delay in MS before the first retry, doubled for each retry, with jitter.
+	TLSCertFile             string // Server certificate, reloaded when the file changes.
+	TLSCipherSuites         string // Comma separated cipher suites allowed up to TLS 1.2.
+	TLSKeyFile              string // Key of the server certificate, reloaded when the file changes.
+	TLSMinVersion           string // Min TLS version accepted by the server, 1.2 or 1.3.
 }
 
+// Cfg - Settings loaded at startup. The Tunables reloaded at runtime are read with CurrentTunables.
 var Cfg = Config{}
 
 func init() {
-	// If environment variables are set, use those values constants
-	// Simply put, the order of preference is env -> default constants (from left to right)
-	setDefault(&Cfg.AggregatorAddress, "AGGREGATOR_ADDRESS", DEFAULT_AGGREGATOR_ADDRESS)
-	setDefault(&Cfg.RedisHost, "REDIS_HOST", DEFAULT_REDIS_HOST)
-	setDefault(&Cfg.RedisPort, "REDIS_PORT", DEFAULT_REDIS_PORT)
-	setDefault(&Cfg.RedisSSHPort, "REDIS_SSH_PORT", "")
-	setDefault(&Cfg.RedisPassword, "REDIS_PASSWORD", "")
-	setDefault(&Cfg.SkipClusterValidation, "SKIP_CLUSTER_VALIDATION", DEFAULT_SKIP_CLUSTER_VALIDATION)
+	Cfg, sources, loadErr = load(os.Getenv("CONFIG_FILE"))
+	tunables = tunablesOf(Cfg)
+}
+
+// Loads the config from the environment variables and the YAML file in CONFIG_FILE, then validates it.
+// The order of preference is env -> config file -> default constants (from left to right)
+func load(path string) (Config, map[string]string, error) {
+	cfg := Config{ConfigFile: path}
+	l := newLoader(path)
+	l.setString(&cfg.AggregatorAddress, "AGGREGATOR_ADDRESS", DEFAULT_AGGREGATOR_ADDRESS)
+	l.setString(&cfg.ClientCAFile, "CLIENT_CA_FILE", "")
+	l.setString(&cfg.DBBackend, "DB_BACKEND", DEFAULT_DB_BACKEND)
+	l.setString(&cfg.DebugEndpoints, "DEBUG_ENDPOINTS", DEFAULT_DEBUG_ENDPOINTS)
+	l.setString(&cfg.RedisHost, "REDIS_HOST", DEFAULT_REDIS_HOST)
+	l.setString(&cfg.RedisPort, "REDIS_PORT", DEFAULT_REDIS_PORT)
+	l.setString(&cfg.RedisSSHPort, "REDIS_SSH_PORT", "")
+	l.setString(&cfg.RedisPassword, "REDIS_PASSWORD", "")
+	l.setString(&cfg.RedisPasswordFile, "REDIS_PASSWORD_FILE", "")
+	l.setString(&cfg.RedisUser, "REDIS_USER", "")
+	l.setString(&cfg.RedisCAFile, "REDIS_CA_FILE", DEFAULT_REDIS_CA_FILE)
+	l.setString(&cfg.RedisCertFile, "REDIS_CERT_FILE", "")
+	l.setString(&cfg.RedisKeyFile, "REDIS_KEY_FILE", "")
+	l.setString(&cfg.RedisSentinelAddresses, "REDIS_SENTINEL_ADDRESSES", "")
+	l.setString(&cfg.RedisSentinelMaster, "REDIS_SENTINEL_MASTER", DEFAULT_REDIS_SENTINEL_MASTER)
+	l.setString(&cfg.RequestSequenceCheck, "REQUEST_SEQUENCE_CHECK", DEFAULT_REQUEST_SEQUENCE_CHECK)
+	l.setString(&cfg.SkipClusterValidation, "SKIP_CLUSTER_VALIDATION", DEFAULT_SKIP_CLUSTER_VALIDATION)
+	l.setString(&cfg.StreamingDecode, "STREAMING_DECODE", DEFAULT_STREAMING_DECODE)
+	l.setString(&cfg.SyncAllowedIdentities, "SYNC_ALLOWED_IDENTITIES", DEFAULT_SYNC_ALLOWED_IDENTITIES)
+	l.setString(&cfg.SyncAuthentication, "SYNC_AUTHENTICATION", DEFAULT_SYNC_AUTHENTICATION)
+	l.setString(&cfg.TLSCertFile, "TLS_CERT_FILE", DEFAULT_TLS_CERT_FILE)
+	l.setString(&cfg.TLSCipherSuites, "TLS_CIPHER_SUITES", DEFAULT_TLS_CIPHER_SUITES)
+	l.setString(&cfg.TLSKeyFile, "TLS_KEY_FILE", DEFAULT_TLS_KEY_FILE)
+	l.setString(&cfg.TLSMinVersion, "TLS_MIN_VERSION", DEFAULT_TLS_MIN_VERSION)
 
-	setDefaultInt(&Cfg.EdgeBuildRateMS, "EDGE_BUILD_RATE_MS", DEFAULT_EDGE_BUILD_RATE_MS)
-	setDefaultInt(&Cfg.HTTPTimeout, "HTTP_TIMEOUT", DEFAULT_HTTP_TIMEOUT)
-	setDefaultInt(&Cfg.RequestLimit, "REQUEST_LIMIT", DEFAULT_REQUEST_LIMIT)
-	setDefaultInt(&Cfg.RedisWatchRate, "REDIS_WATCH_RATE_MS", DEFAULT_REDIS_WATCH_INTERVAL)
-	setDefaultInt(&Cfg.RediscoverRateMS, "REDISCOVER_RATE_MS", DEFAULT_REDISCOVER_RATE_MS)
+	l.setInt(&cfg.BatchSize, "BATCH_SIZE", DEFAULT_BATCH_SIZE)
+	l.setInt(&cfg.BatchSizeMin, "BATCH_SIZE_MIN", DEFAULT_BATCH_SIZE_MIN)
+	l.setInt(&cfg.BatchTargetLatencyMS, "BATCH_TARGET_LATENCY_MS", DEFAULT_BATCH_TARGET_LATENCY_MS)
+	l.setInt(&cfg.BatchWorkers, "BATCH_WORKERS", DEFAULT_BATCH_WORKERS)
+	l.setInt(&cfg.BatchWorkersLimit, "BATCH_WORKERS_LIMIT", DEFAULT_BATCH_WORKERS_LIMIT)
+	l.setInt(&cfg.CircuitBreakerOpenMS, "CIRCUIT_BREAKER_OPEN_MS", DEFAULT_CIRCUIT_BREAKER_OPEN_MS)
+	l.setInt(&cfg.CircuitBreakerThreshold, "CIRCUIT_BREAKER_THRESHOLD", DEFAULT_CIRCUIT_BREAKER_THRESHOLD)
+	l.setInt(&cfg.EdgeBuildRateMS, "EDGE_BUILD_RATE_MS", DEFAULT_EDGE_BUILD_RATE_MS)
+	l.setInt(&cfg.HTTPTimeout, "HTTP_TIMEOUT", DEFAULT_HTTP_TIMEOUT)
+	l.setInt(&cfg.MaxRequestBodyMB, "MAX_REQUEST_BODY_MB", DEFAULT_MAX_REQUEST_BODY_MB)
+	l.setInt(&cfg.ReadinessTimeoutMS, "READINESS_TIMEOUT_MS", DEFAULT_READINESS_TIMEOUT_MS)
+	l.setInt(&cfg.ReplayCacheSize, "REPLAY_CACHE_SIZE", DEFAULT_REPLAY_CACHE_SIZE)
+	l.setInt(&cfg.RequestLimit, "REQUEST_LIMIT", DEFAULT_REQUEST_LIMIT)
+	l.setInt(&cfg.RequestQueueLimit, "REQUEST_QUEUE_LIMIT", DEFAULT_REQUEST_QUEUE_LIMIT)
+	l.setInt(&cfg.RequestQueueWaitMS, "REQUEST_QUEUE_WAIT_MS", DEFAULT_REQUEST_QUEUE_WAIT_MS)
+	l.setInt(&cfg.SyncRetryAttempts, "SYNC_RETRY_ATTEMPTS", DEFAULT_SYNC_RETRY_ATTEMPTS)
+	l.setInt(&cfg.SyncRetryBackoffMS, "SYNC_RETRY_BACKOFF_MS", DEFAULT_SYNC_RETRY_BACKOFF_MS)
+	l.setInt(&cfg.RedisWatchRate, "REDIS_WATCH_RATE_MS", DEFAULT_REDIS_WATCH_INTERVAL)
+	l.setInt(&cfg.RediscoverRateMS, "REDISCOVER_RATE_MS", DEFAULT_REDISCOVER_RATE_MS)
 
 	defaultKubePath := filepath.Join(os.Getenv("HOME"), ".kube", "config")
 	if _, err := os.Stat(defaultKubePath); os.IsNotExist(err) {
 		// set default to empty string if path does not reslove
 		defaultKubePath = ""
 	}
-	setDefault(&Cfg.KubeConfig, "KUBECONFIG", defaultKubePath)
+	l.setString(&cfg.KubeConfig, "KUBECONFIG", defaultKubePath)
+	l.loadRedisPassword(&cfg)
+
+	problems := append(l.problems(), cfg.validate()...)
+	// The streaming requests are applied while they are decoded, before the fingerprint of the body is known.
+	if cfg.StreamingDecode == "true" && cfg.ReplayCacheSize > 0 {
+		glog.Warning("REPLAY_CACHE_SIZE is ignored with STREAMING_DECODE, a retried sync request is applied again.")
+	}
+	if len(problems) > 0 {
+		return cfg, l.sources, fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return cfg, l.sources, nil
 }
 
 func setDefault(field *string, env, defaultVal string) {
@@ -92,13 +203,13 @@ func setDefault(field *string, env, defaultVal string) {
 	}
 }
 
-func setDefaultInt(field *int, env string, defaultVal int) {
+func setDefaultInt(field *int, env string, defaultVal int) error {
 	if val := os.Getenv(env); val != "" {
 		glog.Infof("Using %s from environment: %s", env, val)
 		var err error
 		*field, err = strconv.Atoi(val)
 		if err != nil {
-			glog.Error("Error parsing env [", env, "].  Expected an integer.  Original error: ", err)
+			return fmt.Errorf("%s must be an integer, got %q", env, val)
 		}
 	} else if *field == 0 && defaultVal != 0 {
 		// Skip logging when running tests to reduce confusing output.
@@ -107,4 +218,5 @@ func setDefaultInt(field *int, env string, defaultVal int) {
 		}
 		*field = defaultVal
 	}
+	return nil
 }
@@ -0,0 +1,236 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of the settings, shown by Sources.
+const (
+	SourceDefault           = "default"
+	SourceEnvironment       = "environment"
+	SourceConfigFile        = "config file"
+	SourceRedisPasswordFile = "REDIS_PASSWORD_FILE"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	loadErr error             // Problems found when the config was loaded, see LoadError.
+	sources map[string]string // Source of each setting, by environment variable name.
+)
+
+// LoadError - Returns the invalid settings found when the config was loaded, or nil.
+func LoadError() error {
+	return loadErr
+}
+
+// Sources - Returns where the value of each setting comes from, by environment variable name.
+func Sources() map[string]string {
+	tunablesMutex.RLock()
+	defer tunablesMutex.RUnlock()
+	copied := make(map[string]string, len(sources))
+	for env, source := range sources {
+		copied[env] = source
+	}
+	return copied
+}
+
+// Redacted - Returns a copy of the config with the credentials and the paths of the files replaced, safe to log
+// or show.
+func (cfg Config) Redacted() Config {
+	for _, field := range []*string{&cfg.ClientCAFile, &cfg.ConfigFile, &cfg.KubeConfig, &cfg.RedisCAFile,
+		&cfg.RedisCertFile, &cfg.RedisKeyFile, &cfg.RedisPassword, &cfg.RedisPasswordFile, &cfg.RedisUser,
+		&cfg.TLSCertFile, &cfg.TLSKeyFile} {
+		if *field != "" {
+			*field = redacted
+		}
+	}
+	return cfg
+}
+
+// Reads the settings from the config file and the environment. A setting in the environment overrides the
+// config file, and the default is only used when the setting is in neither.
+type loader struct {
+	file    map[string]interface{} // Settings in the config file, by environment variable name.
+	sources map[string]string
+	errs    []string
+}
+
+// Reads the YAML config file. The keys are the names of the environment variables.
+func newLoader(path string) *loader {
+	l := &loader{file: map[string]interface{}{}, sources: map[string]string{}}
+	if path == "" {
+		return l
+	}
+	content, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		l.errs = append(l.errs, fmt.Sprintf("can't read CONFIG_FILE: %s", err))
+		return l
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	if err = decoder.Decode(&l.file); err != nil && !errors.Is(err, io.EOF) {
+		l.errs = append(l.errs, fmt.Sprintf("can't parse CONFIG_FILE %s: %s", path, err))
+		l.file = map[string]interface{}{}
+	}
+	if l.file == nil { // The file only has comments.
+		l.file = map[string]interface{}{}
+	}
+	glog.Info("Using config file: ", path)
+	return l
+}
+
+func (l *loader) setString(field *string, env, defaultVal string) {
+	value, inFile := l.file[env]
+	if os.Getenv(env) != "" || !inFile {
+		setDefault(field, env, defaultVal)
+		l.sources[env] = envSource(env)
+		return
+	}
+	l.sources[env] = SourceConfigFile
+	switch value.(type) {
+	case string, bool, int, float64:
+		*field = fmt.Sprint(value)
+	default:
+		l.errs = append(l.errs, fmt.Sprintf("%s in the config file must be a string, got %v", env, value))
+		return
+	}
+	if env == "REDIS_PASSWORD" {
+		glog.Infof("Using %s from config file", env)
+	} else {
+		glog.Infof("Using %s from config file: %s", env, *field)
+	}
+}
+
+func (l *loader) setInt(field *int, env string, defaultVal int) {
+	value, inFile := l.file[env]
+	if os.Getenv(env) != "" || !inFile {
+		if err := setDefaultInt(field, env, defaultVal); err != nil {
+			l.errs = append(l.errs, err.Error())
+		}
+		l.sources[env] = envSource(env)
+		return
+	}
+	l.sources[env] = SourceConfigFile
+	number, ok := value.(int)
+	if !ok {
+		l.errs = append(l.errs, fmt.Sprintf("%s in the config file must be an integer, got %v", env, value))
+		return
+	}
+	glog.Infof("Using %s from config file: %d", env, number)
+	*field = number
+}
+
+func envSource(env string) string {
+	if os.Getenv(env) != "" {
+		return SourceEnvironment
+	}
+	return SourceDefault
+}
+
+// Reads the Redis password from REDIS_PASSWORD_FILE, for a password mounted from a secret.
+func (l *loader) loadRedisPassword(cfg *Config) {
+	if cfg.RedisPasswordFile == "" {
+		return
+	}
+	if cfg.RedisPassword != "" {
+		l.errs = append(l.errs, "set REDIS_PASSWORD or REDIS_PASSWORD_FILE, not both")
+		return
+	}
+	password, err := os.ReadFile(cfg.RedisPasswordFile)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Sprintf("can't read REDIS_PASSWORD_FILE: %s", err))
+		return
+	}
+	cfg.RedisPassword = strings.TrimRight(string(password), "\r\n")
+	l.sources["REDIS_PASSWORD"] = SourceRedisPasswordFile
+}
+
+// Returns the problems found while loading, with the keys of the config file that aren't settings.
+func (l *loader) problems() []string {
+	unknown := []string{}
+	for key := range l.file {
+		if _, ok := l.sources[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		l.errs = append(l.errs, fmt.Sprintf("unknown setting %s in the config file", key))
+	}
+	return l.errs
+}
+
+// Returns the settings with an invalid value.
+func (cfg Config) validate() []string {
+	problems := []string{}
+	for _, setting := range []struct {
+		env   string
+		value int
+		min   int
+	}{
+		{"BATCH_SIZE", cfg.BatchSize, 1},
+		{"BATCH_SIZE_MIN", cfg.BatchSizeMin, 1},
+		{"BATCH_TARGET_LATENCY_MS", cfg.BatchTargetLatencyMS, 1},
+		{"BATCH_WORKERS", cfg.BatchWorkers, 1},
+		{"BATCH_WORKERS_LIMIT", cfg.BatchWorkersLimit, 1},
+		{"CIRCUIT_BREAKER_OPEN_MS", cfg.CircuitBreakerOpenMS, 1},
+		{"CIRCUIT_BREAKER_THRESHOLD", cfg.CircuitBreakerThreshold, 0},
+		{"EDGE_BUILD_RATE_MS", cfg.EdgeBuildRateMS, 1},
+		{"HTTP_TIMEOUT", cfg.HTTPTimeout, 1},
+		{"MAX_REQUEST_BODY_MB", cfg.MaxRequestBodyMB, 1},
+		{"READINESS_TIMEOUT_MS", cfg.ReadinessTimeoutMS, 1},
+		{"REDIS_WATCH_RATE_MS", cfg.RedisWatchRate, 1},
+		{"REDISCOVER_RATE_MS", cfg.RediscoverRateMS, 1},
+		{"REPLAY_CACHE_SIZE", cfg.ReplayCacheSize, 0},
+		{"REQUEST_LIMIT", cfg.RequestLimit, 1},
+		{"REQUEST_QUEUE_LIMIT", cfg.RequestQueueLimit, 0},
+		{"REQUEST_QUEUE_WAIT_MS", cfg.RequestQueueWaitMS, 0},
+		{"SYNC_RETRY_ATTEMPTS", cfg.SyncRetryAttempts, 0},
+		{"SYNC_RETRY_BACKOFF_MS", cfg.SyncRetryBackoffMS, 0},
+	} {
+		if setting.value < setting.min {
+			problems = append(problems, fmt.Sprintf("%s must be at least %d, got %d", setting.env, setting.min,
+				setting.value))
+		}
+	}
+	if cfg.BatchSizeMin > cfg.BatchSize {
+		problems = append(problems, "BATCH_SIZE_MIN must not be greater than BATCH_SIZE")
+	}
+
+	for _, setting := range []struct{ env, value string }{
+		{"DEBUG_ENDPOINTS", cfg.DebugEndpoints},
+		{"REQUEST_SEQUENCE_CHECK", cfg.RequestSequenceCheck},
+		{"SKIP_CLUSTER_VALIDATION", cfg.SkipClusterValidation},
+		{"STREAMING_DECODE", cfg.StreamingDecode},
+		{"SYNC_AUTHENTICATION", cfg.SyncAuthentication},
+	} {
+		if setting.value != "true" && setting.value != "false" {
+			problems = append(problems, fmt.Sprintf("%s must be true or false, got %q", setting.env, setting.value))
+		}
+	}
+	if cfg.DBBackend != "redisgraph" && cfg.DBBackend != "memory" {
+		problems = append(problems, fmt.Sprintf("DB_BACKEND must be redisgraph or memory, got %q", cfg.DBBackend))
+	}
+	if (cfg.RedisCertFile == "") != (cfg.RedisKeyFile == "") {
+		problems = append(problems, "REDIS_CERT_FILE and REDIS_KEY_FILE must be set together")
+	}
+	if _, err := parseTLSVersion(cfg.TLSMinVersion); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := parseCipherSuites(cfg.TLSCipherSuites); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
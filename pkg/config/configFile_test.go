@@ -0,0 +1,129 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Writes the config file to a temporary directory and returns its path.
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// An environment variable overrides the config file, which overrides the default.
+func Test_load_precedence(t *testing.T) {
+	path := writeConfigFile(t, `
+REDIS_HOST: redis-from-file
+REDIS_PORT: 6380
+BATCH_SIZE: 200
+CIRCUIT_BREAKER_THRESHOLD: 0
+STREAMING_DECODE: true
+`)
+	t.Setenv("BATCH_SIZE", "300")
+
+	cfg, loadedSources, err := load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RedisHost != "redis-from-file" || cfg.RedisPort != "6380" || cfg.StreamingDecode != "true" {
+		t.Errorf("Failed testing load()  Expected the settings from the file.  Got: %+v", cfg)
+	}
+	if cfg.BatchSize != 300 {
+		t.Errorf("Failed testing load()  Expected BATCH_SIZE from the environment: 300  Got: %d", cfg.BatchSize)
+	}
+	if cfg.CircuitBreakerThreshold != 0 {
+		t.Errorf("Failed testing load()  Expected CIRCUIT_BREAKER_THRESHOLD 0 from the file  Got: %d",
+			cfg.CircuitBreakerThreshold)
+	}
+	if cfg.BatchSizeMin != DEFAULT_BATCH_SIZE_MIN || cfg.ConfigFile != path {
+		t.Errorf("Failed testing load()  Expected the default BATCH_SIZE_MIN and the config file.  Got: %+v", cfg)
+	}
+
+	expected := map[string]string{"REDIS_HOST": SourceConfigFile, "BATCH_SIZE": SourceEnvironment,
+		"BATCH_SIZE_MIN": SourceDefault}
+	for env, source := range expected {
+		if loadedSources[env] != source {
+			t.Errorf("Failed testing load()  Expected: %s from %s  Got: %s", env, source, loadedSources[env])
+		}
+	}
+}
+
+func Test_load_invalid(t *testing.T) {
+	path := writeConfigFile(t, `
+BATCH_SIZE: many
+BATCH_SIZE_MIN: 1000
+SKIP_CLUSTER_VALIDATION: maybe
+REDIS_HOTS: redis
+`)
+	t.Setenv("REQUEST_LIMIT", "ten")
+
+	_, _, err := load(path)
+	if err == nil {
+		t.Fatal("Failed testing load()  Expected an error.")
+	}
+	for _, problem := range []string{"BATCH_SIZE in the config file must be an integer",
+		"REQUEST_LIMIT must be an integer", "BATCH_SIZE_MIN must not be greater than BATCH_SIZE",
+		"SKIP_CLUSTER_VALIDATION must be true or false", "unknown setting REDIS_HOTS"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("Failed testing load()  Expected: %s  Got: %s", problem, err)
+		}
+	}
+}
+
+// The replay cache is ignored with STREAMING_DECODE, enabling streaming alone is valid.
+func Test_load_streamingReplayCache(t *testing.T) {
+	path := writeConfigFile(t, "STREAMING_DECODE: true\n")
+
+	cfg, _, err := load(path)
+	if err != nil {
+		t.Errorf("Failed testing load()  Expected STREAMING_DECODE to be valid with the default REPLAY_CACHE_SIZE.  Got: %v",
+			err)
+	}
+	if cfg.ReplayCacheSize != DEFAULT_REPLAY_CACHE_SIZE {
+		t.Errorf("Failed testing load()  Expected the default REPLAY_CACHE_SIZE  Got: %d", cfg.ReplayCacheSize)
+	}
+}
+
+func Test_load_missingFile(t *testing.T) {
+	cfg, _, err := load(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "can't read CONFIG_FILE") {
+		t.Errorf("Failed testing load()  Expected an error for the missing file.  Got: %v", err)
+	}
+	if cfg.RedisHost != DEFAULT_REDIS_HOST {
+		t.Errorf("Failed testing load()  Expected the default REDIS_HOST  Got: %s", cfg.RedisHost)
+	}
+}
+
+// The Redis password is read from a mounted file, and redacted.
+func Test_load_redisPasswordFile(t *testing.T) {
+	passwordFile := writeConfigFile(t, "secret\n")
+	t.Setenv("REDIS_PASSWORD_FILE", passwordFile)
+
+	cfg, loadedSources, err := load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RedisPassword != "secret" || loadedSources["REDIS_PASSWORD"] != SourceRedisPasswordFile {
+		t.Errorf("Failed testing load()  Expected the password from the file  Got: %q", cfg.RedisPassword)
+	}
+	if cfg.Redacted().RedisPassword != redacted || cfg.RedisPassword != "secret" {
+		t.Error("Failed testing Redacted()  Expected a copy with the password redacted.")
+	}
+	if cfg.Redacted().RedisPasswordFile != redacted || cfg.Redacted().TLSKeyFile != redacted {
+		t.Errorf("Failed testing Redacted()  Expected the paths redacted.  Got: %+v", cfg.Redacted())
+	}
+
+	t.Setenv("REDIS_PASSWORD", "other")
+	if _, _, err = load(""); err == nil {
+		t.Error("Failed testing load()  Expected an error with REDIS_PASSWORD and REDIS_PASSWORD_FILE.")
+	}
+}
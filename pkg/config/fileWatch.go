@@ -0,0 +1,58 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/golang/glog"
+)
+
+// Calls changed with the name of the file after each change in the directories of the files, until stop is closed.
+// The directories are watched instead of the files, because a Kubernetes volume replaces the files by swapping a
+// symlink.
+func watchFiles(files []string, stop <-chan struct{}, changed func(name string)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	dirs := map[string]bool{}
+	for _, file := range files {
+		dirs[filepath.Dir(file)] = true
+	}
+	for dir := range dirs {
+		if err = watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return err
+		}
+	}
+	go func() {
+		defer func() {
+			if closeErr := watcher.Close(); closeErr != nil {
+				glog.Warning("Failed to close the file watcher. ", closeErr)
+			}
+		}()
+		for {
+			select {
+			case <-stop:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				changed(event.Name)
+			case watchErr, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				glog.Warning("Error watching ", files, ". ", watchErr)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Tunables - Settings applied at runtime when the config is reloaded, on SIGHUP or when CONFIG_FILE changes.
+// The other settings are only read at startup.
+type Tunables struct {
+	EdgeBuildRateMS    int
+	RedisWatchRate     int
+	RediscoverRateMS   int
+	RequestLimit       int
+	RequestQueueLimit  int
+	RequestQueueWaitMS int
+}
+
+// Environment variable of each tunable, to log the changes.
+var tunableSettings = []struct {
+	env   string
+	value func(Tunables) int
+}{
+	{"EDGE_BUILD_RATE_MS", func(t Tunables) int { return t.EdgeBuildRateMS }},
+	{"REDIS_WATCH_RATE_MS", func(t Tunables) int { return t.RedisWatchRate }},
+	{"REDISCOVER_RATE_MS", func(t Tunables) int { return t.RediscoverRateMS }},
+	{"REQUEST_LIMIT", func(t Tunables) int { return t.RequestLimit }},
+	{"REQUEST_QUEUE_LIMIT", func(t Tunables) int { return t.RequestQueueLimit }},
+	{"REQUEST_QUEUE_WAIT_MS", func(t Tunables) int { return t.RequestQueueWaitMS }},
+}
+
+var (
+	tunables        Tunables
+	tunablesChanged = make(chan struct{}) // Closed and replaced when the tunables change.
+	tunablesMutex   sync.RWMutex          // Guards tunables, tunablesChanged and sources.
+	reloadMutex     sync.Mutex            // Applies one reload at a time.
+)
+
+func tunablesOf(cfg Config) Tunables {
+	return Tunables{
+		EdgeBuildRateMS:    cfg.EdgeBuildRateMS,
+		RedisWatchRate:     cfg.RedisWatchRate,
+		RediscoverRateMS:   cfg.RediscoverRateMS,
+		RequestLimit:       cfg.RequestLimit,
+		RequestQueueLimit:  cfg.RequestQueueLimit,
+		RequestQueueWaitMS: cfg.RequestQueueWaitMS,
+	}
+}
+
+func (t Tunables) applyTo(cfg *Config) {
+	cfg.EdgeBuildRateMS = t.EdgeBuildRateMS
+	cfg.RedisWatchRate = t.RedisWatchRate
+	cfg.RediscoverRateMS = t.RediscoverRateMS
+	cfg.RequestLimit = t.RequestLimit
+	cfg.RequestQueueLimit = t.RequestQueueLimit
+	cfg.RequestQueueWaitMS = t.RequestQueueWaitMS
+}
+
+// CurrentTunables - Returns the tunables in effect. Read them with this function instead of Cfg, which keeps the
+// values loaded at startup.
+func CurrentTunables() Tunables {
+	tunablesMutex.RLock()
+	defer tunablesMutex.RUnlock()
+	return tunables
+}
+
+// EdgeBuildRate - Returns how often the inter-cluster edges are built.
+func EdgeBuildRate() time.Duration {
+	return time.Duration(CurrentTunables().EdgeBuildRateMS) * time.Millisecond
+}
+
+// RedisWatchRate - Returns how often the connection to Redis is checked.
+func RedisWatchRate() time.Duration {
+	return time.Duration(CurrentTunables().RedisWatchRate) * time.Millisecond
+}
+
+// RediscoverRate - Returns how often the cluster resources are discovered again.
+func RediscoverRate() time.Duration {
+	return time.Duration(CurrentTunables().RediscoverRateMS) * time.Millisecond
+}
+
+// TunablesChanged - Returns a channel closed the next time the tunables change.
+func TunablesChanged() <-chan struct{} {
+	tunablesMutex.RLock()
+	defer tunablesMutex.RUnlock()
+	return tunablesChanged
+}
+
+// Sleep - Sleeps for the duration returned by rate. The duration is read again when the tunables change, so a
+// shorter rate takes effect without waiting for the end of the previous one.
+func Sleep(rate func() time.Duration) {
+	began := time.Now()
+	for {
+		changed := TunablesChanged()
+		remaining := rate() - time.Since(began)
+		if remaining <= 0 {
+			return
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-timer.C:
+			return
+		case <-changed:
+			timer.Stop()
+		}
+	}
+}
+
+// Effective - Returns the config in effect, with the current tunables.
+func Effective() Config {
+	cfg := Cfg
+	CurrentTunables().applyTo(&cfg)
+	return cfg
+}
+
+// Reload - Loads the config again and applies the tunables. A change to the other settings is logged, it needs a
+// restart. The current settings are kept when the config is invalid.
+func Reload() error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	cfg, loadedSources, err := load(Cfg.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	tunablesMutex.Lock()
+	defer tunablesMutex.Unlock()
+	previous, next := tunables, tunablesOf(cfg)
+	previous.applyTo(&cfg)
+	if restart := changedFields(Cfg, cfg); len(restart) > 0 {
+		glog.Warningf("Settings changed in the reloaded config that need a restart: %v", restart)
+	}
+	for _, setting := range tunableSettings {
+		sources[setting.env] = loadedSources[setting.env]
+		if before, after := setting.value(previous), setting.value(next); before != after {
+			glog.Infof("Reloaded %s, changed from %d to %d", setting.env, before, after)
+		}
+	}
+	if next != previous {
+		tunables = next
+		close(tunablesChanged)
+		tunablesChanged = make(chan struct{})
+	}
+	return nil
+}
+
+// Returns the names of the fields that differ.
+func changedFields(before, after Config) []string {
+	changed := []string{}
+	beforeValue, afterValue := reflect.ValueOf(before), reflect.ValueOf(after)
+	for i := 0; i < beforeValue.NumField(); i++ {
+		if beforeValue.Field(i).Interface() != afterValue.Field(i).Interface() {
+			changed = append(changed, beforeValue.Type().Field(i).Name)
+		}
+	}
+	return changed
+}
+
+// WatchReload - Reloads the config on SIGHUP and when CONFIG_FILE changes, until stop is closed.
+func WatchReload(stop <-chan struct{}) error {
+	reload := func(reason string) {
+		if err := Reload(); err != nil {
+			glog.Error("Failed to reload the config after ", reason, ", keeping the current settings. ", err)
+		}
+	}
+	if Cfg.ConfigFile != "" {
+		err := watchFiles([]string{Cfg.ConfigFile}, stop, func(name string) { reload("a change to " + name) })
+		if err != nil {
+			return err
+		}
+	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hangup)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-hangup:
+				reload("SIGHUP")
+			}
+		}
+	}()
+	return nil
+}
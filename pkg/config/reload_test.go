@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// Uses the config file for the reloads until the test ends, then restores the config.
+func setReloadConfigFile(t *testing.T, path string) {
+	previousCfg, previousTunables, previousSources := Cfg, CurrentTunables(), Sources()
+	Cfg.ConfigFile = path
+	t.Cleanup(func() {
+		reloadMutex.Lock()
+		defer reloadMutex.Unlock()
+		tunablesMutex.Lock()
+		defer tunablesMutex.Unlock()
+		Cfg, tunables, sources = previousCfg, previousTunables, previousSources
+	})
+}
+
+func TestReload(t *testing.T) {
+	path := writeConfigFile(t, "REQUEST_LIMIT: 3\n")
+	setReloadConfigFile(t, path)
+	changed := TunablesChanged()
+
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if CurrentTunables().RequestLimit != 3 || Effective().RequestLimit != 3 {
+		t.Errorf("Failed testing Reload()  Expected REQUEST_LIMIT: 3  Got: %d", CurrentTunables().RequestLimit)
+	}
+	if Sources()["REQUEST_LIMIT"] != SourceConfigFile {
+		t.Errorf("Failed testing Reload()  Expected REQUEST_LIMIT from the config file  Got: %s",
+			Sources()["REQUEST_LIMIT"])
+	}
+	select {
+	case <-changed:
+	default:
+		t.Error("Failed testing Reload()  Expected the TunablesChanged channel to be closed.")
+	}
+
+	// Only the tunables are applied at runtime.
+	if err := os.WriteFile(path, []byte("REQUEST_LIMIT: 3\nBATCH_SIZE: 42\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if Effective().BatchSize != Cfg.BatchSize || Cfg.BatchSize == 42 {
+		t.Errorf("Failed testing Reload()  Expected BATCH_SIZE to need a restart  Got: %d", Effective().BatchSize)
+	}
+
+	// An invalid config is rejected.
+	if err := os.WriteFile(path, []byte("REQUEST_LIMIT: 0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(); err == nil {
+		t.Error("Failed testing Reload()  Expected an error for REQUEST_LIMIT 0.")
+	}
+	if CurrentTunables().RequestLimit != 3 {
+		t.Errorf("Failed testing Reload()  Expected to keep REQUEST_LIMIT: 3  Got: %d", CurrentTunables().RequestLimit)
+	}
+}
+
+// A shorter rate wakes up the sleepers without waiting for the end of the previous one.
+func TestSleep_reloaded(t *testing.T) {
+	setReloadConfigFile(t, writeConfigFile(t, "EDGE_BUILD_RATE_MS: 10\n"))
+	tunablesMutex.Lock()
+	tunables.EdgeBuildRateMS = int(time.Hour / time.Millisecond)
+	tunablesMutex.Unlock()
+
+	slept := make(chan struct{})
+	go func() {
+		Sleep(EdgeBuildRate)
+		close(slept)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-slept:
+	case <-time.After(5 * time.Second):
+		t.Error("Failed testing Sleep()  Expected to wake up after the rate was reloaded.")
+	}
+}
+
+// The tunables are reloaded when the config file changes.
+func TestWatchReload(t *testing.T) {
+	path := writeConfigFile(t, "REQUEST_QUEUE_LIMIT: 5\n")
+	setReloadConfigFile(t, path)
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := WatchReload(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("REQUEST_QUEUE_LIMIT: 7\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if CurrentTunables().RequestQueueLimit == 7 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Failed testing WatchReload()  Expected REQUEST_QUEUE_LIMIT: 7  Got: %d",
+		CurrentTunables().RequestQueueLimit)
+}
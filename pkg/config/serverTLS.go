@@ -0,0 +1,128 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// ServerTLSConfig - Returns the TLS config of the server with the min version and cipher suites in the config.
+// The certificate isn't set, see CertificateReloader.
+func ServerTLSConfig() (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(Cfg.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := parseCipherSuites(Cfg.TLSCipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:               minVersion,
+		CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
+		PreferServerCipherSuites: true,
+		CipherSuites:             cipherSuites,
+	}, nil
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	switch strings.TrimSpace(version) {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS_MIN_VERSION %q, expected 1.2 or 1.3", version)
+}
+
+// Returns the IDs of the comma separated cipher suites. Only the cipher suites Go considers secure are accepted.
+func parseCipherSuites(names string) ([]uint16, error) {
+	secure := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = suite.ID
+	}
+	ids := []uint16{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, ok := secure[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure cipher suite %q in TLS_CIPHER_SUITES", name)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no cipher suite in TLS_CIPHER_SUITES")
+	}
+	return ids, nil
+}
+
+// CertificateReloader - Serves the certificate in the files, and loads it again when the files change on disk,
+// so a rotated certificate is used without a restart.
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+	mutex    sync.RWMutex
+	cert     *tls.Certificate
+	certPEM  []byte // To log only the reloads that changed the certificate.
+}
+
+// NewCertificateReloader - Loads the certificate. Call Watch to reload it when the files change.
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate - Returns the current certificate, used as tls.Config.GetCertificate.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert, nil
+}
+
+// Loads the certificate from the files. On error, the previous certificate is kept.
+func (r *CertificateReloader) reload() error {
+	certPEM, err := os.ReadFile(r.certFile) // #nosec G304
+	if err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(r.keyFile) // #nosec G304
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.cert != nil && !bytes.Equal(certPEM, r.certPEM) {
+		glog.Info("Reloaded the server certificate from ", r.certFile)
+	}
+	r.cert = &cert
+	r.certPEM = certPEM
+	return nil
+}
+
+// Watch - Reloads the certificate when the files change, until stop is closed.
+func (r *CertificateReloader) Watch(stop <-chan struct{}) error {
+	return watchFiles([]string{r.certFile, r.keyFile}, stop, func(name string) {
+		// The certificate and the key are written one after the other, the first reload can fail.
+		if err := r.reload(); err != nil {
+			glog.V(2).Infof("Unable to reload the server certificate after a change to %s. %s", name, err)
+		}
+	})
+}
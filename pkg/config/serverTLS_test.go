@@ -0,0 +1,123 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package config
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes a self-signed certificate with the common name to the files.
+func writeServerCertificate(t *testing.T, certFile, keyFile, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err = os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_parseTLSVersion(t *testing.T) {
+	if version, err := parseTLSVersion("1.3"); err != nil || version != tls.VersionTLS13 {
+		t.Errorf("Failed testing parseTLSVersion()  Expected: %d  Got: %d %v", tls.VersionTLS13, version, err)
+	}
+	if _, err := parseTLSVersion("1.0"); err == nil {
+		t.Error("Failed testing parseTLSVersion()  Expected an error for TLS 1.0")
+	}
+}
+
+func Test_parseCipherSuites(t *testing.T) {
+	ids, err := parseCipherSuites("TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384")
+	expected := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}
+	if err != nil || len(ids) != 2 || ids[0] != expected[0] || ids[1] != expected[1] {
+		t.Errorf("Failed testing parseCipherSuites()  Expected: %v  Got: %v %v", expected, ids, err)
+	}
+
+	// Insecure, unknown and missing cipher suites are rejected.
+	for _, names := range []string{"TLS_RSA_WITH_RC4_128_SHA", "TLS_NOT_A_CIPHER", " , "} {
+		if _, err = parseCipherSuites(names); err == nil {
+			t.Errorf("Failed testing parseCipherSuites()  Expected an error for %q", names)
+		}
+	}
+}
+
+func Test_ServerTLSConfig(t *testing.T) {
+	previousVersion, previousSuites := Cfg.TLSMinVersion, Cfg.TLSCipherSuites
+	defer func() { Cfg.TLSMinVersion, Cfg.TLSCipherSuites = previousVersion, previousSuites }()
+
+	Cfg.TLSMinVersion, Cfg.TLSCipherSuites = "1.2", DEFAULT_TLS_CIPHER_SUITES
+	cfg, err := ServerTLSConfig()
+	if err != nil || cfg.MinVersion != tls.VersionTLS12 || len(cfg.CipherSuites) != 1 {
+		t.Errorf("Failed testing ServerTLSConfig()  Got: %+v %v", cfg, err)
+	}
+
+	Cfg.TLSMinVersion = "1.1"
+	if _, err = ServerTLSConfig(); err == nil {
+		t.Error("Failed testing ServerTLSConfig()  Expected an error for TLS 1.1")
+	}
+}
+
+// The certificate is reloaded when the files are replaced.
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeServerCertificate(t, certFile, keyFile, "first")
+
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	if err = reloader.Watch(stop); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := reloader.GetCertificate(nil)
+
+	writeServerCertificate(t, certFile, keyFile, "second")
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if current, _ := reloader.GetCertificate(nil); !bytes.Equal(current.Certificate[0], first.Certificate[0]) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Failed testing CertificateReloader  Expected the certificate to be reloaded.")
+}
+
+func TestNewCertificateReloader_missingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewCertificateReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")); err == nil {
+		t.Error("Failed testing NewCertificateReloader()  Expected an error for missing files.")
+	}
+}
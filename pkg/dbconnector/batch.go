@@ -0,0 +1,83 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"github.com/golang/glog"
+	"github.com/stolostron/search-aggregator/pkg/config"
+)
+
+// BatchSize - Max number of resources or edges written by a single query, from config.Cfg.BatchSize.
+// The batches of each operation adapt below it, see batchSizer.
+func BatchSize() int {
+	if config.Cfg.BatchSize < 1 {
+		glog.Warningf("Invalid BATCH_SIZE %d, using %d.", config.Cfg.BatchSize, config.DEFAULT_BATCH_SIZE)
+		return config.DEFAULT_BATCH_SIZE
+	}
+	return config.Cfg.BatchSize
+}
+
+// Groups the resources by kind, because a label can't be a query parameter. runBatches splits the groups
+// in batches. The groups are in the order the kinds are first seen.
+func groupResources(resources []*Resource) [][]*Resource {
+	var kinds []string
+	byKind := make(map[string][]*Resource)
+	for _, resource := range resources {
+		kind, _ := resource.Properties["kind"].(string)
+		if _, seen := byKind[kind]; !seen {
+			kinds = append(kinds, kind)
+		}
+		byKind[kind] = append(byKind[kind], resource)
+	}
+	groups := make([][]*Resource, 0, len(kinds))
+	for _, kind := range kinds {
+		groups = append(groups, byKind[kind])
+	}
+	return groups
+}
+
+// Groups the edges by type and labels, the parts of an edge query that can't be parameters. runBatches splits
+// the groups in batches. The groups are in the order they are first seen.
+func groupEdges(edges []Edge) [][]Edge {
+	type group struct{ edgeType, sourceLabel, destLabel string }
+	var keys []group
+	byGroup := make(map[group][]Edge)
+	for _, edge := range edges {
+		sourceLabel, destLabel := edgeLabels(edge)
+		g := group{edge.EdgeType, sourceLabel, destLabel}
+		if _, seen := byGroup[g]; !seen {
+			keys = append(keys, g)
+		}
+		byGroup[g] = append(byGroup[g], edge)
+	}
+	groups := make([][]Edge, 0, len(keys))
+	for _, g := range keys {
+		groups = append(groups, byGroup[g])
+	}
+	return groups
+}
+
+func resourceGroupSizes(groups [][]*Resource) []int {
+	sizes := make([]int, 0, len(groups))
+	for _, group := range groups {
+		sizes = append(sizes, len(group))
+	}
+	return sizes
+}
+
+func edgeGroupSizes(groups [][]Edge) []int {
+	sizes := make([]int, 0, len(groups))
+	for _, group := range groups {
+		sizes = append(sizes, len(group))
+	}
+	return sizes
+}
+
+// Returns the labels used to match the nodes of an edge, e.g. ":Pod". They are only used when both kinds are known.
+func edgeLabels(edge Edge) (string, string) {
+	if edge.SourceKind != "" && edge.DestKind != "" {
+		return ":" + edge.SourceKind, ":" + edge.DestKind
+	}
+	return "", ""
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stolostron/search-aggregator/pkg/config"
+)
+
+// Size of the first batches, the fixed chunk size used before the batches adapted to the latency.
+const initialBatchSize = 40
+
+var batchSizeGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "search_aggregator_batch_size",
+	Help: "Current number of resources or edges written to the graph by a single query, per operation.",
+}, []string{"operation"})
+
+func init() {
+	prometheus.MustRegister(batchSizeGauge)
+}
+
+// Adapts the size of the batches of an operation to the latency of its queries. The size grows by a quarter
+// while the batches are written faster than config.Cfg.BatchTargetLatencyMS, shrinks in proportion when they are
+// slower, and halves when a batch had errors and was bisected or lost the connection.
+// It stays between config.Cfg.BatchSizeMin and config.Cfg.BatchSize.
+type batchSizer struct {
+	operation string
+	mutex     sync.Mutex
+	size      int
+}
+
+// Sizers shared by all the requests, so large resyncs and small updates learn from each other.
+var (
+	insertSizer     = newBatchSizer("insert")
+	updateSizer     = newBatchSizer("update")
+	deleteSizer     = newBatchSizer("delete")
+	insertEdgeSizer = newBatchSizer("insertEdge")
+	deleteEdgeSizer = newBatchSizer("deleteEdge")
+)
+
+func newBatchSizer(operation string) *batchSizer {
+	s := &batchSizer{operation: operation, size: initialBatchSize}
+	batchSizeGauge.WithLabelValues(operation).Set(float64(s.current()))
+	return s
+}
+
+// Returns the min and max batch sizes from the config.
+func batchSizeBounds() (int, int) {
+	max := BatchSize()
+	min := config.Cfg.BatchSizeMin
+	if min < 1 {
+		min = 1
+	}
+	if min > max {
+		min = max
+	}
+	return min, max
+}
+
+// Returns the size of the next batch.
+func (s *batchSizer) current() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	min, max := batchSizeBounds()
+	if s.size < min {
+		return min
+	}
+	if s.size > max {
+		return max
+	}
+	return s.size
+}
+
+// Updates the size with the result of writing a batch of the given size.
+func (s *batchSizer) observe(size int, elapsed time.Duration, result ChunkedOperationResult) {
+	target := time.Duration(config.Cfg.BatchTargetLatencyMS) * time.Millisecond
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch {
+	case result.ConnectionError != nil || len(result.ResourceErrors) > 0:
+		s.size = size / 2
+	case target > 0 && elapsed > target:
+		s.size = int(float64(size) * float64(target) / float64(elapsed))
+	case size >= s.size: // Smaller batches, like the last one of a group, don't tell if a larger size is fast.
+		s.size = size + size/4 + 1
+	}
+	min, max := batchSizeBounds()
+	if s.size < min {
+		s.size = min
+	}
+	if s.size > max {
+		s.size = max
+	}
+	batchSizeGauge.WithLabelValues(s.operation).Set(float64(s.size))
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Sets the bounds and the target latency until the test ends, and returns a sizer starting at size.
+func newTestSizer(t *testing.T, size, min, max, targetMS int) *batchSizer {
+	previousMax, previousMin, previousTarget := config.Cfg.BatchSize, config.Cfg.BatchSizeMin,
+		config.Cfg.BatchTargetLatencyMS
+	config.Cfg.BatchSize, config.Cfg.BatchSizeMin, config.Cfg.BatchTargetLatencyMS = max, min, targetMS
+	t.Cleanup(func() {
+		config.Cfg.BatchSize, config.Cfg.BatchSizeMin, config.Cfg.BatchTargetLatencyMS = previousMax, previousMin,
+			previousTarget
+	})
+	return &batchSizer{operation: "test", size: size}
+}
+
+func Test_batchSizer_grows(t *testing.T) {
+	s := newTestSizer(t, 40, 10, 100, 1000)
+	s.observe(40, 100*time.Millisecond, ChunkedOperationResult{})
+	assert.Equal(t, 51, s.current())
+	assert.Equal(t, float64(51), testutil.ToFloat64(batchSizeGauge.WithLabelValues("test")))
+
+	s.observe(20, 100*time.Millisecond, ChunkedOperationResult{})
+	assert.Equal(t, 51, s.current(), "A smaller batch doesn't grow the size.")
+
+	for i := 0; i < 10; i++ {
+		s.observe(s.current(), 100*time.Millisecond, ChunkedOperationResult{})
+	}
+	assert.Equal(t, 100, s.current(), "The size doesn't grow over BATCH_SIZE.")
+}
+
+func Test_batchSizer_slowQuery(t *testing.T) {
+	s := newTestSizer(t, 80, 10, 100, 1000)
+	s.observe(80, 4*time.Second, ChunkedOperationResult{})
+	assert.Equal(t, 20, s.current())
+
+	s.observe(20, time.Minute, ChunkedOperationResult{})
+	assert.Equal(t, 10, s.current(), "The size doesn't shrink under BATCH_SIZE_MIN.")
+}
+
+func Test_batchSizer_errors(t *testing.T) {
+	s := newTestSizer(t, 80, 10, 100, 1000)
+	s.observe(80, time.Millisecond, ChunkedOperationResult{ResourceErrors: map[string]error{"uid": errors.New("x")}})
+	assert.Equal(t, 40, s.current(), "Bisected batches halve the size.")
+
+	s.observe(40, time.Millisecond, ChunkedOperationResult{ConnectionError: errors.New("EOF")})
+	assert.Equal(t, 20, s.current())
+}
+
+func Test_batchSizer_bounds(t *testing.T) {
+	s := newTestSizer(t, 40, 0, 20, 1000)
+	assert.Equal(t, 20, s.current(), "The size is limited by a lower BATCH_SIZE.")
+
+	config.Cfg.BatchSizeMin = 50
+	assert.Equal(t, 20, s.current(), "BATCH_SIZE_MIN can't be larger than BATCH_SIZE.")
+}
+
+// The batches of an operation shrink after a slow batch, while the operation runs.
+func Test_runBatches_adaptive(t *testing.T) {
+	setBatchWorkers(t, 1)
+	s := newTestSizer(t, 8, 2, 8, 10)
+	sizes := []int{}
+	runBatches(s, []int{20}, func(_, start, end int) ChunkedOperationResult {
+		sizes = append(sizes, end-start)
+		if start == 0 {
+			time.Sleep(40 * time.Millisecond) // 4 times the target latency.
+		}
+		return ChunkedOperationResult{SuccessfulResources: end - start}
+	})
+	assert.Equal(t, 8, sizes[0])
+	assert.Equal(t, 2, sizes[1])
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+	assert.Equal(t, 20, total)
+}
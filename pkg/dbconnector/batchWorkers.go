@@ -0,0 +1,109 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-aggregator/pkg/config"
+)
+
+// Slots limiting the batches written concurrently by all the requests. Created on first use from
+// config.Cfg.BatchWorkersLimit.
+var (
+	batchSlots     chan struct{}
+	batchSlotsOnce sync.Once
+)
+
+func acquireBatchSlot() {
+	batchSlotsOnce.Do(func() {
+		limit := config.Cfg.BatchWorkersLimit
+		if limit < 1 {
+			glog.Warningf("Invalid BATCH_WORKERS_LIMIT %d, using %d.", limit, config.DEFAULT_BATCH_WORKERS_LIMIT)
+			limit = config.DEFAULT_BATCH_WORKERS_LIMIT
+		}
+		batchSlots = make(chan struct{}, limit)
+	})
+	batchSlots <- struct{}{}
+}
+
+func releaseBatchSlot() {
+	<-batchSlots
+}
+
+// Splits the groups in batches of the size given by the sizer, runs write for each batch and merges the results.
+// groupSizes are the number of items in each group, write gets the group and the range of items of the batch.
+// Up to config.Cfg.BatchWorkers batches of the operation are written at the same time, each one holding a global
+// slot while it's written. After a ConnectionError no more batches are started and only the ConnectionError
+// is returned.
+func runBatches(sizer *batchSizer, groupSizes []int,
+	write func(group, start, end int) ChunkedOperationResult) ChunkedOperationResult {
+	var (
+		mutex  sync.Mutex
+		group  int // Group and first item of the next batch.
+		start  int
+		merged ChunkedOperationResult
+	)
+	// Returns the next batch to write, false once all of them were started or a batch lost the connection.
+	take := func() (int, int, int, bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		for group < len(groupSizes) && start >= groupSizes[group] {
+			group, start = group+1, 0
+		}
+		if group >= len(groupSizes) || merged.ConnectionError != nil {
+			return 0, 0, 0, false
+		}
+		end := min(start+sizer.current(), groupSizes[group])
+		batchStart := start
+		start = end
+		return group, batchStart, end, true
+	}
+	worker := func() {
+		for g, start, end, ok := take(); ok; g, start, end, ok = take() {
+			acquireBatchSlot()
+			began := time.Now()
+			result := write(g, start, end)
+			elapsed := time.Since(began)
+			releaseBatchSlot()
+			sizer.observe(end-start, elapsed, result)
+
+			mutex.Lock()
+			if result.ConnectionError != nil && merged.ConnectionError == nil {
+				merged.ConnectionError = result.ConnectionError
+			}
+			merged.ResourceErrors = mergeErrorMaps(merged.ResourceErrors, result.ResourceErrors)
+			merged.SuccessfulResources += result.SuccessfulResources
+			merged.EdgesAdded += result.EdgesAdded
+			merged.EdgesDeleted += result.EdgesDeleted
+			mutex.Unlock()
+		}
+	}
+
+	batches := 0 // Number of batches at the current size, more workers wouldn't have any batch to write.
+	size := sizer.current()
+	for _, items := range groupSizes {
+		batches += (items + size - 1) / size
+	}
+	workers := min(config.Cfg.BatchWorkers, batches)
+	if workers <= 1 {
+		worker()
+	} else {
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				worker()
+			}()
+		}
+		wg.Wait()
+	}
+	if merged.ConnectionError != nil {
+		return ChunkedOperationResult{ConnectionError: merged.ConnectionError}
+	}
+	return merged
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Sets config.Cfg.BatchWorkers until the test ends.
+func setBatchWorkers(t *testing.T, workers int) {
+	previous := config.Cfg.BatchWorkers
+	config.Cfg.BatchWorkers = workers
+	t.Cleanup(func() { config.Cfg.BatchWorkers = previous })
+}
+
+// Sets a fixed batch size until the test ends, and returns a sizer using it.
+func fixedBatchSize(t *testing.T, size int) *batchSizer {
+	previousSize, previousMin := config.Cfg.BatchSize, config.Cfg.BatchSizeMin
+	config.Cfg.BatchSize, config.Cfg.BatchSizeMin = size, size
+	t.Cleanup(func() { config.Cfg.BatchSize, config.Cfg.BatchSizeMin = previousSize, previousMin })
+	return &batchSizer{operation: "test", size: size}
+}
+
+// Tracks the number of batches written at the same time.
+type concurrencyTracker struct {
+	mutex   sync.Mutex
+	running int
+	max     int
+}
+
+func (c *concurrencyTracker) enter() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.running++
+	if c.running > c.max {
+		c.max = c.running
+	}
+}
+
+func (c *concurrencyTracker) exit() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.running--
+}
+
+func Test_runBatches_merge(t *testing.T) {
+	setBatchWorkers(t, 3)
+	sizer := fixedBatchSize(t, 1)
+	result := runBatches(sizer, []int{4, 6}, func(group, batch, _ int) ChunkedOperationResult {
+		batch += group * 4
+		if batch%4 == 0 {
+			return ChunkedOperationResult{ResourceErrors: map[string]error{fmt.Sprint(batch): errors.New("failed")}}
+		}
+		return ChunkedOperationResult{SuccessfulResources: 2, EdgesAdded: 1, EdgesDeleted: 1}
+	})
+	assert.NoError(t, result.ConnectionError)
+	assert.Len(t, result.ResourceErrors, 3) // 0, 4 and 8
+	assert.Equal(t, 14, result.SuccessfulResources)
+	assert.Equal(t, 7, result.EdgesAdded)
+	assert.Equal(t, 7, result.EdgesDeleted)
+}
+
+func Test_runBatches_concurrent(t *testing.T) {
+	setBatchWorkers(t, 2)
+	tracker := &concurrencyTracker{}
+	bothStarted := make(chan struct{})
+	var once sync.Once
+	started := 0
+	var mutex sync.Mutex
+
+	runBatches(fixedBatchSize(t, 1), []int{6}, func(_, _, _ int) ChunkedOperationResult {
+		tracker.enter()
+		defer tracker.exit()
+		mutex.Lock()
+		started++
+		if started == 2 {
+			once.Do(func() { close(bothStarted) })
+		}
+		mutex.Unlock()
+		select { // The first batches wait for each other, they only finish if they run concurrently.
+		case <-bothStarted:
+		case <-time.After(5 * time.Second):
+			t.Error("The batches weren't written concurrently.")
+		}
+		return ChunkedOperationResult{SuccessfulResources: 1}
+	})
+	assert.Equal(t, 2, tracker.max)
+}
+
+func Test_runBatches_sequential(t *testing.T) {
+	setBatchWorkers(t, 1)
+	tracker := &concurrencyTracker{}
+	order := []int{}
+	runBatches(fixedBatchSize(t, 1), []int{5}, func(_, batch, _ int) ChunkedOperationResult {
+		tracker.enter()
+		defer tracker.exit()
+		order = append(order, batch)
+		return ChunkedOperationResult{}
+	})
+	assert.Equal(t, 1, tracker.max)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, order)
+}
+
+// No batches are started after a connection error.
+func Test_runBatches_connectionError(t *testing.T) {
+	setBatchWorkers(t, 1)
+	written := 0
+	result := runBatches(fixedBatchSize(t, 1), []int{5}, func(_, batch, _ int) ChunkedOperationResult {
+		written++
+		if batch == 1 {
+			return ChunkedOperationResult{ConnectionError: errors.New("connection refused")}
+		}
+		return ChunkedOperationResult{SuccessfulResources: 1,
+			ResourceErrors: map[string]error{"uid": errors.New("failed")}}
+	})
+	assert.Equal(t, 2, written)
+	assert.EqualError(t, result.ConnectionError, "connection refused")
+	assert.Nil(t, result.ResourceErrors)
+	assert.Equal(t, 0, result.SuccessfulResources)
+}
+
+// The global limit applies to the batches of all the operations.
+func Test_runBatches_globalLimit(t *testing.T) {
+	setBatchWorkers(t, 4)
+	acquireBatchSlot() // Creates the slots.
+	releaseBatchSlot()
+	previousSlots := batchSlots
+	batchSlots = make(chan struct{}, 2)
+	defer func() { batchSlots = previousSlots }()
+
+	sizer := fixedBatchSize(t, 1)
+	tracker := &concurrencyTracker{}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runBatches(sizer, []int{8}, func(_, _, _ int) ChunkedOperationResult {
+				tracker.enter()
+				defer tracker.exit()
+				time.Sleep(time.Millisecond)
+				return ChunkedOperationResult{}
+			})
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, tracker.max, 2)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stolostron/search-aggregator/pkg/dbconnector/memgraph"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestResource(kind, uid string) *Resource {
+	return &Resource{Kind: kind, UID: uid, Properties: map[string]interface{}{"kind": kind, "name": uid}}
+}
+
+func Test_groupResources(t *testing.T) {
+	pod1, pod2, pod3 := newTestResource("Pod", "pod1"), newTestResource("Pod", "pod2"), newTestResource("Pod", "pod3")
+	dep1 := newTestResource("Deployment", "dep1")
+
+	groups := groupResources([]*Resource{pod1, dep1, pod2, pod3})
+	assert.Equal(t, [][]*Resource{{pod1, pod2, pod3}, {dep1}}, groups)
+	assert.Equal(t, []int{3, 1}, resourceGroupSizes(groups))
+}
+
+func Test_groupEdges(t *testing.T) {
+	e1 := Edge{SourceUID: "a", DestUID: "b", EdgeType: "ownedBy", SourceKind: "Pod", DestKind: "ReplicaSet"}
+	e2 := Edge{SourceUID: "c", DestUID: "d", EdgeType: "ownedBy", SourceKind: "ReplicaSet", DestKind: "Deployment"}
+	e3 := Edge{SourceUID: "e", DestUID: "b", EdgeType: "ownedBy", SourceKind: "Pod", DestKind: "ReplicaSet"}
+	e4 := Edge{SourceUID: "f", DestUID: "b", EdgeType: "ownedBy", SourceKind: "Pod"} // No labels without DestKind.
+
+	groups := groupEdges([]Edge{e1, e2, e3, e4})
+	assert.Equal(t, [][]Edge{{e1, e3}, {e2}, {e4}}, groups)
+	assert.Equal(t, []int{2, 1, 1}, edgeGroupSizes(groups))
+}
+
+func Test_BatchSize(t *testing.T) {
+	previous := config.Cfg.BatchSize
+	defer func() { config.Cfg.BatchSize = previous }()
+
+	config.Cfg.BatchSize = 100
+	assert.Equal(t, 100, BatchSize())
+	config.Cfg.BatchSize = 0
+	assert.Equal(t, config.DEFAULT_BATCH_SIZE, BatchSize())
+}
+
+func Test_insertQuery(t *testing.T) {
+	pod1, pod2 := newTestResource("Pod", "pod1"), newTestResource("Pod", "pod2")
+	pod2.Properties["restarts"] = int64(2)
+
+	query, encodingErrors := insertQuery([]*Resource{pod1, pod2}, "c1")
+	assert.Empty(t, encodingErrors)
+	assert.Equal(t, "CYPHER p0='c1' p1=[{_rbac: 'null_null_', _uid: 'pod1', kind: 'pod', name: 'pod1'}, "+
+		"{_rbac: 'null_null_', _uid: 'pod2', kind: 'pod', name: 'pod2', restarts: 2}] "+
+		"MATCH (c:Cluster {name: $p0}) UNWIND $p1 AS r CREATE (:Pod {_uid: r._uid, _rbac: r._rbac, kind: r.kind, "+
+		"name: r.name, restarts: r.restarts})-[:inCluster {_interCluster: true}]->(c)", query)
+}
+
+func Test_updateQuery(t *testing.T) {
+	query, encodingErrors := updateQuery([]*Resource{newTestResource("Pod", "pod1"), newTestResource("Node", "n1")})
+	assert.Error(t, encodingErrors["n1"], "A batch has a single kind.")
+	assert.Equal(t, "CYPHER p0=[{_rbac: 'null_null_', _uid: 'pod1', kind: 'pod', name: 'pod1'}] "+
+		"UNWIND $p0 AS r MATCH (n:Pod {_uid: r._uid}) SET n._rbac=coalesce(r._rbac, n._rbac), "+
+		"n.kind=coalesce(r.kind, n.kind), n.name=coalesce(r.name, n.name)", query)
+}
+
+func Test_deleteQuery(t *testing.T) {
+	assert.Equal(t, "CYPHER p0=['pod1', 'pod2'] MATCH (n) WHERE n._uid IN $p0 DELETE n",
+		deleteQuery([]string{"pod1", "pod2"}))
+}
+
+// Writes more resources and edges than the batch size, with several kinds, to the in-memory graph.
+func TestBatchedWrites(t *testing.T) {
+	previousStore := Store
+	Store = memgraph.New()
+	defer func() { Store = previousStore }()
+	fixedBatchSize(t, 2)
+	setBatchWorkers(t, 3)
+
+	_, err := MergeDummyCluster("c1")
+	assert.NoError(t, err)
+	resources := []*Resource{}
+	edges := []Edge{}
+	for _, uid := range []string{"a", "b", "c", "d", "e"} {
+		pod, rs := newTestResource("Pod", "pod-"+uid), newTestResource("ReplicaSet", "rs-"+uid)
+		resources = append(resources, pod, rs)
+		edges = append(edges, Edge{SourceUID: pod.UID, DestUID: rs.UID, EdgeType: "ownedBy", SourceKind: "Pod",
+			DestKind: "ReplicaSet"})
+	}
+	resources[0].Properties["restarts"] = int64(1)
+
+	insertResult := ChunkedInsert(context.Background(), resources, "c1")
+	assert.Empty(t, insertResult.ResourceErrors)
+	assert.Equal(t, 10, insertResult.SuccessfulResources)
+	edgeResult := ChunkedInsertEdge(context.Background(), edges, "c1")
+	assert.Empty(t, edgeResult.ResourceErrors)
+	assert.Equal(t, 5, edgeResult.EdgesAdded)
+
+	// Properties missing from the update keep their value.
+	update := newTestResource("Pod", "pod-a")
+	update.Properties["name"] = "renamed"
+	updateResult := ChunkedUpdate(context.Background(), []*Resource{update})
+	assert.Empty(t, updateResult.ResourceErrors)
+	result, err := Store.Query("MATCH (n:Pod {_uid: 'pod-a'}) RETURN n.name, n.restarts")
+	assert.NoError(t, err)
+	assert.True(t, result.Next())
+	assert.Equal(t, []interface{}{"renamed", 1}, result.Record().Values())
+
+	deleteEdgeResult := ChunkedDeleteEdge(context.Background(), edges[:3], "c1")
+	assert.Equal(t, 3, deleteEdgeResult.EdgesDeleted)
+	deleteResult := ChunkedDelete(context.Background(), []string{"pod-a", "pod-b", "pod-c"})
+	assert.Equal(t, 3, deleteResult.SuccessfulResources)
+	result, err = Store.Query("MATCH (n:Pod) RETURN count(n)")
+	assert.NoError(t, err)
+	assert.True(t, result.Next())
+	assert.Equal(t, 2, result.Record().GetByIndex(0))
+}
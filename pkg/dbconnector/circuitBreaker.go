@@ -0,0 +1,160 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stolostron/search-aggregator/pkg/config"
+)
+
+// State of the circuit breaker around the RedisGraph store.
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "Closed"   // Queries go to Redis.
+	CircuitOpen     CircuitState = "Open"     // Queries fail fast without borrowing a connection.
+	CircuitHalfOpen CircuitState = "HalfOpen" // A single query probes Redis, the others fail fast.
+)
+
+// Value of the circuit breaker gauge for each state.
+var circuitStateValues = map[CircuitState]float64{CircuitClosed: 0, CircuitHalfOpen: 1, CircuitOpen: 2}
+
+var circuitStateGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "search_aggregator_redis_circuit_state",
+	Help: "State of the circuit breaker around RedisGraph: 0 closed, 1 half-open, 2 open.",
+})
+
+func init() {
+	prometheus.MustRegister(circuitStateGauge)
+}
+
+// Returned instead of running the query while the circuit is open.
+type CircuitOpenError struct {
+	RetryAfter time.Duration // Time until a query can probe Redis again.
+}
+
+func (e CircuitOpenError) Error() string {
+	return fmt.Sprintf("RedisGraph is unavailable after repeated connection failures, retry in %s",
+		e.RetryAfter.Round(time.Millisecond))
+}
+
+// Tells whether the query wasn't run because the circuit is open, and when to retry.
+func IsCircuitOpen(err error) (time.Duration, bool) {
+	var openErr CircuitOpenError
+	if errors.As(err, &openErr) {
+		return openErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// Wraps a DBStore, so that during a Redis outage queries fail fast instead of waiting for a pooled connection
+// that can't be dialed. The circuit opens after config.Cfg.CircuitBreakerThreshold consecutive connection
+// errors. After config.Cfg.CircuitBreakerOpenMS it turns half-open and lets a single query through: the
+// circuit closes if that query reaches Redis, otherwise it opens again.
+type circuitBreaker struct {
+	store    DBStore
+	mutex    sync.Mutex
+	state    CircuitState
+	failures int       // Consecutive connection errors.
+	openedAt time.Time // When the circuit was last opened.
+	probing  bool      // A half-open query is running.
+	now      func() time.Time
+}
+
+// The breaker around the RedisGraph store, nil when it's disabled or the in-memory graph is used.
+var storeBreaker *circuitBreaker
+
+func newCircuitBreaker(store DBStore) *circuitBreaker {
+	circuitStateGauge.Set(circuitStateValues[CircuitClosed])
+	return &circuitBreaker{store: store, state: CircuitClosed, now: time.Now}
+}
+
+func (b *circuitBreaker) Query(q string) (*rg2.QueryResult, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	result, err := b.store.Query(q)
+	b.record(err)
+	return result, err
+}
+
+func (b *circuitBreaker) openDuration() time.Duration {
+	return time.Duration(config.Cfg.CircuitBreakerOpenMS) * time.Millisecond
+}
+
+// Returns the current state and, while it's open, the time until it turns half-open. Must hold the mutex.
+func (b *circuitBreaker) currentState() (CircuitState, time.Duration) {
+	if b.state == CircuitOpen {
+		if remaining := b.openedAt.Add(b.openDuration()).Sub(b.now()); remaining > 0 {
+			return CircuitOpen, remaining
+		}
+		b.setState(CircuitHalfOpen)
+	}
+	return b.state, 0
+}
+
+// Returns a CircuitOpenError if the query can't run now.
+func (b *circuitBreaker) allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	state, remaining := b.currentState()
+	switch {
+	case state == CircuitOpen:
+		return CircuitOpenError{RetryAfter: remaining}
+	case state == CircuitHalfOpen && b.probing:
+		return CircuitOpenError{RetryAfter: time.Second} // Until the probe completes.
+	case state == CircuitHalfOpen:
+		b.probing = true
+	}
+	return nil
+}
+
+// Updates the state with the result of a query.
+func (b *circuitBreaker) record(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !isConnectionError(err) { // Redis responded, even if the query failed or timed out.
+		if b.state != CircuitClosed {
+			glog.Info("RedisGraph is reachable again, closing the circuit breaker.")
+		}
+		b.failures = 0
+		b.probing = false
+		b.setState(CircuitClosed)
+		return
+	}
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= config.Cfg.CircuitBreakerThreshold {
+		if b.state != CircuitOpen {
+			glog.Warningf("Opening the circuit breaker for %s after %d consecutive RedisGraph connection failures. %s",
+				b.openDuration(), b.failures, err)
+		}
+		b.openedAt = b.now()
+		b.probing = false
+		b.setState(CircuitOpen)
+	}
+}
+
+// Must hold the mutex.
+func (b *circuitBreaker) setState(state CircuitState) {
+	b.state = state
+	circuitStateGauge.Set(circuitStateValues[state])
+}
+
+// Returns the state of the circuit breaker around RedisGraph and, while it's open, the time until a query can
+// probe Redis again. The circuit is always closed when the breaker is disabled.
+func CircuitBreakerState() (CircuitState, time.Duration) {
+	if storeBreaker == nil {
+		return CircuitClosed, 0
+	}
+	storeBreaker.mutex.Lock()
+	defer storeBreaker.mutex.Unlock()
+	return storeBreaker.currentState()
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Store returning the given error, or an empty result.
+type stubStore struct {
+	err     error
+	queries int
+}
+
+func (s *stubStore) Query(q string) (*rg2.QueryResult, error) {
+	s.queries++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &rg2.QueryResult{}, nil
+}
+
+// Returns a breaker with a fake clock, opening after 3 failures for 10 seconds.
+func newTestBreaker(t *testing.T, store DBStore) (*circuitBreaker, *time.Time) {
+	previousThreshold, previousOpen := config.Cfg.CircuitBreakerThreshold, config.Cfg.CircuitBreakerOpenMS
+	config.Cfg.CircuitBreakerThreshold, config.Cfg.CircuitBreakerOpenMS = 3, 10000
+	t.Cleanup(func() {
+		config.Cfg.CircuitBreakerThreshold, config.Cfg.CircuitBreakerOpenMS = previousThreshold, previousOpen
+	})
+	now := time.Now()
+	b := newCircuitBreaker(store)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func Test_circuitBreaker_opens(t *testing.T) {
+	store := &stubStore{err: errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")}
+	b, now := newTestBreaker(t, store)
+
+	for i := 0; i < 3; i++ {
+		_, err := b.Query("MATCH (n) RETURN n")
+		assert.EqualError(t, err, store.err.Error())
+	}
+	assert.Equal(t, CircuitOpen, b.state)
+	assert.Equal(t, float64(2), testutil.ToFloat64(circuitStateGauge))
+
+	*now = now.Add(4 * time.Second)
+	_, err := b.Query("MATCH (n) RETURN n")
+	retryAfter, open := IsCircuitOpen(err)
+	assert.True(t, open)
+	assert.Equal(t, 6*time.Second, retryAfter)
+	assert.True(t, IsTransient(err))
+	assert.Equal(t, 3, store.queries, "No queries are sent while the circuit is open.")
+}
+
+// A query timed out by RedisGraph doesn't open the circuit, Redis is reachable but slow.
+func Test_circuitBreaker_queryTimeout(t *testing.T) {
+	store := &stubStore{err: errors.New("Query timed out")}
+	b, _ := newTestBreaker(t, store)
+
+	for i := 0; i < 5; i++ {
+		_, err := b.Query("MATCH (n) RETURN n")
+		assert.EqualError(t, err, store.err.Error())
+	}
+	assert.Equal(t, CircuitClosed, b.state)
+	assert.Equal(t, 0, b.failures)
+	assert.Equal(t, 5, store.queries)
+}
+
+// Dial and network errors open the circuit, like a refused connection.
+func Test_circuitBreaker_networkErrors(t *testing.T) {
+	for _, err := range []error{
+		errors.New("dial tcp 10.0.0.1:6379: i/o timeout"),
+		errors.New("dial tcp: lookup search-redisgraph: no such host"),
+		errors.New("read tcp 10.0.0.2:50000->10.0.0.1:6379: read: connection reset by peer"),
+		errors.New("write tcp 10.0.0.2:50000->10.0.0.1:6379: write: broken pipe"),
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connect: no route to host")},
+	} {
+		b, _ := newTestBreaker(t, &stubStore{err: err})
+		for i := 0; i < 3; i++ {
+			_, _ = b.Query("q")
+		}
+		assert.Equal(t, CircuitOpen, b.state, "The circuit should open after: %s", err)
+	}
+}
+
+// Failures that aren't consecutive don't open the circuit, and errors returned by Redis aren't failures.
+func Test_circuitBreaker_resetsFailures(t *testing.T) {
+	store := &stubStore{err: errors.New("EOF")}
+	b, _ := newTestBreaker(t, store)
+
+	_, _ = b.Query("q")
+	_, _ = b.Query("q")
+	store.err = errors.New("Invalid input")
+	_, _ = b.Query("q")
+	store.err = errors.New("EOF")
+	_, _ = b.Query("q")
+	_, _ = b.Query("q")
+	assert.Equal(t, CircuitClosed, b.state)
+	assert.Equal(t, 2, b.failures)
+}
+
+func Test_circuitBreaker_halfOpen(t *testing.T) {
+	store := &stubStore{err: errors.New("EOF")}
+	b, now := newTestBreaker(t, store)
+	for i := 0; i < 3; i++ {
+		_, _ = b.Query("q")
+	}
+
+	// A failed probe opens the circuit again.
+	*now = now.Add(10 * time.Second)
+	state, _ := b.currentState()
+	assert.Equal(t, CircuitHalfOpen, state)
+	_, err := b.Query("q")
+	assert.EqualError(t, err, "EOF")
+	assert.Equal(t, 4, store.queries)
+	assert.Equal(t, CircuitOpen, b.state)
+
+	// Only one query probes Redis while half-open, a successful probe closes the circuit.
+	*now = now.Add(10 * time.Second)
+	assert.NoError(t, b.allow())
+	_, open := IsCircuitOpen(b.allow())
+	assert.True(t, open)
+	b.record(nil)
+	assert.Equal(t, CircuitClosed, b.state)
+	store.err = nil
+	_, err = b.Query("q")
+	assert.NoError(t, err)
+}
+
+func Test_CircuitBreakerState_disabled(t *testing.T) {
+	previous := storeBreaker
+	storeBreaker = nil
+	defer func() { storeBreaker = previous }()
+
+	state, retryAfter := CircuitBreakerState()
+	assert.Equal(t, CircuitClosed, state)
+	assert.Equal(t, time.Duration(0), retryAfter)
+}
+
+// Chunked operations stop at the open circuit without bisecting or retrying.
+func Test_retrier_circuitOpen(t *testing.T) {
+	setRetries(t, 3, 1)
+	r := newRetrier(context.Background())
+	calls := 0
+	err := r.do(func() error {
+		calls++
+		return CircuitOpenError{RetryAfter: time.Second}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
@@ -11,20 +11,19 @@ irrespective of what has been deposited with the U.S. Copyright Office.
 package dbconnector
 
 import (
-	"fmt"
-	"strings"
+	"context"
 
 	rg2 "github.com/redislabs/redisgraph-go"
 )
 
 // Recursive helper for ChunkedDelete. Takes a single chunk, and recursively attempts to insert that chunk,
 // then the first and second halves of that chunk independently, and so on.
-func chunkedDeleteHelper(uids []string) ChunkedOperationResult {
+func chunkedDeleteHelper(r *retrier, uids []string) ChunkedOperationResult {
 	if len(uids) == 0 {
 		return ChunkedOperationResult{} // No errors, and no SuccessfulResources
 	}
-	_, err := Delete(uids)
-	if IsBadConnection(err) { // this is false if err is nil
+	err := r.doIdempotent(func() error { _, err := Delete(uids); return err })
+	if IsTransient(err) { // this is false if err is nil
 		return ChunkedOperationResult{
 			ConnectionError: err,
 		}
@@ -35,8 +34,8 @@ func chunkedDeleteHelper(uids []string) ChunkedOperationResult {
 				ResourceErrors: map[string]error{uids[0]: err},
 			}
 		} else { // If this is multiple resources, we make a recursive call to find which half had the error.
-			firstHalf := chunkedDeleteHelper(uids[0 : len(uids)/2])
-			secondHalf := chunkedDeleteHelper(uids[len(uids)/2:])
+			firstHalf := chunkedDeleteHelper(r, uids[0:len(uids)/2])
+			secondHalf := chunkedDeleteHelper(r, uids[len(uids)/2:])
 			if firstHalf.ConnectionError != nil || secondHalf.ConnectionError != nil {
 				// Again, if either one has a redis conn issue we just instantly bail
 				return ChunkedOperationResult{
@@ -57,23 +56,14 @@ func chunkedDeleteHelper(uids []string) ChunkedOperationResult {
 }
 
 // Delete the given resources from the graph, does chunking for you and returns errors related to individual resources.
-func ChunkedDelete(resources []string) ChunkedOperationResult {
-	var resourceErrors map[string]error
-	totalSuccessful := 0
-	for i := 0; i < len(resources); i += CHUNK_SIZE {
-		endIndex := min(i+CHUNK_SIZE, len(resources))
-		chunkResult := chunkedDeleteHelper(resources[i:endIndex])
-		if chunkResult.ConnectionError != nil {
-			return chunkResult
-		} else if chunkResult.ResourceErrors != nil {
-			resourceErrors = mergeErrorMaps(resourceErrors, chunkResult.ResourceErrors) // if both are nil, this is nil
-		}
-		totalSuccessful += chunkResult.SuccessfulResources
-	}
-	return ChunkedOperationResult{
-		ResourceErrors:      resourceErrors,
-		SuccessfulResources: totalSuccessful,
-	}
+func ChunkedDelete(ctx context.Context, resources []string) ChunkedOperationResult {
+	// Deletes don't depend on the kind, the UIDs are a single group.
+	r := newRetrier(ctx)
+	ret := runBatches(deleteSizer, []int{len(resources)}, func(_, start, end int) ChunkedOperationResult {
+		return chunkedDeleteHelper(r, resources[start:end])
+	})
+	ret.Retries = r.count()
+	return ret
 }
 
 // Deletes resources with the given UIDs, transparently builds query for you and returns the reponse
@@ -85,21 +75,16 @@ func Delete(uids []string) (*rg2.QueryResult, error) {
 	return resp, err
 }
 
-// This has the error in the returns so that it matches the interface, it isn't used.
-// Thought that was nicer than having 2 interfaces.
+// Returns the query deleting the resources with the given UIDs. The UIDs are a list parameter,
+// matched with IN so the nodes are scanned once for the whole batch.
 func deleteQuery(uids []string) string {
 	if len(uids) == 0 {
 		return ""
 	}
 
-	clauseStrings := []string{} // Build the clauses to filter down to only the ones we want.
-	for _, uid := range uids {
-		clauseStrings = append(clauseStrings, SanitizeQuery("n._uid='%s'", uid))
-	}
-
-	/* #nosec G201 - Input is sanitized above. */
-	queryString := fmt.Sprintf("MATCH (n) WHERE (%s) DELETE n", strings.Join(clauseStrings, " OR "))
-	// e.g. MATCH (n) WHERE (n._uid='uid1' OR n._uid='uid2') DELETE n
+	b := &queryBuilder{}
+	b.write("MATCH (n) WHERE n._uid IN %s DELETE n", b.param(uids))
+	// e.g. CYPHER p0=['uid1', 'uid2'] MATCH (n) WHERE n._uid IN $p0 DELETE n
 
-	return queryString
+	return b.String()
 }
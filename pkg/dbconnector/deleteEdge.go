@@ -11,24 +11,23 @@ irrespective of what has been deposited with the U.S. Copyright Office.
 package dbconnector
 
 import (
+	"context"
 	"fmt"
-	"strings"
 
 	"github.com/golang/glog"
 	rg2 "github.com/redislabs/redisgraph-go"
 )
 
-var deletedEdgeCount int
-
 // Recursive helper for DeleteEdge. Takes a single chunk, and recursively attempts to delete that chunk, then the first
 // and second halves of that chunk independently, and so on.
-func chunkedDeleteEdgeHelper(resources []Edge) ChunkedOperationResult {
+func chunkedDeleteEdgeHelper(r *retrier, resources []Edge) ChunkedOperationResult {
 	if len(resources) == 0 {
 		return ChunkedOperationResult{} // No errors, and no SuccessfulResources
 	}
 	// We currently ignore encoding errors as they are always recoverable, may change in the future.
-	resp, err := DeleteEdge(resources)
-	if IsBadConnection(err) { // this is false if err is nil
+	var resp *rg2.QueryResult
+	err := r.doIdempotent(func() (err error) { resp, err = DeleteEdge(resources); return err })
+	if IsTransient(err) { // this is false if err is nil
 		return ChunkedOperationResult{
 			ConnectionError: err,
 		}
@@ -40,8 +39,8 @@ func chunkedDeleteEdgeHelper(resources []Edge) ChunkedOperationResult {
 				ResourceErrors: map[string]error{uid: err},
 			}
 		} else { // If this is multiple resources, we make a recursive call to find which half had the error.
-			firstHalf := chunkedDeleteEdgeHelper(resources[0 : len(resources)/2])
-			secondHalf := chunkedDeleteEdgeHelper(resources[len(resources)/2:])
+			firstHalf := chunkedDeleteEdgeHelper(r, resources[0:len(resources)/2])
+			secondHalf := chunkedDeleteEdgeHelper(r, resources[len(resources)/2:])
 			if firstHalf.ConnectionError != nil || secondHalf.ConnectionError != nil {
 				// Again, if either one has a redis conn issue we just instantly bail
 				return ChunkedOperationResult{
@@ -64,29 +63,24 @@ func chunkedDeleteEdgeHelper(resources []Edge) ChunkedOperationResult {
 }
 
 // Updates the given resources in the graph, does chunking for you and returns errors related to individual edges.
-func ChunkedDeleteEdge(resources []Edge, clusterName string) ChunkedOperationResult {
+func ChunkedDeleteEdge(ctx context.Context, resources []Edge, clusterName string) ChunkedOperationResult {
 	glog.V(4).Info("For cluster ", clusterName, ": Number of edges received in ChunkedDeleteEdge: ", len(resources))
-	deletedEdgeCount = 0
-	var resourceErrors map[string]error
-	totalSuccessful := 0
-	for i := 0; i < len(resources); i += CHUNK_SIZE {
-		endIndex := min(i+CHUNK_SIZE, len(resources))
-		chunkResult := chunkedDeleteEdgeHelper(resources[i:endIndex])
-		if chunkResult.ConnectionError != nil {
-			return chunkResult
-		} else if chunkResult.ResourceErrors != nil {
-			// if both are nil, this is still nil.
-			resourceErrors = mergeErrorMaps(resourceErrors, chunkResult.ResourceErrors)
-		}
-		totalSuccessful += chunkResult.SuccessfulResources
-		deletedEdgeCount += chunkResult.EdgesDeleted
-	}
-	glog.V(4).Info("ChunkedDeleteEdge: For cluster, ", clusterName, ": Number of edges deleted: ", deletedEdgeCount)
-	return ChunkedOperationResult{
-		ResourceErrors:      resourceErrors,
-		SuccessfulResources: totalSuccessful,
-		EdgesDeleted:        deletedEdgeCount,
+	resources, resourceErrors := validateEdges(resources, func(edge Edge) string {
+		return fmt.Sprintf("(%s)-[:%s]->(%s)", edge.SourceUID, edge.EdgeType, edge.DestUID)
+	})
+	groups := groupEdges(resources)
+	r := newRetrier(ctx)
+	ret := runBatches(deleteEdgeSizer, edgeGroupSizes(groups), func(group, start, end int) ChunkedOperationResult {
+		return chunkedDeleteEdgeHelper(r, groups[group][start:end])
+	})
+	ret.Retries = r.count()
+	if ret.ConnectionError != nil {
+		return ret
 	}
+	// if both are nil, this is still nil.
+	ret.ResourceErrors = mergeErrorMaps(resourceErrors, ret.ResourceErrors)
+	glog.V(4).Info("ChunkedDeleteEdge: For cluster, ", clusterName, ": Number of edges deleted: ", ret.EdgesDeleted)
+	return ret
 }
 
 // Returns the result, any errors when encoding, and any error from the query itself.
@@ -103,31 +97,23 @@ func DeleteEdge(edges []Edge) (*rg2.QueryResult, error) {
 	return resp, err
 }
 
-// Returns a query used to delete an edge between 2 existing nodes.
-// e.g. MATCH (s {_uid: 'abc'})-[e:Type]->(d {_uid: 'def'}) DELETE e
+// Returns a query used to delete edges with the same type and kinds, see groupEdges.
+// e.g. CYPHER p0=[{d: 'def', s: 'abc'}] UNWIND $p0 AS r MATCH (s:Pod {_uid: r.s})-[e:Type]->(d:Node {_uid: r.d})
+// DELETE e
 func deleteEdgeQuery(edges []Edge) string {
 	if len(edges) == 0 {
 		return ""
 	}
 
-	matchStrings := []string{}  // Build the MATCH portion
-	deleteStrings := []string{} // Build the DELETE portion. Declared at the same time so that we do this in one pass.
-	for i, edge := range edges {
-		// e.g. MATCH (s {_uid: 'abc'})-[e:Type]->(d {_uid: 'def'})
-		if edge.SourceKind != "" && edge.DestKind != "" {
-			matchStrings = append(matchStrings,
-				SanitizeQuery("(s%d:%[5]s {_uid: '%[2]s'})-[e%[1]d:%[3]s]->(d%[1]d:%[6]s {_uid: '%[4]s'})",
-					i, edge.SourceUID, edge.EdgeType, edge.DestUID, edge.SourceKind, edge.DestKind))
-		} else {
-			matchStrings = append(matchStrings,
-				SanitizeQuery("(s%d {_uid: '%[2]s'})-[e%[1]d:%[3]s]->(d%[1]d {_uid: '%[4]s'})",
-					i, edge.SourceUID, edge.EdgeType, edge.DestUID))
-		}
-		deleteStrings = append(deleteStrings, fmt.Sprintf("e%d", i)) // e.g. e0
+	rows := make([]interface{}, 0, len(edges))
+	for _, edge := range edges {
+		rows = append(rows, map[string]interface{}{"s": edge.SourceUID, "d": edge.DestUID})
 	}
-
-	/* #nosec G201 - Input is sanitized above. */
-	queryString := fmt.Sprintf("MATCH %s DELETE %s", strings.Join(matchStrings, ", "), strings.Join(deleteStrings, ", "))
+	sourceLabel, destLabel := edgeLabels(edges[0])
+	b := &queryBuilder{}
+	b.write("UNWIND %s AS r MATCH (s%s {_uid: r.s})-[e:%s]->(d%s {_uid: r.d}) DELETE e",
+		b.param(rows), sourceLabel, edges[0].EdgeType, destLabel)
+	queryString := b.String()
 
 	return queryString
 }
@@ -3,6 +3,7 @@
 package dbconnector
 
 import (
+	"context"
 	"testing"
 
 	assert "github.com/stretchr/testify/assert"
@@ -11,39 +12,57 @@ import (
 var clusterName string = "testCluster"
 
 func deleteQueryCheck(q string) bool {
-	delMultipleQuery := "MATCH (s0 {_uid: 'srcUID1'})-[e0:edgeType1]->(d0 {_uid: 'destUID1'}), (s1:srcKind1 {_uid: 'srcUID1'})-[e1:edgeType1]->(d1:destKind2 {_uid: 'destUID2'}), (s2:srcKind1 {_uid: 'srcUID1'})-[e2:edgeType2]->(d2:destKind3 {_uid: 'destUID3'}) DELETE e0, e1, e2"
-	delSingleQuery := "MATCH (s0:srcKind1 {_uid: 'srcUID1'})-[e0:edgeType1]->(d0:destKind1 {_uid: 'destUID1'}) DELETE e0"
-	delChunkedInCaseOfErrorQuery := "MATCH (s0:srcKind1 {_uid: 'srcUID1'})-[e0:edgeType1]->(d0:destKind2 {_uid: 'destUID2'}) DELETE e0"
-
-	if q == delMultipleQuery || q == delSingleQuery || q == delChunkedInCaseOfErrorQuery {
-		return true
+	queries := []string{
+		"CYPHER p0=[{d: 'destUID1', s: 'srcUID1'}] " +
+			"UNWIND $p0 AS r MATCH (s {_uid: r.s})-[e:edgeType1]->(d {_uid: r.d}) DELETE e",
+		"CYPHER p0=[{d: 'destUID2', s: 'srcUID1'}] " +
+			"UNWIND $p0 AS r MATCH (s:srcKind1 {_uid: r.s})-[e:edgeType1]->(d:destKind2 {_uid: r.d}) DELETE e",
+		"CYPHER p0=[{d: 'destUID3', s: 'srcUID1'}] " +
+			"UNWIND $p0 AS r MATCH (s:srcKind1 {_uid: r.s})-[e:edgeType2]->(d:destKind3 {_uid: r.d}) DELETE e",
+		"CYPHER p0=[{d: 'destUID1', s: 'srcUID1'}] " +
+			"UNWIND $p0 AS r MATCH (s:srcKind1 {_uid: r.s})-[e:edgeType1]->(d:destKind1 {_uid: r.d}) DELETE e",
+	}
+	for _, query := range queries {
+		if query == q {
+			return true
+		}
 	}
 	return false
 }
+
 func TestChunkedDeleteEdge(t *testing.T) {
-	chunkedOpRes := ChunkedDeleteEdge(initTestEdges(), clusterName)
+	chunkedOpRes := ChunkedDeleteEdge(context.Background(), initTestEdges(), clusterName)
 	t.Logf("%+v\n", chunkedOpRes)
 	assert.Equal(t, 0, len(chunkedOpRes.ResourceErrors))
 	assert.Equal(t, 3, chunkedOpRes.SuccessfulResources)
 }
 
 func TestChunkedDeleteSingleEdge(t *testing.T) {
-	chunkedOpRes := ChunkedDeleteEdge(initTestSingleEdge(), clusterName)
+	chunkedOpRes := ChunkedDeleteEdge(context.Background(), initTestSingleEdge(), clusterName)
 	t.Logf("%+v\n", chunkedOpRes)
 	assert.Equal(t, 0, len(chunkedOpRes.ResourceErrors))
 	assert.Equal(t, 1, chunkedOpRes.SuccessfulResources)
 }
 
 func TestChunkedDeleteSingleErrorEdge(t *testing.T) {
-	chunkedOpRes := ChunkedDeleteEdge(initTestSingleErrorEdge(), clusterName)
+	chunkedOpRes := ChunkedDeleteEdge(context.Background(), initTestSingleErrorEdge(), clusterName)
 	t.Logf("%+v\n", chunkedOpRes)
 	assert.Equal(t, 1, len(chunkedOpRes.ResourceErrors))
 	assert.Equal(t, 0, chunkedOpRes.SuccessfulResources)
 }
 
 func TestChunkedDeleteErrorEdges(t *testing.T) {
-	chunkedOpRes := ChunkedDeleteEdge(initTestErrorEdges(), clusterName)
+	chunkedOpRes := ChunkedDeleteEdge(context.Background(), initTestErrorEdges(), clusterName)
 	t.Logf("%+v\n", chunkedOpRes)
 	assert.Equal(t, 1, len(chunkedOpRes.ResourceErrors))
 	assert.Equal(t, 2, chunkedOpRes.SuccessfulResources)
 }
+
+// A batch with an error is split until the edge with the error is found.
+func TestChunkedDeleteEdgeBisection(t *testing.T) {
+	edges := append(initTestSingleEdge(), initTestSingleErrorEdge()...)
+	chunkedOpRes := ChunkedDeleteEdge(context.Background(), edges, clusterName)
+	assert.Equal(t, 1, len(chunkedOpRes.ResourceErrors))
+	assert.Error(t, chunkedOpRes.ResourceErrors["()-[:edgeType1]->(destUID1)"])
+	assert.Equal(t, 1, chunkedOpRes.SuccessfulResources)
+}
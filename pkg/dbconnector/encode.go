@@ -56,7 +56,7 @@ func (r Resource) EncodeProperties() (map[string]interface{}, error) {
 }
 
 // Outputs all the redisgraph properties that come out of a given property on a resource.
-// Outputs exclusively in our supported types: string, []string, map[string]string, and int64 and []interface.
+// Outputs exclusively in our supported types: string, int64 and []interface{} of strings.
 func encodeProperty(key string, value interface{}) (map[string]interface{}, error) {
 
 	// Sanitize value
@@ -69,40 +69,33 @@ func encodeProperty(key string, value interface{}) (map[string]interface{}, erro
 	// Switch over all the default json.Unmarshal types. These are the only possible types that could be in the map.
 	// For each, we go through and convert to what we want them to be.
 	// Useful doc regarding default types: https://golang.org/pkg/encoding/json/#Unmarshal
+	// Values aren't escaped here, the queries pass them as parameters.
 	switch typedVal := value.(type) {
 	case string:
 		if key == "kind" { // we lowercase the kind.
-			res[key] = strings.ToLower(sanitizeValue(typedVal))
+			res[key] = strings.ToLower(typedVal)
 		} else {
-			res[key] = sanitizeValue(typedVal)
+			res[key] = typedVal
 		}
 
 	case []interface{}:
 		// RedisGraph 2.2 supports a list of properties.
-		// we are encoding as a list of values with individually quoted strings
+		// we are encoding as a list of strings
 		elementStrings := make([]string, 0, len(typedVal))
 		for _, e := range typedVal {
-			elementString := fmt.Sprintf("'%v'", sanitizeValue(fmt.Sprintf("%v", e)))
-			elementStrings = append(elementStrings, elementString)
+			elementStrings = append(elementStrings, fmt.Sprintf("%v", e))
 		}
-		sort.Strings(elementStrings)                       // Sorting to make comparisons more predictable
-		sanitizedStr := strings.Join(elementStrings, ", ") // e.g. 'val1', 'val2', 'val3'
-		tmpInterface := make([]interface{}, 1)             //store the value as list to allow partial matching
-		tmpInterface[0] = sanitizedStr
-		res[key] = tmpInterface
+		sort.Strings(elementStrings) // Sorting to make comparisons more predictable
+		res[key] = stringsToList(elementStrings)
 
 	case map[string]interface{}:
 		if key == "label" || key == "addon" {
 			labelStrings := make([]string, 0, len(typedVal))
 			for key, value := range typedVal {
-				labelString := fmt.Sprintf("'%v=%v'", sanitizeValue(key), sanitizeValue(fmt.Sprintf("%v", value)))
-				labelStrings = append(labelStrings, labelString)
+				labelStrings = append(labelStrings, fmt.Sprintf("%v=%v", key, value))
 			}
-			sort.Strings(labelStrings)                       // Sorting to make comparisons more predictable
-			sanitizedStr := strings.Join(labelStrings, ", ") // e.g. 'key1=val1', 'key2=val2', 'key3=val3'
-			tmpInterface := make([]interface{}, 1)           //store the value as list to allow partial matching
-			tmpInterface[0] = sanitizedStr
-			res[key] = tmpInterface
+			sort.Strings(labelStrings)             // Sorting to make comparisons more predictable
+			res[key] = stringsToList(labelStrings) // e.g. ['key1=val1', 'key2=val2'], to allow partial matching
 		}
 
 	case int64:
@@ -125,3 +118,12 @@ func encodeProperty(key string, value interface{}) (map[string]interface{}, erro
 
 	return res, nil
 }
+
+// Converts to the list type used for properties.
+func stringsToList(values []string) []interface{} {
+	list := make([]interface{}, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+	return list
+}
@@ -66,29 +66,29 @@ func Test_encodeProperty(t *testing.T) {
 	assert.Equal(t, nil, error2)
 
 	result3, error3 := encodeProperty("someKey", "some'Value")
-	assert.Equal(t, "some\\'Value", result3["someKey"], "Should sanitize string values with single quotes")
+	assert.Equal(t, "some'Value", result3["someKey"], "Should not escape single quotes, values are query parameters")
 	assert.Equal(t, nil, error3)
 
 	result4, error4 := encodeProperty("someKey", "some\"Value")
-	assert.Equal(t, "some\\\"Value", result4["someKey"], "Should sanitize string values with double quotes")
+	assert.Equal(t, "some\"Value", result4["someKey"], "Should not escape double quotes, values are query parameters")
 	assert.Equal(t, nil, error4)
 
 	// case []interface{}
 	list := make([]interface{}, 2)
-	list[0] = "value1"
-	list[1] = "value2"
-	expectedList := []interface{}{"'value1', 'value2'"}
+	list[0] = "value2"
+	list[1] = "value1"
+	expectedList := []interface{}{"value1", "value2"}
 	result5, error5 := encodeProperty("list", list)
-	assert.Equal(t, expectedList, result5["list"], "Should encode array into a single list.")
+	assert.Equal(t, expectedList, result5["list"], "Should encode array into a sorted list of strings.")
 	assert.Equal(t, nil, error5)
 
 	// case map[string]interfce{}
 	mapValue := make(map[string]interface{})
 	mapValue["key1"] = "value1"
 	mapValue["key2"] = "value2"
-	expectedList = []interface{}{"'key1=value1', 'key2=value2'"}
+	expectedList = []interface{}{"key1=value1", "key2=value2"}
 	result6, error6 := encodeProperty("label", mapValue)
-	assert.Equal(t, expectedList, result6["label"], "Should encode labels map into a single list.")
+	assert.Equal(t, expectedList, result6["label"], "Should encode labels map into a sorted list of key=value.")
 	assert.Equal(t, nil, error6)
 
 	// case int64
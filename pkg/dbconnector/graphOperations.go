@@ -16,8 +16,6 @@ import (
 	rg2 "github.com/redislabs/redisgraph-go"
 )
 
-const CHUNK_SIZE = 40 // Used for the chunked operations in other files.
-
 // Resource - Describes a resource (node)
 type Resource struct {
 	Kind           string `json:"kind,omitempty"`
@@ -40,6 +38,7 @@ type ChunkedOperationResult struct {
 	SuccessfulResources int              // Number that were successfully completed
 	EdgesAdded          int
 	EdgesDeleted        int
+	Retries             int // Number of queries retried after transient errors
 }
 
 // Deletes all resources for given cluster
@@ -72,6 +71,11 @@ func TotalIntraEdges(clusterName string) (*rg2.QueryResult, error) {
 	return resp, err
 }
 
+// Returns a result set with the number of Cluster nodes.
+func TotalClusters() (*rg2.QueryResult, error) {
+	return Store.Query("MATCH (c:Cluster) RETURN count(c)")
+}
+
 func MergeDummyCluster(name string) (*rg2.QueryResult, error) {
 	kubeVersion := ""
 	discoveryClient := config.GetDiscoveryClient()
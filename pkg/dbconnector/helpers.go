@@ -10,6 +10,9 @@ The source code for this program is not published or otherwise divested of its t
 package dbconnector
 
 import (
+	"errors"
+	"net"
+	"sort"
 	"strings"
 
 	rg2 "github.com/redislabs/redisgraph-go"
@@ -39,6 +42,16 @@ func min(a, b int) int {
 	return b
 }
 
+// Returns the keys of the properties sorted, so the queries built from them have the same shape.
+func sortedKeys(props map[string]interface{}) []string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // Tells whether the error in question is representative of the redis connection dying.
 // It gives EOF when it's cut off mid usage, otherwise does connection refused.
 func IsBadConnection(e error) bool {
@@ -48,6 +61,55 @@ func IsBadConnection(e error) bool {
 	return strings.HasSuffix(e.Error(), "connection refused") || strings.HasSuffix(e.Error(), "EOF")
 }
 
+// Tells whether Redis couldn't be reached or the connection broke: the dial failed or timed out, the connection
+// was refused, reset or cut off, or another network error. A RedisGraph "Query timed out" reply isn't one, Redis
+// responded.
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	message := err.Error()
+	for _, networkError := range []string{"i/o timeout", "connection reset", "broken pipe", "no route to host",
+		"no such host"} {
+		if strings.Contains(message, networkError) {
+			return true
+		}
+	}
+	return IsBadConnection(err) || strings.HasPrefix(message, "dial ")
+}
+
+// Tells whether the error is transient and the query can be retried: Redis couldn't be reached or the connection
+// broke, the query timed out, the node became a read-only replica after a failover, or the circuit breaker is
+// open.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, open := IsCircuitOpen(err); open {
+		return true
+	}
+	return isConnectionError(err) || strings.Contains(strings.ToLower(err.Error()), "timed out") ||
+		strings.HasPrefix(err.Error(), "READONLY")
+}
+
+// Tells whether the query failed before Redis ran it, so it can be retried even if it isn't idempotent: the
+// connection couldn't be opened, the node is a read-only replica, or the circuit breaker is open. An EOF or a
+// timeout can come after Redis applied the query, retrying it would insert the resources twice.
+func isUnsent(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, open := IsCircuitOpen(err); open {
+		return true
+	}
+	return strings.HasPrefix(err.Error(), "dial ") || strings.HasSuffix(err.Error(), "connection refused") ||
+		strings.HasPrefix(err.Error(), "READONLY")
+}
+
 // Test for specific redis graph update error
 func IsGraphMissing(err error) bool {
 	if err == nil {
@@ -0,0 +1,92 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Labels, relationship types and property keys can't be query parameters, they are written into the query text.
+// Only identifiers matching this pattern are accepted from the collectors.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+
+// Checks that a label, relationship type or property key is safe to write into a query.
+func validateIdentifier(what, name string) error {
+	if !identifierPattern.MatchString(name) {
+		return fmt.Errorf("invalid %s %q: must start with a letter or _, contain only letters, digits and _, "+
+			"and have at most 128 characters", what, name)
+	}
+	return nil
+}
+
+// Checks the kind, used as the node label, and the property keys of a resource.
+func (r *Resource) validateIdentifiers() error {
+	kind, ok := r.Properties["kind"].(string)
+	if !ok {
+		return errors.New("property kind must be a string")
+	}
+	if err := validateIdentifier("kind", kind); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(r.Properties) {
+		if err := validateIdentifier("property key", key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks the relationship type and the kinds of the source and destination, which are optional.
+func (e Edge) validateIdentifiers() error {
+	if err := validateIdentifier("edge type", e.EdgeType); err != nil {
+		return err
+	}
+	for _, kind := range []string{e.SourceKind, e.DestKind} {
+		if kind == "" {
+			continue
+		}
+		if err := validateIdentifier("kind", kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the resources with valid identifiers, and the errors of the rejected resources keyed by UID.
+// The errors are nil if all the resources are valid.
+func validateResources(resources []*Resource) ([]*Resource, map[string]error) {
+	var rejected map[string]error
+	valid := make([]*Resource, 0, len(resources))
+	for _, resource := range resources {
+		if err := resource.validateIdentifiers(); err != nil {
+			if rejected == nil {
+				rejected = make(map[string]error)
+			}
+			rejected[resource.UID] = err
+			continue
+		}
+		valid = append(valid, resource)
+	}
+	return valid, rejected
+}
+
+// Returns the edges with valid identifiers, and the errors of the rejected edges keyed by errorKey(edge).
+// The errors are nil if all the edges are valid.
+func validateEdges(edges []Edge, errorKey func(Edge) string) ([]Edge, map[string]error) {
+	var rejected map[string]error
+	valid := make([]Edge, 0, len(edges))
+	for _, edge := range edges {
+		if err := edge.validateIdentifiers(); err != nil {
+			if rejected == nil {
+				rejected = make(map[string]error)
+			}
+			rejected[errorKey(edge)] = err
+			continue
+		}
+		valid = append(valid, edge)
+	}
+	return valid, rejected
+}
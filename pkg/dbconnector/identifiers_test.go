@@ -0,0 +1,88 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stolostron/search-aggregator/pkg/dbconnector/memgraph"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_validateIdentifier(t *testing.T) {
+	for _, valid := range []string{"Pod", "_uid", "ownedBy", "apigroup", "label2", strings.Repeat("a", 128)} {
+		assert.NoError(t, validateIdentifier("label", valid), valid)
+	}
+	for _, invalid := range []string{"", "2pods", "Pod)-[:x]->(", "n.x", "a b", "a`b", "kind:Pod", "café",
+		strings.Repeat("a", 129)} {
+		assert.Error(t, validateIdentifier("label", invalid), invalid)
+	}
+}
+
+func Test_Resource_validateIdentifiers(t *testing.T) {
+	valid := &Resource{UID: "u1", Properties: map[string]interface{}{"kind": "Pod", "name": "a b'c"}}
+	assert.NoError(t, valid.validateIdentifiers(), "Values aren't identifiers, they are query parameters.")
+
+	notString := &Resource{UID: "u1", Properties: map[string]interface{}{"kind": 5}}
+	assert.EqualError(t, notString.validateIdentifiers(), "property kind must be a string")
+
+	badKind := &Resource{UID: "u1", Properties: map[string]interface{}{"kind": "Pod {x: 1}) DETACH DELETE (m"}}
+	assert.Error(t, badKind.validateIdentifiers())
+
+	badKey := &Resource{UID: "u1", Properties: map[string]interface{}{"kind": "Pod", "x=1 SET n.y": "v"}}
+	assert.Error(t, badKey.validateIdentifiers())
+}
+
+func Test_Edge_validateIdentifiers(t *testing.T) {
+	assert.NoError(t, Edge{EdgeType: "ownedBy"}.validateIdentifiers(), "Kinds are optional.")
+	assert.NoError(t, Edge{EdgeType: "ownedBy", SourceKind: "Pod", DestKind: "Deployment"}.validateIdentifiers())
+	assert.Error(t, Edge{EdgeType: ""}.validateIdentifiers())
+	assert.Error(t, Edge{EdgeType: "x]->(d) DELETE d //"}.validateIdentifiers())
+	assert.Error(t, Edge{EdgeType: "ownedBy", DestKind: "Deployment {"}.validateIdentifiers())
+}
+
+// Resources and edges with invalid identifiers are reported, the others are still written.
+func Test_ChunkedOperations_invalidIdentifiers(t *testing.T) {
+	previousStore := Store
+	Store = memgraph.New()
+	defer func() { Store = previousStore }()
+
+	_, err := MergeDummyCluster("c1")
+	assert.NoError(t, err)
+	insertResult := ChunkedInsert(context.Background(), []*Resource{
+		{Kind: "Pod", UID: "c1/pod1", Properties: map[string]interface{}{"kind": "Pod", "name": "pod1"}},
+		{Kind: "Pod", UID: "c1/bad1", Properties: map[string]interface{}{"kind": "Pod", "a})-[:x]->(b": "v"}},
+		{Kind: "x", UID: "c1/bad2", Properties: map[string]interface{}{"kind": "Pod) DETACH DELETE (m"}},
+		{Kind: "x", UID: "c1/bad3", Properties: map[string]interface{}{"kind": 5}},
+	}, "c1")
+	assert.NoError(t, insertResult.ConnectionError)
+	assert.Equal(t, 1, insertResult.SuccessfulResources)
+	assert.Len(t, insertResult.ResourceErrors, 3)
+	for _, uid := range []string{"c1/bad1", "c1/bad2", "c1/bad3"} {
+		assert.Error(t, insertResult.ResourceErrors[uid], uid)
+	}
+
+	updateResult := ChunkedUpdate(context.Background(), []*Resource{
+		{Kind: "Pod", UID: "c1/pod1", Properties: map[string]interface{}{"kind": "Pod", "n.name": "x"}},
+	})
+	assert.Equal(t, 0, updateResult.SuccessfulResources)
+	assert.Error(t, updateResult.ResourceErrors["c1/pod1"])
+
+	edgeResult := ChunkedInsertEdge(context.Background(), []Edge{
+		{SourceUID: "c1/pod1", DestUID: "c1/pod1", EdgeType: "x]->(d) DELETE d //"},
+	}, "c1")
+	assert.Equal(t, 0, edgeResult.EdgesAdded)
+	assert.Error(t, edgeResult.ResourceErrors["c1/pod1"])
+
+	deleteEdgeResult := ChunkedDeleteEdge(context.Background(), []Edge{{SourceUID: "c1/pod1", DestUID: "c1/pod1", EdgeType: "a b"}}, "c1")
+	assert.Error(t, deleteEdgeResult.ResourceErrors["(c1/pod1)-[:a b]->(c1/pod1)"])
+
+	result, err := Store.Query("MATCH (n:Pod) RETURN n._uid, n.name")
+	assert.NoError(t, err)
+	assert.True(t, result.Next())
+	assert.Equal(t, []interface{}{"c1/pod1", "pod1"}, result.Record().Values())
+	assert.False(t, result.Next())
+}
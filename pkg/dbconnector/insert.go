@@ -10,8 +10,8 @@ Copyright (c) 2020 Red Hat, Inc.
 package dbconnector
 
 import (
+	"context"
 	"fmt"
-	"strings"
 	"sync"
 
 	"github.com/golang/glog"
@@ -20,14 +20,15 @@ import (
 
 // Recursive helper for ChunkedInsert. Takes a single chunk, and recursively attempts to insert that chunk,
 // then the first and second halves of that chunk independently, and so on.
-func chunkedInsertHelper(resources []*Resource, clusterName string) ChunkedOperationResult {
+func chunkedInsertHelper(r *retrier, resources []*Resource, clusterName string) ChunkedOperationResult {
 
 	if len(resources) == 0 {
 		return ChunkedOperationResult{} // No errors, and no SuccessfulResources
 	}
 
-	_, _, err := Insert(resources, clusterName) // We ignore encoding errors as they are always recoverable.
-	if IsBadConnection(err) {                   // this is false if err is nil
+	// We ignore encoding errors as they are always recoverable.
+	err := r.do(func() error { _, _, err := Insert(resources, clusterName); return err })
+	if IsTransient(err) { // this is false if err is nil
 		return ChunkedOperationResult{
 			ConnectionError: err,
 		}
@@ -40,8 +41,8 @@ func chunkedInsertHelper(resources []*Resource, clusterName string) ChunkedOpera
 				ResourceErrors: map[string]error{resources[0].UID: err},
 			}
 		} else { // If this is multiple resources, we make a recursive call to find which half had the error.
-			firstHalf := chunkedInsertHelper(resources[0:len(resources)/2], clusterName)
-			secondHalf := chunkedInsertHelper(resources[len(resources)/2:], clusterName)
+			firstHalf := chunkedInsertHelper(r, resources[0:len(resources)/2], clusterName)
+			secondHalf := chunkedInsertHelper(r, resources[len(resources)/2:], clusterName)
 			if firstHalf.ConnectionError != nil || secondHalf.ConnectionError != nil {
 				// Again, if either one has a redis conn issue we just instantly bail
 				return ChunkedOperationResult{
@@ -62,9 +63,8 @@ func chunkedInsertHelper(resources []*Resource, clusterName string) ChunkedOpera
 }
 
 // Insert the given resources into the graph, does chunking for you and returns errors related to individual resources.
-func ChunkedInsert(resources []*Resource, clusterName string) ChunkedOperationResult {
-	var resourceErrors map[string]error
-	totalSuccessful := 0
+func ChunkedInsert(ctx context.Context, resources []*Resource, clusterName string) ChunkedOperationResult {
+	resources, resourceErrors := validateResources(resources)
 	var ExistingIndexMapMutex = sync.RWMutex{}
 
 	kindMap := make(map[string]struct{})
@@ -72,20 +72,16 @@ func ChunkedInsert(resources []*Resource, clusterName string) ChunkedOperationRe
 		kindMap[res.Properties["kind"].(string)] = struct{}{}
 	}
 
-	for i := 0; i < len(resources); i += CHUNK_SIZE {
-		endIndex := min(i+CHUNK_SIZE, len(resources))
-		chunkResult := chunkedInsertHelper(resources[i:endIndex], clusterName)
-		if chunkResult.ConnectionError != nil {
-			return chunkResult
-		} else if chunkResult.ResourceErrors != nil {
-			resourceErrors = mergeErrorMaps(resourceErrors, chunkResult.ResourceErrors) // if both are nil, this is nil
-		}
-		totalSuccessful += chunkResult.SuccessfulResources
-	}
-	ret := ChunkedOperationResult{
-		ResourceErrors:      resourceErrors,
-		SuccessfulResources: totalSuccessful,
+	groups := groupResources(resources)
+	r := newRetrier(ctx)
+	ret := runBatches(insertSizer, resourceGroupSizes(groups), func(group, start, end int) ChunkedOperationResult {
+		return chunkedInsertHelper(r, groups[group][start:end], clusterName)
+	})
+	ret.Retries = r.count()
+	if ret.ConnectionError != nil {
+		return ret
 	}
+	ret.ResourceErrors = mergeErrorMaps(resourceErrors, ret.ResourceErrors) // if both are nil, this is nil
 	for kind := range kindMap {
 		ExistingIndexMapMutex.RLock()
 		exists := ExistingIndexMap[kind]
@@ -111,7 +107,9 @@ func Insert(resources []*Resource, clusterName string) (*rg2.QueryResult, map[st
 	return resp, encodingErrors, err
 }
 
-// Given a set of Resources, returns Query for inserting them into redisgraph.
+// Given a set of Resources of the same kind, returns Query for inserting them into redisgraph.
+// The resources are sent as a list parameter and created by a single UNWIND, properties a resource doesn't have
+// are null and aren't stored.
 func insertQuery(resources []*Resource, clusterName string) (string, map[string]error) {
 
 	if len(resources) == 0 {
@@ -119,9 +117,15 @@ func insertQuery(resources []*Resource, clusterName string) (string, map[string]
 	}
 
 	encodingErrors := make(map[string]error)
-
-	resourceStrings := []string{} // Build the query string piece by piece.
+	kind := resources[0].Properties["kind"]
+	rows := make([]interface{}, 0, len(resources))
+	keys := make(map[string]interface{}) // All the property keys in the batch.
 	for _, resource := range resources {
+		if resource.Properties["kind"] != kind {
+			encodingErrors[resource.UID] = fmt.Errorf("kind %v doesn't match the kind of the batch %v",
+				resource.Properties["kind"], kind)
+			continue
+		}
 		resource.addRbacProperty()
 		encodedProps, err := resource.EncodeProperties()
 		if err != nil {
@@ -129,37 +133,34 @@ func insertQuery(resources []*Resource, clusterName string) (string, map[string]
 			encodingErrors[resource.UID] = err
 			continue
 		}
-		propStrings := []string{}
-		for k, v := range encodedProps {
-			switch typed := v.(type) { // This is either string or int64 with base type string or []interface
-			//Need to wrap in quotes if it's string
-			case int64:
-				propStrings = append(propStrings, fmt.Sprintf("%s:%d", k, typed)) // e.g. key>:<value>
-			case []interface{}, map[string]interface{}: // Values are individually quoted already in encodeProperty
-				propStrings = append(propStrings, fmt.Sprintf("%s:%s", k, typed)) // e.g. <key>:<value>
-			default:
-				propStrings = append(propStrings, fmt.Sprintf("%s:'%s'", k, typed)) // e.g. <key>:'<value>'
-			}
-		}
-		// e.g. (:Pod {_uid: 'abc123', prop1:5, prop2:'cheese'})
-		resource := fmt.Sprintf("(:%s {_uid:'%s', %s})",
-			resource.Properties["kind"], resource.UID, strings.Join(propStrings, ", "))
-
-		// if a clusterName was passed in then we should connect the resource to the cluster node
-		if clusterName != "" {
-			resource += "-[:inCluster {_interCluster: true}]->(c)"
+		for k := range encodedProps {
+			keys[k] = nil
 		}
-
-		resourceStrings = append(resourceStrings, resource)
+		encodedProps["_uid"] = resource.UID
+		rows = append(rows, encodedProps)
 	}
-
-	// e.g. CREATE (:Pod {_uid: 'abc123', prop1:5, prop2:'cheese'}), (:Pod {_uid: 'def456', prop1:4, prop2:'water'})
-	queryString := fmt.Sprintf("%s %s", "CREATE", strings.Join(resourceStrings, ", "))
+	delete(keys, "_uid")
 
 	// need to match the cluster node so we can reference it
+	b := &queryBuilder{}
 	if clusterName != "" {
-		queryString = SanitizeQuery("MATCH (c:Cluster {name: '%s'})", clusterName) + queryString
+		b.write("MATCH (c:Cluster {name: %s}) ", b.param(clusterName))
 	}
+	// e.g. UNWIND $p1 AS r CREATE (:Pod {_uid: r._uid, prop1: r.prop1, prop2: r.prop2})
+	b.write("UNWIND %s AS r CREATE (:%s {_uid: r._uid", b.param(rows), kind)
+	for _, k := range sortedKeys(keys) {
+		b.write(", %s: r.%[1]s", k)
+	}
+	b.write("})")
+
+	// if a clusterName was passed in then we should connect the resource to the cluster node
+	if clusterName != "" {
+		b.write("-[:inCluster {_interCluster: true}]->(c)")
+	}
+
+	// e.g. CYPHER p0='cluster1' p1=[{_uid: 'abc123', prop1: 5}] MATCH (c:Cluster {name: $p0})
+	// UNWIND $p1 AS r CREATE (:Pod {_uid: r._uid, prop1: r.prop1})-[:inCluster {_interCluster: true}]->(c)
+	queryString := b.String()
 
 	return queryString, encodingErrors
 }
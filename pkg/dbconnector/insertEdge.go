@@ -11,105 +11,78 @@ Copyright (c) 2020 Red Hat, Inc.
 package dbconnector
 
 import (
-	"fmt"
-	"sort"
-	"strings"
+	"context"
 
 	"github.com/golang/glog"
 	rg2 "github.com/redislabs/redisgraph-go"
 )
 
-// Inserts the given edges grouped by source
-func ChunkedInsertEdge(resources []Edge, clusterName string) ChunkedOperationResult {
-	glog.V(4).Info("For cluster ", clusterName, ": Number of edges received in ChunkedInsertEdge: ", len(resources))
-	var insertEdgeCount int
-	if len(resources) == 0 {
-		return ChunkedOperationResult{
-			ResourceErrors:      nil,
-			SuccessfulResources: 0,
-		}
+// Recursive helper for ChunkedInsertEdge. Takes a single batch, and recursively attempts to insert that batch,
+// then the first and second halves of that batch independently, and so on.
+func chunkedInsertEdgeHelper(r *retrier, edges []Edge) ChunkedOperationResult {
+	if len(edges) == 0 {
+		return ChunkedOperationResult{} // No errors, and no SuccessfulResources
 	}
-
-	// sort our slice addessending by combination source/type to build efficient queries
-	sort.Slice(resources, func(i, j int) bool {
-		// https://stackoverflow.com/questions/4576714/sort-by-two-values-prioritizing-on-one-of-them
-		return resources[i].SourceUID < resources[j].SourceUID || resources[i].EdgeType < resources[j].EdgeType
-	})
-
-	// status to return in ChunkedOperationResult
-	resourceErrors := make(map[string]error)
-	totalAdded := 0
-	currentLength := 0
-
-	newWhereClause := true
-	var whereClause strings.Builder
-	for i := range resources {
-		newWhereClause = true
-		// add dest uid for each node in the group to where clause
-		if whereClause.Len() == 0 {
-			fmt.Fprint(&whereClause, SanitizeQuery("WHERE d._uid='%s'", resources[i].DestUID))
-		} else {
-			fmt.Fprint(&whereClause, SanitizeQuery(" OR d._uid='%s'", resources[i].DestUID))
-		}
-
-		currentLength++
-
-		//look ahead to see if we are in a differnet group or if at max chuck size
-		if currentLength == CHUNK_SIZE || (i < len(resources)-1 &&
-			(resources[i+1].SourceUID != resources[i].SourceUID || resources[i+1].EdgeType != resources[i].EdgeType)) {
-			resp, err := insertEdge(resources[i], whereClause.String())
-			newWhereClause = false
-			if err != nil {
-				// saving JUST the source as the key to the map
-				resourceErrors[resources[i].SourceUID] = err
-			} else {
-				totalAdded += currentLength
-				insertEdgeCount += resp.RelationshipsCreated()
-			}
-			whereClause.Reset()
-			currentLength = 0
+	var resp *rg2.QueryResult
+	err := r.do(func() (err error) { resp, err = insertEdge(edges); return err })
+	if IsTransient(err) { // this is false if err is nil
+		return ChunkedOperationResult{
+			ConnectionError: err,
 		}
 	}
-
-	if newWhereClause {
-		// commit the last edge string to the db
-		resp, err := insertEdge(resources[len(resources)-1], whereClause.String())
-		if err != nil {
+	if err != nil {
+		if len(edges) == 1 { // If this was a single edge
 			// saving JUST the source as the key to the map
-			resourceErrors[resources[len(resources)-1].SourceUID] = err
-		} else {
-			totalAdded += currentLength
-			insertEdgeCount += resp.RelationshipsCreated()
+			return ChunkedOperationResult{
+				ResourceErrors: map[string]error{edges[0].SourceUID: err},
+			}
+		} else { // If this is multiple edges, we make a recursive call to find which half had the error.
+			firstHalf := chunkedInsertEdgeHelper(r, edges[0:len(edges)/2])
+			secondHalf := chunkedInsertEdgeHelper(r, edges[len(edges)/2:])
+			if firstHalf.ConnectionError != nil || secondHalf.ConnectionError != nil {
+				// Again, if either one has a redis conn issue we just instantly bail
+				return ChunkedOperationResult{
+					ConnectionError: err,
+				}
+			}
+			return ChunkedOperationResult{
+				ResourceErrors: mergeErrorMaps(firstHalf.ResourceErrors, secondHalf.ResourceErrors),
+				// These will be 0 if there were errs in the halves
+				SuccessfulResources: firstHalf.SuccessfulResources + secondHalf.SuccessfulResources,
+				EdgesAdded:          firstHalf.EdgesAdded + secondHalf.EdgesAdded,
+			}
 		}
 	}
-	glog.V(4).Info("ChunkedInsertEdge: For cluster, ", clusterName, ": Number of edges inserted: ", insertEdgeCount)
-
+	// All clear, return that we got everything in
 	return ChunkedOperationResult{
-		ResourceErrors:      resourceErrors,
-		SuccessfulResources: totalAdded,
-		EdgesAdded:          insertEdgeCount,
+		SuccessfulResources: len(edges),
+		EdgesAdded:          resp.RelationshipsCreated(),
 	}
 }
 
-// e.g. MATCH (s:{_uid:'abc'}), (d) WHERE d._uid='def' OR d._uid='ghi' CREATE (s)-[:Type]>(d)
-func insertEdge(edge Edge, whereClause string) (*rg2.QueryResult, error) {
-	//This is the basic insert query without using node labels
-	query := fmt.Sprintf("MATCH (s {_uid: '%s'}), (d) %s CREATE (s)-[:%s]->(d)",
-		edge.SourceUID, whereClause, edge.EdgeType)
-
-	// If OR d_uid= is present in whereClause, multiple edges are inserted. So, filter by destKind label cannot be used
-	if strings.Contains(whereClause, " OR d._uid=") {
-		if edge.SourceKind != "" {
-			query = fmt.Sprintf("MATCH (s:%s {_uid: '%s'}), (d) %s CREATE (s)-[:%s]->(d)",
-				edge.SourceKind, edge.SourceUID, whereClause, edge.EdgeType)
-		}
-	} else { //insert only single edge
-		//Insert with node labels if only one edge is inserted at a time.
-		if edge.SourceKind != "" && edge.DestKind != "" { // check if both source and dest labels are present
-			query = fmt.Sprintf("MATCH (s:%s {_uid: '%s'}), (d:%s) %s CREATE (s)-[:%s]->(d)",
-				edge.SourceKind, edge.SourceUID, edge.DestKind, whereClause, edge.EdgeType)
-		}
+// Inserts the given edges in batches of edges with the same type and kinds, returns errors keyed by the source.
+func ChunkedInsertEdge(ctx context.Context, resources []Edge, clusterName string) ChunkedOperationResult {
+	glog.V(4).Info("For cluster ", clusterName, ": Number of edges received in ChunkedInsertEdge: ", len(resources))
+	// Edges with invalid identifiers are rejected, the errors are keyed by the source like the query errors.
+	resources, resourceErrors := validateEdges(resources, func(edge Edge) string { return edge.SourceUID })
+	groups := groupEdges(resources)
+	r := newRetrier(ctx)
+	ret := runBatches(insertEdgeSizer, edgeGroupSizes(groups), func(group, start, end int) ChunkedOperationResult {
+		return chunkedInsertEdgeHelper(r, groups[group][start:end])
+	})
+	ret.Retries = r.count()
+	if ret.ConnectionError != nil {
+		return ret
 	}
+	// if both are nil, this is still nil.
+	ret.ResourceErrors = mergeErrorMaps(resourceErrors, ret.ResourceErrors)
+	glog.V(4).Info("ChunkedInsertEdge: For cluster, ", clusterName, ": Number of edges inserted: ", ret.EdgesAdded)
+	return ret
+}
+
+// Inserts edges with the same type and kinds with a single query.
+func insertEdge(edges []Edge) (*rg2.QueryResult, error) {
+	query := insertEdgeQuery(edges)
 	glog.V(4).Info("Insert query: ", query)
 	resp, err := Store.Query(query)
 	if err == nil {
@@ -117,3 +90,21 @@ func insertEdge(edge Edge, whereClause string) (*rg2.QueryResult, error) {
 	}
 	return resp, err
 }
+
+// Returns the query inserting edges with the same type and kinds, see groupEdges.
+// e.g. CYPHER p0=[{d: 'def', s: 'abc'}] UNWIND $p0 AS r MATCH (s:Pod {_uid: r.s}), (d:Node {_uid: r.d})
+// CREATE (s)-[:Type]->(d)
+func insertEdgeQuery(edges []Edge) string {
+	if len(edges) == 0 {
+		return ""
+	}
+	rows := make([]interface{}, 0, len(edges))
+	for _, edge := range edges {
+		rows = append(rows, map[string]interface{}{"s": edge.SourceUID, "d": edge.DestUID})
+	}
+	sourceLabel, destLabel := edgeLabels(edges[0])
+	b := &queryBuilder{}
+	b.write("UNWIND %s AS r MATCH (s%s {_uid: r.s}), (d%s {_uid: r.d}) CREATE (s)-[:%s]->(d)",
+		b.param(rows), sourceLabel, destLabel, edges[0].EdgeType)
+	return b.String()
+}
@@ -3,6 +3,7 @@
 package dbconnector
 
 import (
+	"context"
 	"testing"
 
 	assert "github.com/stretchr/testify/assert"
@@ -53,8 +54,16 @@ func initTestErrorEdges() []Edge {
 }
 
 func insertQueryCheck(q string) bool {
-	queries := []string{"MATCH (s:srcKind1 {_uid: 'srcUID1'}), (d) WHERE d._uid='destUID1' OR d._uid='destUID2' CREATE (s)-[:edgeType1]->(d)",
-		"MATCH (s:srcKind1 {_uid: 'srcUID1'}), (d:destKind3) WHERE d._uid='destUID3' CREATE (s)-[:edgeType2]->(d)"}
+	queries := []string{
+		"CYPHER p0=[{d: 'destUID1', s: 'srcUID1'}] " +
+			"UNWIND $p0 AS r MATCH (s {_uid: r.s}), (d {_uid: r.d}) CREATE (s)-[:edgeType1]->(d)",
+		"CYPHER p0=[{d: 'destUID2', s: 'srcUID1'}] " +
+			"UNWIND $p0 AS r MATCH (s:srcKind1 {_uid: r.s}), (d:destKind2 {_uid: r.d}) CREATE (s)-[:edgeType1]->(d)",
+		"CYPHER p0=[{d: 'destUID3', s: 'srcUID1'}] " +
+			"UNWIND $p0 AS r MATCH (s:srcKind1 {_uid: r.s}), (d:destKind3 {_uid: r.d}) CREATE (s)-[:edgeType2]->(d)",
+		"CYPHER p0=[{d: 'destUID1', s: 'srcUID1'}] " +
+			"UNWIND $p0 AS r MATCH (s:srcKind1 {_uid: r.s}), (d:destKind1 {_uid: r.d}) CREATE (s)-[:edgeType1]->(d)",
+	}
 	for _, query := range queries {
 		if query == q {
 			return true
@@ -62,16 +71,26 @@ func insertQueryCheck(q string) bool {
 	}
 	return false
 }
+
 func TestChunkedInsertEdge(t *testing.T) {
-	chunkedOpRes := ChunkedInsertEdge(initTestEdges(), clusterName)
+	chunkedOpRes := ChunkedInsertEdge(context.Background(), initTestEdges(), clusterName)
 	t.Logf("%+v\n", chunkedOpRes)
 	assert.Equal(t, 0, len(chunkedOpRes.ResourceErrors))
 	assert.Equal(t, 3, chunkedOpRes.SuccessfulResources)
 }
 
 func TestChunkedInsertErrorEdges(t *testing.T) {
-	chunkedOpRes := ChunkedInsertEdge(initTestErrorEdges(), clusterName)
+	chunkedOpRes := ChunkedInsertEdge(context.Background(), initTestErrorEdges(), clusterName)
 	t.Logf("%+v\n", chunkedOpRes)
 	assert.Equal(t, 1, len(chunkedOpRes.ResourceErrors))
 	assert.Equal(t, 2, chunkedOpRes.SuccessfulResources)
 }
+
+// A batch with an error is split until the edge with the error is found.
+func TestChunkedInsertEdgeBisection(t *testing.T) {
+	edges := append(initTestSingleEdge(), initTestSingleErrorEdge()...)
+	chunkedOpRes := ChunkedInsertEdge(context.Background(), edges, clusterName)
+	assert.Equal(t, 1, len(chunkedOpRes.ResourceErrors))
+	assert.Error(t, chunkedOpRes.ResourceErrors[""])
+	assert.Equal(t, 1, chunkedOpRes.SuccessfulResources)
+}
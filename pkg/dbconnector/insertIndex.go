@@ -47,6 +47,12 @@ func GetIndexes() {
 // Given a resource, inserts index on resource uid into redisgraph.
 func insertIndex(kind, property string) error {
 	glog.V(4).Info("Inserting index")
+	if err := validateIdentifier("kind", kind); err != nil {
+		return err
+	}
+	if err := validateIdentifier("property key", property); err != nil {
+		return err
+	}
 	query := SanitizeQuery("CREATE INDEX ON :%s(%s)", kind, property) //CREATE INDEX ON :Pod(_uid)"
 	_, err := Store.Query(query)
 	glog.V(4).Info("Insert index query: ", query)
@@ -0,0 +1,125 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Connection that answers the Redis commands used by the aggregator from the in-memory graph.
+type conn struct {
+	g       *Graph
+	pending []reply // Replies of the commands sent with Send, read with Receive.
+	closed  bool
+}
+
+type reply struct {
+	value interface{}
+	err   error
+}
+
+// Conn - Returns a connection to the graph. It supports GRAPH.QUERY, GRAPH.DELETE, TYPE, PING and AUTH,
+// so the connection pool and the health checks work without Redis.
+func (g *Graph) Conn() redis.Conn {
+	return &conn{g: g}
+}
+
+func (c *conn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *conn) Err() error {
+	if c.closed {
+		return errors.New("memgraph: connection closed")
+	}
+	return nil
+}
+
+func (c *conn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if c.closed {
+		return nil, c.Err()
+	}
+	if commandName == "" { // Flushes and returns the pending replies, like redigo.
+		var values []interface{}
+		for _, r := range c.pending {
+			if r.err != nil {
+				c.pending = nil
+				return nil, r.err
+			}
+			values = append(values, r.value)
+		}
+		c.pending = nil
+		return values, nil
+	}
+	return c.g.command(commandName, args)
+}
+
+func (c *conn) Send(commandName string, args ...interface{}) error {
+	if c.closed {
+		return c.Err()
+	}
+	value, err := c.g.command(commandName, args)
+	c.pending = append(c.pending, reply{value: value, err: err})
+	return nil
+}
+
+func (c *conn) Flush() error {
+	return c.Err()
+}
+
+func (c *conn) Receive() (interface{}, error) {
+	if len(c.pending) == 0 {
+		return nil, errors.New("memgraph: no pending replies")
+	}
+	r := c.pending[0]
+	c.pending = c.pending[1:]
+	return r.value, r.err
+}
+
+func (g *Graph) command(commandName string, args []interface{}) (interface{}, error) {
+	switch strings.ToUpper(commandName) {
+	case "PING":
+		return "PONG", nil
+	case "AUTH":
+		return "OK", nil
+	case "TYPE":
+		if len(args) != 1 {
+			return nil, redis.Error("ERR wrong number of arguments for 'type' command")
+		}
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+		if fmt.Sprint(args[0]) == graphName && g.created {
+			return "graphdata", nil
+		}
+		return "none", nil
+	case "GRAPH.QUERY":
+		if len(args) < 2 || fmt.Sprint(args[0]) != graphName {
+			return nil, redis.Error(fmt.Sprintf("ERR only the %s graph is supported", graphName))
+		}
+		q, ok := args[1].(string)
+		if !ok {
+			return nil, redis.Error("ERR the query must be a string")
+		}
+		return g.execute(q)
+	case "GRAPH.DELETE":
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+		if !g.created {
+			return nil, redis.Error("ERR Invalid graph operation on empty key")
+		}
+		fresh := New()
+		g.nodes, g.edges, g.byUID, g.byLabel, g.indexes = fresh.nodes, fresh.edges, fresh.byUID, fresh.byLabel,
+			fresh.indexes
+		g.labels, g.propertyKeys, g.relationshipTypes = registry{}, registry{}, registry{}
+		g.created = false
+		return "OK", nil
+	default:
+		return nil, redis.Error(fmt.Sprintf("ERR unknown command '%s'", commandName))
+	}
+}
@@ -0,0 +1,653 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Counters reported in the statistics of the response.
+type queryStats struct {
+	labelsAdded          int
+	nodesCreated         int
+	propertiesSet        int
+	relationshipsCreated int
+	nodesDeleted         int
+	relationshipsDeleted int
+	indicesCreated       int
+}
+
+// Executes a parsed query against the graph. The graph mutex must be held.
+type executor struct {
+	g       *Graph
+	params  map[string]interface{}
+	stats   queryStats
+	columns []string
+	records [][]interface{}
+}
+
+func (x *executor) run(q *query) error {
+	x.params = map[string]interface{}{}
+	for name, e := range q.params {
+		value, err := x.eval(e, row{})
+		if err != nil {
+			return err
+		}
+		x.params[name] = value
+	}
+
+	rows := []row{{}}
+	for i, c := range q.clauses {
+		var err error
+		switch c := c.(type) {
+		case *matchClause:
+			rows, err = x.match(c, rows)
+		case *createClause:
+			rows, err = x.create(c, rows)
+		case *mergeClause:
+			rows, err = x.merge(c, rows)
+		case *setClause:
+			err = x.set(c, rows)
+		case *deleteClause:
+			err = x.delete(c, rows)
+		case *withClause:
+			if rows, err = x.project(c.projection, rows); err == nil && c.where != nil {
+				rows, err = x.filter(c.where, rows)
+			}
+		case *unwindClause:
+			rows, err = x.unwind(c, rows)
+		case *returnClause:
+			if i != len(q.clauses)-1 {
+				return fmt.Errorf("RETURN must be the last clause")
+			}
+			err = x.returnRows(c, rows)
+		case *createIndexClause:
+			key := c.label + ":" + c.property
+			if !x.g.indexes[key] {
+				x.g.indexes[key] = true
+				x.stats.indicesCreated++
+			}
+		case *callClause:
+			if len(q.clauses) != 1 {
+				return fmt.Errorf("CALL must be the only clause")
+			}
+			err = x.call(c)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *executor) filter(where expr, rows []row) ([]row, error) {
+	filtered := []row{}
+	for _, r := range rows {
+		value, err := x.evalBool(where, r)
+		if err != nil {
+			return nil, err
+		}
+		if value == true {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered, nil
+}
+
+func (x *executor) match(c *matchClause, rows []row) ([]row, error) {
+	for _, pattern := range c.patterns {
+		var matched []row
+		for _, r := range rows {
+			found, err := x.matchPath(pattern, 0, r)
+			if err != nil {
+				return nil, err
+			}
+			matched = append(matched, found...)
+		}
+		rows = matched
+	}
+	if c.where != nil {
+		return x.filter(c.where, rows)
+	}
+	return rows, nil
+}
+
+// Returns the rows that extend r with a match for the path, starting from nodes[i].
+func (x *executor) matchPath(pattern pathPattern, i int, r row) ([]row, error) {
+	if i == 0 {
+		candidates, err := x.candidates(pattern.nodes[0], r)
+		if err != nil {
+			return nil, err
+		}
+		var matched []row
+		for _, n := range candidates {
+			bound, ok, err := x.bindNode(pattern.nodes[0], 0, n, r)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			found, err := x.matchPath(pattern, 1, bound)
+			if err != nil {
+				return nil, err
+			}
+			matched = append(matched, found...)
+		}
+		return matched, nil
+	}
+	if i == len(pattern.nodes) {
+		return []row{r}, nil
+	}
+
+	rel := pattern.rels[i-1]
+	from := r[pattern.nodes[i-1].variable]
+	if pattern.nodes[i-1].variable == "" {
+		from = r[anonymousVariable(i-1)]
+	}
+	fromNode := from.(*node)
+	edges := fromNode.out
+	if !rel.outgoing {
+		edges = fromNode.in
+	}
+	var matched []row
+	for _, e := range sortedEdges(edges) {
+		if rel.relType != "" && e.relType != rel.relType {
+			continue
+		}
+		if ok, err := x.propertiesMatch(rel.props, e.props, r); err != nil || !ok {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		bound := r
+		if rel.variable != "" {
+			if existing, ok := r[rel.variable]; ok {
+				if existing != e {
+					continue
+				}
+			} else {
+				bound = bound.with(rel.variable, e)
+			}
+		}
+		next := e.dst
+		if !rel.outgoing {
+			next = e.src
+		}
+		bound, ok, err := x.bindNode(pattern.nodes[i], i, next, bound)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		found, err := x.matchPath(pattern, i+1, bound)
+		if err != nil {
+			return nil, err
+		}
+		matched = append(matched, found...)
+	}
+	return matched, nil
+}
+
+// Anonymous nodes in a path are bound to hidden variables, the next relationship starts from them.
+func anonymousVariable(i int) string {
+	return fmt.Sprintf(" anon%d", i)
+}
+
+// Returns the nodes that may match the first node of a pattern, using the _uid and label indexes.
+func (x *executor) candidates(pattern nodePattern, r row) ([]*node, error) {
+	if bound, ok := r[pattern.variable]; ok && pattern.variable != "" {
+		n, isNode := bound.(*node)
+		if !isNode {
+			return nil, fmt.Errorf("%s isn't a node", pattern.variable)
+		}
+		return []*node{n}, nil
+	}
+	for _, prop := range pattern.props {
+		if prop.key != "_uid" {
+			continue
+		}
+		uid, err := x.eval(prop.value, r)
+		if err != nil {
+			return nil, err
+		}
+		return sortedNodes(x.g.byUID[fmt.Sprint(uid)]), nil
+	}
+	if pattern.label != "" {
+		return sortedNodes(x.g.byLabel[pattern.label]), nil
+	}
+	return sortedNodes(x.g.nodes), nil
+}
+
+// Checks that a node matches the pattern and binds it to the pattern variable.
+func (x *executor) bindNode(pattern nodePattern, position int, n *node, r row) (row, bool, error) {
+	if pattern.label != "" && n.label != pattern.label {
+		return nil, false, nil
+	}
+	ok, err := x.propertiesMatch(pattern.props, n.props, r)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	name := pattern.variable
+	if name == "" {
+		// Hidden variables are only needed to continue the path, they don't need to be unique across patterns.
+		return r.with(anonymousVariable(position), n), true, nil
+	}
+	if existing, bound := r[name]; bound {
+		return r, existing == n, nil
+	}
+	return r.with(name, n), true, nil
+}
+
+func (x *executor) propertiesMatch(pattern []propertyPair, props map[string]interface{}, r row) (bool, error) {
+	for _, pair := range pattern {
+		expected, err := x.eval(pair.value, r)
+		if err != nil {
+			return false, err
+		}
+		if equal, _ := compareValues("=", props[pair.key], expected); equal != true {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (x *executor) create(c *createClause, rows []row) ([]row, error) {
+	for i, r := range rows {
+		for _, pattern := range c.patterns {
+			var err error
+			if r, err = x.createPath(pattern, r); err != nil {
+				return nil, err
+			}
+		}
+		rows[i] = r
+	}
+	return rows, nil
+}
+
+func (x *executor) createPath(pattern pathPattern, r row) (row, error) {
+	nodes := make([]*node, len(pattern.nodes))
+	for i, np := range pattern.nodes {
+		if bound, ok := r[np.variable]; ok && np.variable != "" {
+			n, isNode := bound.(*node)
+			if !isNode {
+				return nil, fmt.Errorf("%s isn't a node", np.variable)
+			}
+			if np.label != "" || len(np.props) > 0 {
+				return nil, fmt.Errorf("the bound variable %s can't be redeclared in CREATE", np.variable)
+			}
+			nodes[i] = n
+			continue
+		}
+		n, err := x.createNode(np, r)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = n
+		if np.variable != "" {
+			r = r.with(np.variable, n)
+		}
+	}
+	for i, rel := range pattern.rels {
+		if rel.relType == "" {
+			return nil, fmt.Errorf("relationships created with CREATE must have a type")
+		}
+		src, dst := nodes[i], nodes[i+1]
+		if !rel.outgoing {
+			src, dst = dst, src
+		}
+		e := x.g.createEdge(rel.relType, src, dst)
+		x.stats.relationshipsCreated++
+		for _, pair := range rel.props {
+			value, err := x.eval(pair.value, r)
+			if err != nil {
+				return nil, err
+			}
+			if err = checkPropertyValue(pair.key, value); err != nil {
+				return nil, err
+			}
+			if value != nil {
+				setProperty(&x.g.propertyKeys, e.props, pair.key, value)
+				x.stats.propertiesSet++
+			}
+		}
+		if rel.variable != "" {
+			r = r.with(rel.variable, e)
+		}
+	}
+	return r, nil
+}
+
+func (x *executor) createNode(np nodePattern, r row) (*node, error) {
+	values := make([]interface{}, len(np.props))
+	for i, pair := range np.props {
+		value, err := x.eval(pair.value, r)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkPropertyValue(pair.key, value); err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	if np.label != "" {
+		if _, exists := x.g.labels.index[np.label]; !exists {
+			x.stats.labelsAdded++
+		}
+	}
+	n := x.g.createNode(np.label)
+	x.stats.nodesCreated++
+	for i, pair := range np.props {
+		if values[i] != nil {
+			x.g.setNodeProperty(n, pair.key, values[i])
+			x.stats.propertiesSet++
+		}
+	}
+	return n, nil
+}
+
+// Properties hold scalars or lists of scalars.
+func checkPropertyValue(key string, value interface{}) error {
+	switch v := value.(type) {
+	case nil, string, int64, float64, bool:
+		return nil
+	case []interface{}:
+		for _, element := range v {
+			switch element.(type) {
+			case nil, string, int64, float64, bool:
+			default:
+				return fmt.Errorf("property %s: lists can only hold scalars, found %s", key, typeName(element))
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("property %s: %s values can't be stored", key, typeName(value))
+}
+
+func (x *executor) merge(c *mergeClause, rows []row) ([]row, error) {
+	if len(c.pattern.nodes) != 1 {
+		return nil, fmt.Errorf("MERGE only supports a single node")
+	}
+	np := c.pattern.nodes[0]
+	var merged []row
+	for _, r := range rows {
+		found, err := x.matchPath(c.pattern, 0, r)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) > 0 {
+			merged = append(merged, found...)
+			continue
+		}
+		n, err := x.createNode(np, r)
+		if err != nil {
+			return nil, err
+		}
+		if np.variable != "" {
+			r = r.with(np.variable, n)
+		}
+		merged = append(merged, r)
+	}
+	return merged, nil
+}
+
+func (x *executor) set(c *setClause, rows []row) error {
+	for _, r := range rows {
+		for _, item := range c.items {
+			target, ok := r[item.variable]
+			if !ok {
+				return fmt.Errorf("%s not defined", item.variable)
+			}
+			value, err := x.eval(item.value, r)
+			if err != nil {
+				return err
+			}
+			values := map[string]interface{}{item.property: value}
+			if item.property == "" {
+				m, isMap := value.(map[string]interface{})
+				if !isMap {
+					return fmt.Errorf("type mismatch: SET %s expects a map", item.variable)
+				}
+				values = m
+			}
+			for key, value := range values {
+				if err = checkPropertyValue(key, value); err != nil {
+					return err
+				}
+			}
+			switch target := target.(type) {
+			case nil: // Optional values are skipped.
+			case *node:
+				if item.property == "" && !item.merge {
+					for key := range target.props {
+						if _, keep := values[key]; !keep {
+							x.g.setNodeProperty(target, key, nil)
+						}
+					}
+				}
+				for key, value := range values {
+					x.g.setNodeProperty(target, key, value)
+					x.stats.propertiesSet++
+				}
+			case *edge:
+				if item.property == "" && !item.merge {
+					target.props = map[string]interface{}{}
+				}
+				for key, value := range values {
+					setProperty(&x.g.propertyKeys, target.props, key, value)
+					x.stats.propertiesSet++
+				}
+			default:
+				return fmt.Errorf("type mismatch: SET expects a node or an edge but %s is %s", item.variable,
+					typeName(target))
+			}
+		}
+	}
+	return nil
+}
+
+// Deletes nodes and edges after evaluating all the rows, a node deleted in a row may be referenced by the next.
+func (x *executor) delete(c *deleteClause, rows []row) error {
+	nodes := map[int64]*node{}
+	edges := map[int64]*edge{}
+	var collect func(value interface{}) error
+	collect = func(value interface{}) error {
+		switch v := value.(type) {
+		case nil:
+		case *node:
+			nodes[v.id] = v
+		case *edge:
+			edges[v.id] = v
+		case []interface{}:
+			for _, element := range v {
+				if err := collect(element); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("DELETE expects nodes or edges but found %s", typeName(value))
+		}
+		return nil
+	}
+	for _, r := range rows {
+		for _, e := range c.exprs {
+			value, err := x.eval(e, r)
+			if err != nil {
+				return err
+			}
+			if err = collect(value); err != nil {
+				return err
+			}
+		}
+	}
+	for _, e := range sortedEdges(edges) {
+		if x.g.deleteEdge(e) {
+			x.stats.relationshipsDeleted++
+		}
+	}
+	for _, n := range sortedNodes(nodes) {
+		if _, exists := x.g.nodes[n.id]; exists {
+			x.stats.relationshipsDeleted += x.g.deleteNode(n)
+			x.stats.nodesDeleted++
+		}
+	}
+	return nil
+}
+
+func (x *executor) unwind(c *unwindClause, rows []row) ([]row, error) {
+	var unwound []row
+	for _, r := range rows {
+		value, err := x.eval(c.list, r)
+		if err != nil {
+			return nil, err
+		}
+		switch list := value.(type) {
+		case nil:
+		case []interface{}:
+			for _, element := range list {
+				unwound = append(unwound, r.with(c.variable, element))
+			}
+		default:
+			unwound = append(unwound, r.with(c.variable, value))
+		}
+	}
+	return unwound, nil
+}
+
+// Evaluates a projection. When an item is an aggregate, the rows are grouped by the other items.
+func (x *executor) project(proj projection, rows []row) ([]row, error) {
+	aggregating := false
+	for _, item := range proj.items {
+		aggregating = aggregating || isAggregate(item.expr)
+	}
+
+	var projected []row
+	if !aggregating {
+		for _, r := range rows {
+			p := make(row, len(proj.items))
+			for _, item := range proj.items {
+				value, err := x.eval(item.expr, r)
+				if err != nil {
+					return nil, err
+				}
+				p[item.name] = value
+			}
+			projected = append(projected, p)
+		}
+	} else {
+		var keys []string
+		groups := map[string][]row{}
+		keyRows := map[string]row{}
+		for _, r := range rows {
+			key := make(row)
+			var sb strings.Builder
+			for _, item := range proj.items {
+				if isAggregate(item.expr) {
+					continue
+				}
+				value, err := x.eval(item.expr, r)
+				if err != nil {
+					return nil, err
+				}
+				key[item.name] = value
+				sb.WriteString(valueKey(value))
+				sb.WriteString("|")
+			}
+			if _, ok := groups[sb.String()]; !ok {
+				keys = append(keys, sb.String())
+				keyRows[sb.String()] = key
+			}
+			groups[sb.String()] = append(groups[sb.String()], r)
+		}
+		if len(rows) == 0 && len(keyRows) == 0 {
+			onlyAggregates := true
+			for _, item := range proj.items {
+				onlyAggregates = onlyAggregates && isAggregate(item.expr)
+			}
+			// Without grouping keys an aggregate returns one row, count is 0 when nothing matched.
+			if onlyAggregates {
+				keys = []string{""}
+				keyRows[""] = row{}
+			}
+		}
+		for _, key := range keys {
+			p := keyRows[key]
+			for _, item := range proj.items {
+				if !isAggregate(item.expr) {
+					continue
+				}
+				value, err := x.aggregate(item.expr.(*functionExpr), groups[key])
+				if err != nil {
+					return nil, err
+				}
+				p[item.name] = value
+			}
+			projected = append(projected, p)
+		}
+	}
+
+	if proj.distinct {
+		seen := map[string]bool{}
+		var distinct []row
+		for _, p := range projected {
+			var sb strings.Builder
+			for _, item := range proj.items {
+				sb.WriteString(valueKey(p[item.name]))
+				sb.WriteString("|")
+			}
+			if !seen[sb.String()] {
+				seen[sb.String()] = true
+				distinct = append(distinct, p)
+			}
+		}
+		projected = distinct
+	}
+	return projected, nil
+}
+
+func (x *executor) returnRows(c *returnClause, rows []row) error {
+	projected, err := x.project(c.projection, rows)
+	if err != nil {
+		return err
+	}
+	x.columns = make([]string, len(c.projection.items))
+	for i, item := range c.projection.items {
+		x.columns[i] = item.name
+	}
+	x.records = make([][]interface{}, 0, len(projected))
+	for _, p := range projected {
+		record := make([]interface{}, len(x.columns))
+		for i, name := range x.columns {
+			record[i] = p[name]
+		}
+		x.records = append(x.records, record)
+	}
+	return nil
+}
+
+// Procedures used by the client to resolve the names in a compact response.
+func (x *executor) call(c *callClause) error {
+	var names *registry
+	switch c.procedure {
+	case "db.labels":
+		names = &x.g.labels
+		x.columns = []string{"label"}
+	case "db.propertyKeys":
+		names = &x.g.propertyKeys
+		x.columns = []string{"propertyKey"}
+	case "db.relationshipTypes":
+		names = &x.g.relationshipTypes
+		x.columns = []string{"relationshipType"}
+	default:
+		return fmt.Errorf("procedure %s is not registered", c.procedure)
+	}
+	x.records = [][]interface{}{}
+	for _, name := range names.names {
+		x.records = append(x.records, []interface{}{name})
+	}
+	return nil
+}
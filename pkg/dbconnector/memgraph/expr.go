@@ -0,0 +1,601 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Values are nil, string, int64, float64, bool, []interface{}, map[string]interface{}, *node and *edge.
+type expr interface{}
+
+type literalExpr struct {
+	value interface{}
+}
+
+type paramExpr struct {
+	name string
+}
+
+type variableExpr struct {
+	name string
+}
+
+type propertyExpr struct {
+	target expr
+	key    string
+}
+
+type indexExpr struct {
+	target expr
+	index  expr
+}
+
+type sliceExpr struct {
+	target expr
+	from   expr // nil for the start of the list.
+	to     expr // nil for the end of the list.
+}
+
+type listExpr struct {
+	items []expr
+}
+
+type mapExpr struct {
+	pairs []propertyPair
+}
+
+type logicalExpr struct {
+	op          string // AND, OR
+	left, right expr
+}
+
+type notExpr struct {
+	operand expr
+}
+
+type isNullExpr struct {
+	operand expr
+	negate  bool
+}
+
+type inExpr struct {
+	item, list expr
+}
+
+type comparisonExpr struct {
+	op          string
+	left, right expr
+}
+
+type arithmeticExpr struct {
+	op          string // + or -
+	left, right expr
+}
+
+type functionExpr struct {
+	name     string // Lower case.
+	args     []expr
+	distinct bool
+	star     bool // count(*)
+}
+
+// Variables bound while executing a query.
+type row map[string]interface{}
+
+func (r row) with(name string, value interface{}) row {
+	extended := make(row, len(r)+1)
+	for k, v := range r {
+		extended[k] = v
+	}
+	extended[name] = value
+	return extended
+}
+
+func isAggregate(e expr) bool {
+	f, ok := e.(*functionExpr)
+	return ok && (f.name == "count" || f.name == "collect")
+}
+
+// Evaluates an expression for a row. Aggregate functions must be evaluated with aggregate().
+func (x *executor) eval(e expr, r row) (interface{}, error) {
+	switch e := e.(type) {
+	case *literalExpr:
+		return e.value, nil
+	case *paramExpr:
+		value, ok := x.params[e.name]
+		if !ok {
+			return nil, fmt.Errorf("missing parameter %s", e.name)
+		}
+		return value, nil
+	case *variableExpr:
+		value, ok := r[e.name]
+		if !ok {
+			return nil, fmt.Errorf("%s not defined", e.name)
+		}
+		return value, nil
+	case *propertyExpr:
+		target, err := x.eval(e.target, r)
+		if err != nil {
+			return nil, err
+		}
+		switch target := target.(type) {
+		case nil:
+			return nil, nil
+		case *node:
+			return target.props[e.key], nil
+		case *edge:
+			return target.props[e.key], nil
+		case map[string]interface{}:
+			return target[e.key], nil
+		default:
+			return nil, fmt.Errorf("type mismatch: expected a node, edge or map but was %s", typeName(target))
+		}
+	case *indexExpr:
+		target, err := x.eval(e.target, r)
+		if err != nil {
+			return nil, err
+		}
+		index, err := x.eval(e.index, r)
+		if err != nil || target == nil || index == nil {
+			return nil, err
+		}
+		list, ok := target.([]interface{})
+		i, isInt := index.(int64)
+		if !ok || !isInt {
+			return nil, fmt.Errorf("type mismatch: expected a list and an integer index")
+		}
+		if i < 0 {
+			i += int64(len(list))
+		}
+		if i < 0 || i >= int64(len(list)) {
+			return nil, nil
+		}
+		return list[i], nil
+	case *sliceExpr:
+		return x.evalSlice(e, r)
+	case *listExpr:
+		list := make([]interface{}, 0, len(e.items))
+		for _, item := range e.items {
+			value, err := x.eval(item, r)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case *mapExpr:
+		m := make(map[string]interface{}, len(e.pairs))
+		for _, pair := range e.pairs {
+			value, err := x.eval(pair.value, r)
+			if err != nil {
+				return nil, err
+			}
+			m[pair.key] = value
+		}
+		return m, nil
+	case *logicalExpr:
+		left, err := x.evalBool(e.left, r)
+		if err != nil {
+			return nil, err
+		}
+		// Short circuit, but null still needs the right side.
+		if e.op == "AND" && left == false || e.op == "OR" && left == true {
+			return left, nil
+		}
+		right, err := x.evalBool(e.right, r)
+		if err != nil {
+			return nil, err
+		}
+		if e.op == "AND" {
+			if right == false {
+				return false, nil
+			}
+		} else if right == true {
+			return true, nil
+		}
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		return right, nil
+	case *notExpr:
+		value, err := x.evalBool(e.operand, r)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		return !value.(bool), nil
+	case *isNullExpr:
+		value, err := x.eval(e.operand, r)
+		if err != nil {
+			return nil, err
+		}
+		return (value == nil) != e.negate, nil
+	case *inExpr:
+		item, err := x.eval(e.item, r)
+		if err != nil {
+			return nil, err
+		}
+		list, err := x.eval(e.list, r)
+		if err != nil || list == nil {
+			return nil, err
+		}
+		elements, ok := list.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("type mismatch: IN expects a list but was %s", typeName(list))
+		}
+		for _, element := range elements {
+			if equal, _ := compareValues("=", item, element); equal == true {
+				return true, nil
+			}
+		}
+		return false, nil
+	case *comparisonExpr:
+		left, err := x.eval(e.left, r)
+		if err != nil {
+			return nil, err
+		}
+		right, err := x.eval(e.right, r)
+		if err != nil {
+			return nil, err
+		}
+		return compareValues(e.op, left, right)
+	case *arithmeticExpr:
+		left, err := x.eval(e.left, r)
+		if err != nil {
+			return nil, err
+		}
+		right, err := x.eval(e.right, r)
+		if err != nil {
+			return nil, err
+		}
+		return arithmetic(e.op, left, right)
+	case *functionExpr:
+		return x.evalFunction(e, r)
+	default:
+		return nil, fmt.Errorf("unsupported expression %T", e)
+	}
+}
+
+// Evaluates a predicate. Returns true, false or nil.
+func (x *executor) evalBool(e expr, r row) (interface{}, error) {
+	value, err := x.eval(e, r)
+	if err != nil {
+		return nil, err
+	}
+	switch value.(type) {
+	case nil, bool:
+		return value, nil
+	default:
+		return nil, fmt.Errorf("type mismatch: expected a boolean but was %s", typeName(value))
+	}
+}
+
+func (x *executor) evalSlice(e *sliceExpr, r row) (interface{}, error) {
+	target, err := x.eval(e.target, r)
+	if err != nil || target == nil {
+		return nil, err
+	}
+	list, ok := target.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("type mismatch: expected a list but was %s", typeName(target))
+	}
+	bound := func(bound expr, def int64) (int64, error) {
+		if bound == nil {
+			return def, nil
+		}
+		value, err := x.eval(bound, r)
+		if err != nil {
+			return 0, err
+		}
+		i, ok := value.(int64)
+		if !ok {
+			return 0, fmt.Errorf("type mismatch: expected an integer range but was %s", typeName(value))
+		}
+		if i < 0 {
+			i += int64(len(list))
+		}
+		if i < 0 {
+			i = 0
+		}
+		if i > int64(len(list)) {
+			i = int64(len(list))
+		}
+		return i, nil
+	}
+	from, err := bound(e.from, 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := bound(e.to, int64(len(list)))
+	if err != nil {
+		return nil, err
+	}
+	if from >= to {
+		return []interface{}{}, nil
+	}
+	return append([]interface{}{}, list[from:to]...), nil
+}
+
+func (x *executor) evalFunction(f *functionExpr, r row) (interface{}, error) {
+	if isAggregate(f) {
+		return nil, fmt.Errorf("%s() is only supported in WITH and RETURN", f.name)
+	}
+	args := make([]interface{}, 0, len(f.args))
+	for _, arg := range f.args {
+		value, err := x.eval(arg, r)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	if f.name == "coalesce" { // Returns the first argument that isn't null.
+		for _, value := range args {
+			if value != nil {
+				return value, nil
+			}
+		}
+		return nil, nil
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s() expects one argument", f.name)
+	}
+	switch f.name {
+	case "type":
+		if e, ok := args[0].(*edge); ok {
+			return e.relType, nil
+		}
+	case "labels":
+		if n, ok := args[0].(*node); ok {
+			if n.label == "" {
+				return []interface{}{}, nil
+			}
+			return []interface{}{n.label}, nil
+		}
+	case "id":
+		switch value := args[0].(type) {
+		case *node:
+			return value.id, nil
+		case *edge:
+			return value.id, nil
+		}
+	case "size":
+		switch value := args[0].(type) {
+		case []interface{}:
+			return int64(len(value)), nil
+		case string:
+			return int64(len([]rune(value))), nil
+		}
+	case "tostring":
+		switch value := args[0].(type) {
+		case string:
+			return value, nil
+		case int64, float64, bool:
+			return fmt.Sprintf("%v", value), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown function '%s'", f.name)
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("type mismatch: %s() doesn't accept %s", f.name, typeName(args[0]))
+}
+
+// Computes an aggregate function over the rows of a group.
+func (x *executor) aggregate(f *functionExpr, rows []row) (interface{}, error) {
+	if !f.star && len(f.args) != 1 {
+		return nil, fmt.Errorf("%s() expects one argument", f.name)
+	}
+	values := []interface{}{}
+	seen := map[string]bool{}
+	for _, r := range rows {
+		if f.star {
+			values = append(values, true)
+			continue
+		}
+		value, err := x.eval(f.args[0], r)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil { // Aggregates ignore null.
+			continue
+		}
+		if f.distinct {
+			key := valueKey(value)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		values = append(values, value)
+	}
+	if f.name == "count" {
+		return int64(len(values)), nil
+	}
+	return values, nil
+}
+
+// Compares two values. Comparisons with null are null.
+func compareValues(op string, left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	if op == "=" || op == "<>" {
+		equal := valuesEqual(left, right)
+		return equal == (op == "="), nil
+	}
+	var cmp int
+	switch l := left.(type) {
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, nil
+		}
+		cmp = strings.Compare(l, r)
+	case int64, float64:
+		lf, _ := toFloat(l)
+		rf, ok := toFloat(right)
+		if !ok {
+			return nil, nil
+		}
+		switch {
+		case lf < rf:
+			cmp = -1
+		case lf > rf:
+			cmp = 1
+		}
+	default:
+		return nil, nil
+	}
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case ">":
+		return cmp > 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", op)
+}
+
+func valuesEqual(left, right interface{}) bool {
+	if lf, ok := toFloat(left); ok {
+		rf, ok := toFloat(right)
+		return ok && lf == rf
+	}
+	switch l := left.(type) {
+	case []interface{}:
+		r, ok := right.([]interface{})
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		for i := range l {
+			if !valuesEqual(l[i], r[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		r, ok := right.(map[string]interface{})
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		for k, v := range l {
+			if !valuesEqual(v, r[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return left == right
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func arithmetic(op string, left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	if op == "+" {
+		ls, lIsString := left.(string)
+		rs, rIsString := right.(string)
+		if lIsString || rIsString {
+			if !lIsString {
+				ls = fmt.Sprintf("%v", left)
+			}
+			if !rIsString {
+				rs = fmt.Sprintf("%v", right)
+			}
+			return ls + rs, nil
+		}
+		if l, ok := left.([]interface{}); ok {
+			if r, ok := right.([]interface{}); ok {
+				return append(append([]interface{}{}, l...), r...), nil
+			}
+			return append(append([]interface{}{}, l...), right), nil
+		}
+	}
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			if op == "+" {
+				return l + r, nil
+			}
+			return l - r, nil
+		}
+	}
+	l, lok := toFloat(left)
+	r, rok := toFloat(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("type mismatch: can't apply %s to %s and %s", op, typeName(left), typeName(right))
+	}
+	if op == "+" {
+		return l + r, nil
+	}
+	return l - r, nil
+}
+
+// Returns a string that identifies a value, used for DISTINCT and grouping.
+func valueKey(value interface{}) string {
+	switch v := value.(type) {
+	case *node:
+		return fmt.Sprintf("node:%d", v.id)
+	case *edge:
+		return fmt.Sprintf("edge:%d", v.id)
+	case []interface{}:
+		keys := make([]string, len(v))
+		for i, element := range v {
+			keys[i] = valueKey(element)
+		}
+		return "[" + strings.Join(keys, ",") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k, element := range v {
+			keys = append(keys, fmt.Sprintf("%q:%s", k, valueKey(element)))
+		}
+		sort.Strings(keys)
+		return "{" + strings.Join(keys, ",") + "}"
+	case int64:
+		return fmt.Sprintf("n:%v", float64(v))
+	case float64:
+		return fmt.Sprintf("n:%v", v)
+	default:
+		return fmt.Sprintf("%T:%v", v, v)
+	}
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "Null"
+	case string:
+		return "String"
+	case int64:
+		return "Integer"
+	case float64:
+		return "Float"
+	case bool:
+		return "Boolean"
+	case []interface{}:
+		return "List"
+	case map[string]interface{}:
+		return "Map"
+	case *node:
+		return "Node"
+	case *edge:
+		return "Edge"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+// Package memgraph is an in-process graph that understands the subset of Cypher used by the aggregator.
+// It replaces RedisGraph for local development and tests, the data isn't persisted.
+package memgraph
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+	rg2 "github.com/redislabs/redisgraph-go"
+)
+
+// Name of the graph, the same key used in Redis.
+const graphName = "search-db"
+
+type node struct {
+	id    int64
+	label string
+	props map[string]interface{}
+	out   map[int64]*edge
+	in    map[int64]*edge
+}
+
+type edge struct {
+	id      int64
+	relType string
+	src     *node
+	dst     *node
+	props   map[string]interface{}
+}
+
+// Graph - In-memory graph. Safe for concurrent use, queries are executed one at a time.
+type Graph struct {
+	mutex   sync.Mutex
+	nodes   map[int64]*node
+	edges   map[int64]*edge
+	byUID   map[string]map[int64]*node // Nodes by the _uid property, duplicates are possible like in RedisGraph.
+	byLabel map[string]map[int64]*node // Nodes by label.
+	nextID  int64
+	created bool // Like the Redis key, the graph exists after the first write.
+
+	labels            registry
+	propertyKeys      registry
+	relationshipTypes registry
+	indexes           map[string]bool // Label:property
+}
+
+// Names in the order they were first used. Responses refer to names by their position.
+type registry struct {
+	names []string
+	index map[string]int
+}
+
+func (r *registry) add(name string) int {
+	if i, ok := r.index[name]; ok {
+		return i
+	}
+	if r.index == nil {
+		r.index = map[string]int{}
+	}
+	r.index[name] = len(r.names)
+	r.names = append(r.names, name)
+	return r.index[name]
+}
+
+// New - Returns an empty graph.
+func New() *Graph {
+	return &Graph{
+		nodes:   map[int64]*node{},
+		edges:   map[int64]*edge{},
+		byUID:   map[string]map[int64]*node{},
+		byLabel: map[string]map[int64]*node{},
+		indexes: map[string]bool{},
+	}
+}
+
+// Query - Executes a query and parses the response like a query to RedisGraph. Implements dbconnector.DBStore.
+func (g *Graph) Query(q string) (*rg2.QueryResult, error) {
+	graph := rg2.Graph{Conn: g.Conn(), Id: graphName}
+	return graph.Query(q)
+}
+
+// Runs a query and returns the response in the RedisGraph compact format.
+func (g *Graph) execute(q string) (interface{}, error) {
+	parsed, err := parse(q)
+	if err != nil {
+		return nil, redis.Error(err.Error())
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	x := &executor{g: g}
+	if err = x.run(parsed); err != nil {
+		return nil, redis.Error(err.Error())
+	}
+	return x.response(), nil
+}
+
+func (g *Graph) createNode(label string) *node {
+	g.nextID++
+	n := &node{id: g.nextID, label: label, props: map[string]interface{}{}, out: map[int64]*edge{},
+		in: map[int64]*edge{}}
+	g.nodes[n.id] = n
+	if label != "" {
+		g.labels.add(label)
+		if g.byLabel[label] == nil {
+			g.byLabel[label] = map[int64]*node{}
+		}
+		g.byLabel[label][n.id] = n
+	}
+	g.created = true
+	return n
+}
+
+func (g *Graph) createEdge(relType string, src, dst *node) *edge {
+	g.nextID++
+	e := &edge{id: g.nextID, relType: relType, src: src, dst: dst, props: map[string]interface{}{}}
+	g.relationshipTypes.add(relType)
+	g.edges[e.id] = e
+	src.out[e.id] = e
+	dst.in[e.id] = e
+	g.created = true
+	return e
+}
+
+// Sets a property of a node. A nil value removes the property.
+func (g *Graph) setNodeProperty(n *node, key string, value interface{}) {
+	if key == "_uid" {
+		g.unindexUID(n)
+		if uid, ok := value.(string); ok {
+			if g.byUID[uid] == nil {
+				g.byUID[uid] = map[int64]*node{}
+			}
+			g.byUID[uid][n.id] = n
+		}
+	}
+	setProperty(&g.propertyKeys, n.props, key, value)
+}
+
+func setProperty(keys *registry, props map[string]interface{}, key string, value interface{}) {
+	if value == nil {
+		delete(props, key)
+		return
+	}
+	keys.add(key)
+	props[key] = value
+}
+
+// Deletes a node and its edges. Returns the number of edges deleted.
+func (g *Graph) deleteNode(n *node) int {
+	deleted := 0
+	for _, edges := range []map[int64]*edge{n.out, n.in} {
+		for _, e := range edges {
+			if g.deleteEdge(e) {
+				deleted++
+			}
+		}
+	}
+	delete(g.nodes, n.id)
+	delete(g.byLabel[n.label], n.id)
+	g.unindexUID(n)
+	return deleted
+}
+
+func (g *Graph) unindexUID(n *node) {
+	if uid, ok := n.props["_uid"].(string); ok {
+		delete(g.byUID[uid], n.id)
+		if len(g.byUID[uid]) == 0 {
+			delete(g.byUID, uid)
+		}
+	}
+}
+
+// Returns false if the edge was already deleted.
+func (g *Graph) deleteEdge(e *edge) bool {
+	if _, ok := g.edges[e.id]; !ok {
+		return false
+	}
+	delete(g.edges, e.id)
+	delete(e.src.out, e.id)
+	delete(e.dst.in, e.id)
+	return true
+}
+
+// Returns the nodes sorted by id, so results don't depend on map order.
+func sortedNodes(nodes map[int64]*node) []*node {
+	sorted := make([]*node, 0, len(nodes))
+	for _, n := range nodes {
+		sorted = append(sorted, n)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].id < sorted[j].id })
+	return sorted
+}
+
+func sortedEdges(edges map[int64]*edge) []*edge {
+	sorted := make([]*edge, 0, len(edges))
+	for _, e := range edges {
+		sorted = append(sorted, e)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].id < sorted[j].id })
+	return sorted
+}
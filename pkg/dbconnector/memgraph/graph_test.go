@@ -0,0 +1,246 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// Runs a query that must succeed.
+func mustQuery(t *testing.T, g *Graph, q string) *rg2.QueryResult {
+	t.Helper()
+	result, err := g.Query(q)
+	if !assert.NoError(t, err, q) {
+		t.FailNow()
+	}
+	return result
+}
+
+// Returns the values of the result, one slice per record.
+func values(result *rg2.QueryResult) [][]interface{} {
+	rows := [][]interface{}{}
+	for result.Next() {
+		rows = append(rows, result.Record().Values())
+	}
+	return rows
+}
+
+// Graph with a cluster, two pods and a subscription, created like the aggregator does.
+func newTestGraph(t *testing.T) *Graph {
+	g := New()
+	mustQuery(t, g, "MERGE (c:Cluster {name: 'c1', kind: 'cluster'}) SET c.status = 'OK'")
+	mustQuery(t, g, "MATCH (c:Cluster {name: 'c1'})CREATE (:Pod {_uid:'pod1', kind:'pod', cluster:'c1', "+
+		"name:'a', namespace:'ns', restarts:3, container:['x', 'y']})-[:inCluster {_interCluster: true}]->(c), "+
+		"(:Pod {_uid:'pod2', kind:'pod', cluster:'c1', name:'b', namespace:'ns', restarts:0})-[:inCluster "+
+		"{_interCluster: true}]->(c), (:Subscription {_uid:'sub1', kind:'subscription', cluster:'local-cluster', "+
+		"name:'s', namespace:'apps'})-[:inCluster {_interCluster: true}]->(c)")
+	return g
+}
+
+func TestCreateAndMatch(t *testing.T) {
+	g := newTestGraph(t)
+
+	result := mustQuery(t, g, "MATCH (n {cluster: 'c1'}) RETURN n")
+	rows := values(result)
+	assert.Len(t, rows, 2)
+	pod := rows[0][0].(*rg2.Node)
+	assert.Equal(t, "Pod", pod.Label)
+	assert.Equal(t, "pod1", pod.Properties["_uid"])
+	assert.Equal(t, 3, pod.Properties["restarts"])
+	assert.Equal(t, []interface{}{"x", "y"}, pod.Properties["container"])
+
+	result = mustQuery(t, g, "MATCH (n:Pod) RETURN n._uid, n.restarts, n.missing")
+	assert.Equal(t, [][]interface{}{{"pod1", 3, nil}, {"pod2", 0, nil}}, values(result))
+}
+
+func TestStatistics(t *testing.T) {
+	g := New()
+	result := mustQuery(t, g, "CREATE (:Pod {_uid:'a', name:'a'})-[:ownedBy]->(:Deployment {_uid:'b'})")
+	assert.Equal(t, 2, result.NodesCreated())
+	assert.Equal(t, 1, result.RelationshipsCreated())
+	assert.Equal(t, 3, result.PropertiesSet())
+	assert.Equal(t, 2, result.LabelsAdded())
+
+	result = mustQuery(t, g, "MATCH (n {_uid:'a'}) DELETE n")
+	assert.Equal(t, 1, result.NodesDeleted())
+	assert.Equal(t, 1, result.RelationshipsDeleted())
+
+	result = mustQuery(t, g, "MATCH ()-[e]->() RETURN count(e)")
+	assert.Equal(t, [][]interface{}{{0}}, values(result))
+}
+
+func TestCount(t *testing.T) {
+	g := newTestGraph(t)
+	assert.Equal(t, [][]interface{}{{1}}, values(mustQuery(t, g, "MATCH (c:Cluster) RETURN count(c)")))
+	assert.Equal(t, [][]interface{}{{1}}, values(mustQuery(t, g, "MATCH (c:Cluster {name:'c1'}) RETURN count(c)")))
+	assert.Equal(t, [][]interface{}{{0}}, values(mustQuery(t, g, "MATCH (c:Cluster {name:'c2'}) RETURN count(c)")))
+	assert.Equal(t, [][]interface{}{{3}}, values(mustQuery(t, g, "MATCH ()-[e:inCluster]->() RETURN count(e)")))
+}
+
+func TestMergeAndSet(t *testing.T) {
+	g := newTestGraph(t)
+	result := mustQuery(t, g, "MERGE (c:Cluster {name: 'c1', kind: 'cluster'}) SET c.status = 'Offline', "+
+		"c.kubernetesVersion = 'v1.24'")
+	assert.Equal(t, 0, result.NodesCreated())
+	assert.Equal(t, 2, result.PropertiesSet())
+
+	mustQuery(t, g, "MATCH (n0:Pod {_uid: 'pod1'}), (n1:Pod {_uid: 'pod2'}) SET n0.restarts=4, n0.label=['a'], "+
+		"n1.name='c'")
+	assert.Equal(t, [][]interface{}{{"Offline", "v1.24"}},
+		values(mustQuery(t, g, "MATCH (c:Cluster {name: 'c1'}) RETURN c.status, c.kubernetesVersion")))
+	assert.Equal(t, [][]interface{}{{4, []interface{}{"a"}}, {0, nil}},
+		values(mustQuery(t, g, "MATCH (n:Pod) RETURN n.restarts, n.label")))
+	assert.Equal(t, [][]interface{}{{"c"}}, values(mustQuery(t, g, "MATCH (n {_uid:'pod2'}) RETURN n.name")))
+}
+
+func TestEdgePatterns(t *testing.T) {
+	g := newTestGraph(t)
+	// insertEdge
+	result := mustQuery(t, g, "MATCH (s {_uid: 'pod1'}), (d) WHERE d._uid='pod2' OR d._uid='sub1' "+
+		"CREATE (s)-[:usedBy]->(d)")
+	assert.Equal(t, 2, result.RelationshipsCreated())
+	mustQuery(t, g, "MATCH (s:Pod {_uid: 'pod2'}), (d:Pod) WHERE d._uid='pod1' CREATE (s)-[:usedBy]->(d)")
+
+	result = mustQuery(t, g, "MATCH (s {cluster:'c1'})-[r]->(d {cluster:'c1'}) WHERE (r._interCluster <> true) "+
+		"OR (r._interCluster IS NULL) RETURN s._uid, type(r), d._uid")
+	assert.Equal(t, [][]interface{}{{"pod1", "usedBy", "pod2"}, {"pod2", "usedBy", "pod1"}}, values(result))
+
+	// deleteEdgeQuery
+	result = mustQuery(t, g, "MATCH (s0:Pod {_uid: 'pod1'})-[e0:usedBy]->(d0:Pod {_uid: 'pod2'}), "+
+		"(s1:Pod {_uid: 'pod2'})-[e1:usedBy]->(d1:Pod {_uid: 'pod1'}) DELETE e0, e1")
+	assert.Equal(t, 2, result.RelationshipsDeleted())
+	assert.Equal(t, [][]interface{}{{1}}, values(mustQuery(t, g, "MATCH ()-[e:usedBy]->() RETURN count(e)")))
+}
+
+func TestDuplicateEdges(t *testing.T) {
+	g := newTestGraph(t)
+	for i := 0; i < 3; i++ {
+		mustQuery(t, g, "MATCH (s {_uid: 'pod1'}), (d {_uid: 'pod2'}) CREATE (s)-[:usedBy]->(d)")
+	}
+	result := mustQuery(t, g, "MATCH (s {cluster:'c1'})-[r]->(d {cluster:'c1'}) WHERE (r._interCluster <> true) "+
+		"OR (r._interCluster IS NULL) WITH s as source, d as dest, TYPE(r) as edge, COLLECT (r) AS edges "+
+		"WHERE size(edges) >1 UNWIND edges[1..] AS dupedges DELETE dupedges")
+	assert.Equal(t, 2, result.RelationshipsDeleted())
+	assert.Equal(t, [][]interface{}{{1}}, values(mustQuery(t, g, "MATCH ()-[e:usedBy]->() RETURN count(e)")))
+}
+
+func TestInterClusterEdges(t *testing.T) {
+	g := newTestGraph(t)
+	mustQuery(t, g, "CREATE (:Subscription {_uid:'sub2', kind:'subscription', cluster:'c1', "+
+		"_hostingSubscription:'apps/s'})")
+
+	result := mustQuery(t, g, "MATCH (n:Subscription) WHERE n.cluster <> 'local-cluster' "+
+		"RETURN n._uid, n._hostingSubscription")
+	assert.Equal(t, [][]interface{}{{"sub2", "apps/s"}}, values(result))
+	result = mustQuery(t, g, "MATCH (n:Subscription) WHERE  n.cluster='local-cluster' "+
+		"RETURN n._uid, n.namespace+'/'+n.name")
+	assert.Equal(t, [][]interface{}{{"sub1", "apps/s"}}, values(result))
+	assert.Equal(t, []string{"n._uid", "n.namespace+'/'+n.name"}, result.Record().Keys())
+
+	mustQuery(t, g, "MATCH (hubSub:Subscription {_uid:'sub1'}), (remoteSub:Subscription {_uid:'sub2'}) "+
+		"CREATE (remoteSub)-[:hostedSub {_interCluster: true,app_instance: 1}]->(hubSub)")
+	result = mustQuery(t, g, "MATCH ()-[e {_interCluster:true}]->() WHERE (type(e)='hostedSub' OR "+
+		"type(e)='deployedBy') AND e.app_instance<>2 DELETE e")
+	assert.Equal(t, 1, result.RelationshipsDeleted())
+}
+
+func TestDeleteNodes(t *testing.T) {
+	g := newTestGraph(t)
+	result := mustQuery(t, g, "MATCH (n) WHERE (n._uid='pod1' OR n._uid='missing') DELETE n")
+	assert.Equal(t, 1, result.NodesDeleted())
+
+	result = mustQuery(t, g, "MATCH (n {cluster:'c1'}) DELETE n")
+	assert.Equal(t, 1, result.NodesDeleted())
+	assert.Equal(t, [][]interface{}{{[]interface{}{"Cluster"}}, {[]interface{}{"Subscription"}}},
+		values(mustQuery(t, g, "MATCH (n) RETURN distinct labels(n)")))
+	// A node deleted by _uid can be created again.
+	mustQuery(t, g, "CREATE (:Pod {_uid:'pod1'})")
+	assert.Equal(t, [][]interface{}{{1}}, values(mustQuery(t, g, "MATCH (n {_uid:'pod1'}) RETURN count(n)")))
+}
+
+func TestIndexes(t *testing.T) {
+	g := New()
+	assert.Equal(t, 1, mustQuery(t, g, "CREATE INDEX ON :Pod(_uid)").IndicesCreated())
+	assert.Equal(t, 0, mustQuery(t, g, "CREATE INDEX ON :Pod(_uid)").IndicesCreated())
+}
+
+func TestParameters(t *testing.T) {
+	g := New()
+	mustQuery(t, g, "CYPHER uid='a' list=['x', 1] UNWIND [1, 2] AS i CREATE (:Pod {_uid: $uid + i, l: $list})")
+	assert.Equal(t, [][]interface{}{{"a1", []interface{}{"x", 1}}, {"a2", []interface{}{"x", 1}}},
+		values(mustQuery(t, g, "MATCH (n:Pod) RETURN n._uid, n.l")))
+}
+
+func TestStringEscapes(t *testing.T) {
+	g := New()
+	mustQuery(t, g, `CREATE (:Pod {_uid:'a', name:'it\'s a \\ "test"'})`)
+	assert.Equal(t, [][]interface{}{{`it's a \ "test"`}}, values(mustQuery(t, g, "MATCH (n:Pod) RETURN n.name")))
+}
+
+func TestQueryErrors(t *testing.T) {
+	g := newTestGraph(t)
+	for _, q := range []string{
+		"MATCH (n RETURN n",
+		"MATCH (n) RETURN m",
+		"CREATE (:Pod {name: 'unterminated})",
+		"DROP (n)",
+		"CREATE (:Pod {m: {a: 1}})",
+	} {
+		_, err := g.Query(q)
+		assert.Error(t, err, q)
+		assert.IsType(t, redis.Error(""), err, q)
+	}
+}
+
+func TestConn(t *testing.T) {
+	g := New()
+	c := g.Conn()
+
+	pong, err := redis.String(c.Do("PING"))
+	assert.NoError(t, err)
+	assert.Equal(t, "PONG", pong)
+
+	keyType, _ := redis.String(c.Do("TYPE", graphName))
+	assert.Equal(t, "none", keyType)
+	mustQuery(t, g, "CREATE (:Pod {_uid:'a'})")
+	keyType, _ = redis.String(c.Do("TYPE", graphName))
+	assert.Equal(t, "graphdata", keyType)
+
+	_, err = c.Do("GRAPH.DELETE", graphName)
+	assert.NoError(t, err)
+	keyType, _ = redis.String(c.Do("TYPE", graphName))
+	assert.Equal(t, "none", keyType)
+
+	_, err = c.Do("FLUSHALL")
+	assert.Error(t, err)
+	assert.NoError(t, c.Close())
+	_, err = c.Do("PING")
+	assert.Error(t, err)
+}
+
+func TestDuplicateUIDs(t *testing.T) {
+	g := New()
+	mustQuery(t, g, "CREATE (:Pod {_uid:'a', cluster:'c1'}), (:Pod {_uid:'a', cluster:'c1'})")
+	assert.Equal(t, [][]interface{}{{2}}, values(mustQuery(t, g, "MATCH (n {_uid:'a'}) RETURN count(n)")))
+	assert.Equal(t, 2, mustQuery(t, g, "MATCH (n {_uid:'a'}) DELETE n").NodesDeleted())
+}
+
+func TestUnwindBatch(t *testing.T) {
+	g := newTestGraph(t)
+	result := mustQuery(t, g, "CYPHER p0='c1' p1=[{_uid: 'dep1', name: 'd1', replicas: 2}, {_uid: 'dep2', name: 'd2'}] "+
+		"MATCH (c:Cluster {name: $p0}) UNWIND $p1 AS r CREATE (:Deployment {_uid: r._uid, name: r.name, "+
+		"replicas: r.replicas})-[:inCluster {_interCluster: true}]->(c)")
+	assert.Equal(t, 2, result.NodesCreated())
+	assert.Equal(t, 7, result.PropertiesSet(), "Null values aren't stored.")
+
+	mustQuery(t, g, "CYPHER p0=[{_uid: 'dep1', name: 'new'}, {_uid: 'dep2', replicas: 3}] UNWIND $p0 AS r "+
+		"MATCH (n:Deployment {_uid: r._uid}) SET n.name=coalesce(r.name, n.name), "+
+		"n.replicas=coalesce(r.replicas, n.replicas)")
+	result = mustQuery(t, g, "MATCH (n:Deployment) RETURN n._uid, n.name, n.replicas")
+	assert.Equal(t, [][]interface{}{{"dep1", "new", 2}, {"dep2", "d2", 3}}, values(result))
+}
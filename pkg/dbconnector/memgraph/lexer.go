@@ -0,0 +1,159 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenInt
+	tokenFloat
+	tokenParam
+	tokenPunct
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // Identifier name, unquoted string, number or punctuation.
+	start int    // Offset in the query, used to name the returned columns.
+	end   int
+}
+
+// Punctuation, longest first so that "->" is matched before "-".
+var punctuation = []string{"->", "<-", "<>", "<=", ">=", "..", "(", ")", "[", "]", "{", "}", ":", ",", ".", "=",
+	"<", ">", "-", "+", "*", "/", "|"}
+
+// Splits a query into tokens.
+func tokenize(query string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(query)
+	offsets := make([]int, len(runes)+1) // Byte offset of each rune, to slice the query.
+	offset := 0
+	for i, r := range runes {
+		offsets[i] = offset
+		offset += len(string(r))
+	}
+	offsets[len(runes)] = offset
+
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"':
+			text, next, err := readString(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, start: offsets[i], end: offsets[next]})
+			i = next
+		case r == '`':
+			end := i + 1
+			for end < len(runes) && runes[end] != '`' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quoted identifier at offset %d", offsets[i])
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[i+1 : end]), start: offsets[i],
+				end: offsets[end+1]})
+			i = end + 1
+		case unicode.IsDigit(r):
+			end := i
+			for end < len(runes) && unicode.IsDigit(runes[end]) {
+				end++
+			}
+			kind := tokenInt
+			// A dot is a decimal point only when a digit follows, "1..2" is a range.
+			if end+1 < len(runes) && runes[end] == '.' && unicode.IsDigit(runes[end+1]) {
+				kind = tokenFloat
+				end++
+				for end < len(runes) && unicode.IsDigit(runes[end]) {
+					end++
+				}
+			}
+			tokens = append(tokens, token{kind: kind, text: string(runes[i:end]), start: offsets[i], end: offsets[end]})
+			i = end
+		case r == '$' || r == '_' || unicode.IsLetter(r):
+			end := i + 1
+			for end < len(runes) && (runes[end] == '_' || unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+				end++
+			}
+			tok := token{kind: tokenIdent, text: string(runes[i:end]), start: offsets[i], end: offsets[end]}
+			if r == '$' {
+				if end == i+1 {
+					return nil, fmt.Errorf("missing parameter name at offset %d", offsets[i])
+				}
+				tok.kind = tokenParam
+				tok.text = string(runes[i+1 : end])
+			}
+			tokens = append(tokens, tok)
+			i = end
+		default:
+			matched := false
+			for _, p := range punctuation {
+				if strings.HasPrefix(string(runes[i:min(i+len(p), len(runes))]), p) {
+					tokens = append(tokens, token{kind: tokenPunct, text: p, start: offsets[i], end: offsets[i+len(p)]})
+					i += len(p)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", r, offsets[i])
+			}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, start: offset, end: offset})
+	return tokens, nil
+}
+
+// Reads a quoted string starting at runes[start]. Returns the unescaped string and the index after the closing quote.
+func readString(runes []rune, start int) (string, int, error) {
+	quote := runes[start]
+	var sb strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			if i+1 == len(runes) {
+				return "", 0, fmt.Errorf("unterminated string starting at %d", start)
+			}
+			i++
+			switch runes[i] {
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			case 'r':
+				sb.WriteRune('\r')
+			case '\\', '\'', '"':
+				sb.WriteRune(runes[i])
+			default: // Unknown escapes are kept as they are.
+				sb.WriteRune('\\')
+				sb.WriteRune(runes[i])
+			}
+		case quote:
+			return sb.String(), i + 1, nil
+		default:
+			sb.WriteRune(runes[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string starting at %d", start)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,717 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parsed query, a list of clauses executed in order.
+type query struct {
+	params  map[string]expr // From the CYPHER header of a parameterized query.
+	clauses []clause
+}
+
+type clause interface{}
+
+type matchClause struct {
+	patterns []pathPattern
+	where    expr
+}
+
+type createClause struct {
+	patterns []pathPattern
+}
+
+type mergeClause struct {
+	pattern pathPattern
+}
+
+type setClause struct {
+	items []setItem
+}
+
+// Sets a property, or all the properties when property is empty (n = {map} or n += {map}).
+type setItem struct {
+	variable string
+	property string
+	value    expr
+	merge    bool // n += {map} keeps the properties that aren't in the map.
+}
+
+type deleteClause struct {
+	exprs []expr
+}
+
+type withClause struct {
+	projection projection
+	where      expr
+}
+
+type unwindClause struct {
+	list     expr
+	variable string
+}
+
+type returnClause struct {
+	projection projection
+}
+
+type createIndexClause struct {
+	label    string
+	property string
+}
+
+type callClause struct {
+	procedure string
+}
+
+type projection struct {
+	distinct bool
+	items    []projectionItem
+}
+
+type projectionItem struct {
+	expr expr
+	name string // Alias, or the text of the expression.
+}
+
+type pathPattern struct {
+	nodes []nodePattern
+	rels  []relPattern // rels[i] connects nodes[i] and nodes[i+1].
+}
+
+type nodePattern struct {
+	variable string
+	label    string
+	props    []propertyPair
+}
+
+type relPattern struct {
+	variable string
+	relType  string
+	props    []propertyPair
+	outgoing bool // (a)-[]->(b) when true, (a)<-[]-(b) when false.
+}
+
+type propertyPair struct {
+	key   string
+	value expr
+}
+
+type parser struct {
+	query  string
+	tokens []token
+	pos    int
+}
+
+// Parses the subset of Cypher used by the aggregator.
+func parse(q string) (*query, error) {
+	tokens, err := tokenize(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{query: q, tokens: tokens}
+	result := &query{params: map[string]expr{}}
+
+	if p.acceptKeyword("CYPHER") {
+		for p.peek().kind == tokenIdent && !isClauseKeyword(p.peek().text) {
+			name := p.next().text
+			if err = p.expectPunct("="); err != nil {
+				return nil, err
+			}
+			value, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			result.params[name] = value
+		}
+	}
+
+	for p.peek().kind != tokenEOF {
+		c, err := p.parseClause()
+		if err != nil {
+			return nil, err
+		}
+		result.clauses = append(result.clauses, c)
+	}
+	if len(result.clauses) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	return result, nil
+}
+
+func isClauseKeyword(word string) bool {
+	switch strings.ToUpper(word) {
+	case "MATCH", "CREATE", "MERGE", "SET", "DELETE", "DETACH", "WITH", "UNWIND", "RETURN", "CALL", "WHERE":
+		return true
+	}
+	return false
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && strings.EqualFold(t.text, word)
+}
+
+func (p *parser) acceptKeyword(word string) bool {
+	if p.isKeyword(word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(word string) error {
+	if !p.acceptKeyword(word) {
+		return p.errorf("expected %s", word)
+	}
+	return nil
+}
+
+func (p *parser) isPunct(punct string) bool {
+	t := p.peek()
+	return t.kind == tokenPunct && t.text == punct
+}
+
+func (p *parser) acceptPunct(punct string) bool {
+	if p.isPunct(punct) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectPunct(punct string) error {
+	if !p.acceptPunct(punct) {
+		return p.errorf("expected '%s'", punct)
+	}
+	return nil
+}
+
+func (p *parser) expectIdent() (string, error) {
+	t := p.peek()
+	if t.kind != tokenIdent {
+		return "", p.errorf("expected a name")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	found := t.text
+	if t.kind == tokenEOF {
+		found = "end of query"
+	}
+	return fmt.Errorf("%s at offset %d, found '%s'", fmt.Sprintf(format, args...), t.start, found)
+}
+
+func (p *parser) parseClause() (clause, error) {
+	switch {
+	case p.acceptKeyword("MATCH"):
+		patterns, err := p.parsePatterns()
+		if err != nil {
+			return nil, err
+		}
+		c := &matchClause{patterns: patterns}
+		if p.acceptKeyword("WHERE") {
+			if c.where, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+		return c, nil
+	case p.isKeyword("CREATE") && p.tokens[p.pos+1].kind == tokenIdent && strings.EqualFold(p.tokens[p.pos+1].text, "INDEX"):
+		p.pos += 2
+		if err := p.expectKeyword("ON"); err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		label, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		property, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		return &createIndexClause{label: label, property: property}, p.expectPunct(")")
+	case p.acceptKeyword("CREATE"):
+		patterns, err := p.parsePatterns()
+		return &createClause{patterns: patterns}, err
+	case p.acceptKeyword("MERGE"):
+		pattern, err := p.parsePattern()
+		return &mergeClause{pattern: pattern}, err
+	case p.acceptKeyword("SET"):
+		return p.parseSet()
+	case p.acceptKeyword("DETACH"), p.isKeyword("DELETE"):
+		if err := p.expectKeyword("DELETE"); err != nil {
+			return nil, err
+		}
+		c := &deleteClause{}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			c.exprs = append(c.exprs, e)
+			if !p.acceptPunct(",") {
+				return c, nil
+			}
+		}
+	case p.acceptKeyword("WITH"):
+		proj, err := p.parseProjection()
+		if err != nil {
+			return nil, err
+		}
+		c := &withClause{projection: proj}
+		if p.acceptKeyword("WHERE") {
+			if c.where, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+		return c, nil
+	case p.acceptKeyword("UNWIND"):
+		list, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("AS"); err != nil {
+			return nil, err
+		}
+		variable, err := p.expectIdent()
+		return &unwindClause{list: list, variable: variable}, err
+	case p.acceptKeyword("RETURN"):
+		proj, err := p.parseProjection()
+		return &returnClause{projection: proj}, err
+	case p.acceptKeyword("CALL"):
+		var name []string
+		for {
+			part, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			name = append(name, part)
+			if !p.acceptPunct(".") {
+				break
+			}
+		}
+		if err := p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		return &callClause{procedure: strings.Join(name, ".")}, p.expectPunct(")")
+	default:
+		return nil, p.errorf("unsupported clause")
+	}
+}
+
+func (p *parser) parseSet() (clause, error) {
+	c := &setClause{}
+	for {
+		variable, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		item := setItem{variable: variable}
+		if p.acceptPunct(".") {
+			if item.property, err = p.expectIdent(); err != nil {
+				return nil, err
+			}
+			if err = p.expectPunct("="); err != nil {
+				return nil, err
+			}
+		} else if p.acceptPunct("+") {
+			item.merge = true
+			if err = p.expectPunct("="); err != nil {
+				return nil, err
+			}
+		} else if err = p.expectPunct("="); err != nil {
+			return nil, err
+		}
+		if item.value, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		c.items = append(c.items, item)
+		if !p.acceptPunct(",") {
+			return c, nil
+		}
+	}
+}
+
+func (p *parser) parseProjection() (projection, error) {
+	proj := projection{distinct: p.acceptKeyword("DISTINCT")}
+	for {
+		start := p.peek().start
+		e, err := p.parseExpr()
+		if err != nil {
+			return proj, err
+		}
+		item := projectionItem{expr: e, name: strings.TrimSpace(p.query[start:p.tokens[p.pos-1].end])}
+		if p.acceptKeyword("AS") {
+			if item.name, err = p.expectIdent(); err != nil {
+				return proj, err
+			}
+		}
+		proj.items = append(proj.items, item)
+		if !p.acceptPunct(",") {
+			return proj, nil
+		}
+	}
+}
+
+func (p *parser) parsePatterns() ([]pathPattern, error) {
+	var patterns []pathPattern
+	for {
+		pattern, err := p.parsePattern()
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+		if !p.acceptPunct(",") {
+			return patterns, nil
+		}
+	}
+}
+
+func (p *parser) parsePattern() (pathPattern, error) {
+	var pattern pathPattern
+	n, err := p.parseNodePattern()
+	if err != nil {
+		return pattern, err
+	}
+	pattern.nodes = append(pattern.nodes, n)
+	for p.isPunct("-") || p.isPunct("<-") {
+		rel := relPattern{outgoing: p.next().text == "-"}
+		if err = p.expectPunct("["); err != nil {
+			return pattern, err
+		}
+		if p.peek().kind == tokenIdent {
+			rel.variable = p.next().text
+		}
+		if p.acceptPunct(":") {
+			if rel.relType, err = p.expectIdent(); err != nil {
+				return pattern, err
+			}
+		}
+		if p.isPunct("{") {
+			if rel.props, err = p.parsePropertyMap(); err != nil {
+				return pattern, err
+			}
+		}
+		if err = p.expectPunct("]"); err != nil {
+			return pattern, err
+		}
+		if rel.outgoing {
+			err = p.expectPunct("->")
+		} else {
+			err = p.expectPunct("-")
+		}
+		if err != nil {
+			return pattern, err
+		}
+		if n, err = p.parseNodePattern(); err != nil {
+			return pattern, err
+		}
+		pattern.rels = append(pattern.rels, rel)
+		pattern.nodes = append(pattern.nodes, n)
+	}
+	return pattern, nil
+}
+
+func (p *parser) parseNodePattern() (nodePattern, error) {
+	var n nodePattern
+	var err error
+	if err = p.expectPunct("("); err != nil {
+		return n, err
+	}
+	if p.peek().kind == tokenIdent {
+		n.variable = p.next().text
+	}
+	if p.acceptPunct(":") {
+		if n.label, err = p.expectIdent(); err != nil {
+			return n, err
+		}
+	}
+	if p.isPunct("{") {
+		if n.props, err = p.parsePropertyMap(); err != nil {
+			return n, err
+		}
+	}
+	return n, p.expectPunct(")")
+}
+
+func (p *parser) parsePropertyMap() ([]propertyPair, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	pairs := []propertyPair{}
+	if p.acceptPunct("}") {
+		return pairs, nil
+	}
+	for {
+		key, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, propertyPair{key: key, value: value})
+		if !p.acceptPunct(",") {
+			return pairs, p.expectPunct("}")
+		}
+	}
+}
+
+// Expressions, from the lowest precedence: OR, AND, NOT, comparison, addition, postfix and atoms.
+
+func (p *parser) parseExpr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.acceptKeyword("NOT") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.acceptKeyword("IS"):
+			negate := p.acceptKeyword("NOT")
+			if err = p.expectKeyword("NULL"); err != nil {
+				return nil, err
+			}
+			left = &isNullExpr{operand: left, negate: negate}
+		case p.acceptKeyword("IN"):
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			left = &inExpr{item: left, list: right}
+		case p.isPunct("=") || p.isPunct("<>") || p.isPunct("<") || p.isPunct(">") || p.isPunct("<=") ||
+			p.isPunct(">="):
+			op := p.next().text
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			left = &comparisonExpr{op: op, left: left, right: right}
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("+") || p.isPunct("-") {
+		op := p.next().text
+		right, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmeticExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parsePostfix() (expr, error) {
+	e, err := p.parseAtom()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.acceptPunct("."):
+			key, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			e = &propertyExpr{target: e, key: key}
+		case p.acceptPunct("["):
+			var from, to expr
+			if !p.isPunct("..") {
+				if from, err = p.parseExpr(); err != nil {
+					return nil, err
+				}
+			}
+			if p.acceptPunct("..") {
+				if !p.isPunct("]") {
+					if to, err = p.parseExpr(); err != nil {
+						return nil, err
+					}
+				}
+				e = &sliceExpr{target: e, from: from, to: to}
+			} else {
+				e = &indexExpr{target: e, index: from}
+			}
+			if err = p.expectPunct("]"); err != nil {
+				return nil, err
+			}
+		default:
+			return e, nil
+		}
+	}
+}
+
+func (p *parser) parseAtom() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenString:
+		p.pos++
+		return &literalExpr{value: t.text}, nil
+	case tokenInt:
+		p.pos++
+		value, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &literalExpr{value: value}, nil
+	case tokenFloat:
+		p.pos++
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &literalExpr{value: value}, nil
+	case tokenParam:
+		p.pos++
+		return &paramExpr{name: t.text}, nil
+	case tokenPunct:
+		switch t.text {
+		case "-": // Negative number.
+			p.pos++
+			operand, err := p.parsePostfix()
+			if err != nil {
+				return nil, err
+			}
+			return &arithmeticExpr{op: "-", left: &literalExpr{value: int64(0)}, right: operand}, nil
+		case "(":
+			p.pos++
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expectPunct(")")
+		case "[":
+			p.pos++
+			list := &listExpr{}
+			if p.acceptPunct("]") {
+				return list, nil
+			}
+			for {
+				item, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if !p.acceptPunct(",") {
+					return list, p.expectPunct("]")
+				}
+			}
+		case "{":
+			pairs, err := p.parsePropertyMap()
+			if err != nil {
+				return nil, err
+			}
+			return &mapExpr{pairs: pairs}, nil
+		}
+	case tokenIdent:
+		p.pos++
+		switch strings.ToUpper(t.text) {
+		case "TRUE":
+			return &literalExpr{value: true}, nil
+		case "FALSE":
+			return &literalExpr{value: false}, nil
+		case "NULL":
+			return &literalExpr{value: nil}, nil
+		}
+		if !p.acceptPunct("(") {
+			return &variableExpr{name: t.text}, nil
+		}
+		call := &functionExpr{name: strings.ToLower(t.text)}
+		call.distinct = p.acceptKeyword("DISTINCT")
+		if p.acceptPunct("*") {
+			call.star = true
+			return call, p.expectPunct(")")
+		}
+		if p.acceptPunct(")") {
+			return call, nil
+		}
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if !p.acceptPunct(",") {
+				return call, p.expectPunct(")")
+			}
+		}
+	}
+	return nil, p.errorf("unexpected token")
+}
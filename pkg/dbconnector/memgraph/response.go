@@ -0,0 +1,117 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package memgraph
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Types in the RedisGraph compact response format.
+const (
+	columnScalar = 1
+
+	valueNull    = 1
+	valueString  = 2
+	valueInteger = 3
+	valueBoolean = 4
+	valueDouble  = 5
+	valueArray   = 6
+	valueEdge    = 7
+	valueNode    = 8
+)
+
+// Builds the response of GRAPH.QUERY --compact: [header, records, statistics], or [statistics] when the query
+// doesn't return anything.
+func (x *executor) response() []interface{} {
+	stats := x.statistics()
+	if x.columns == nil {
+		return []interface{}{stats}
+	}
+	header := make([]interface{}, len(x.columns))
+	for i, name := range x.columns {
+		header[i] = []interface{}{int64(columnScalar), name}
+	}
+	records := make([]interface{}, len(x.records))
+	for i, record := range x.records {
+		cells := make([]interface{}, len(record))
+		for j, value := range record {
+			cells[j] = x.encodeScalar(value)
+		}
+		records[i] = cells
+	}
+	return []interface{}{header, records, stats}
+}
+
+func (x *executor) statistics() []interface{} {
+	counters := []struct {
+		name  string
+		value int
+	}{
+		{"Labels added", x.stats.labelsAdded},
+		{"Nodes created", x.stats.nodesCreated},
+		{"Properties set", x.stats.propertiesSet},
+		{"Relationships created", x.stats.relationshipsCreated},
+		{"Nodes deleted", x.stats.nodesDeleted},
+		{"Relationships deleted", x.stats.relationshipsDeleted},
+		{"Indices created", x.stats.indicesCreated},
+	}
+	stats := []interface{}{}
+	for _, counter := range counters {
+		if counter.value > 0 {
+			stats = append(stats, fmt.Sprintf("%s: %d", counter.name, counter.value))
+		}
+	}
+	return append(stats, "Query internal execution time: 0.000000 milliseconds")
+}
+
+// Encodes a value as [type, value].
+func (x *executor) encodeScalar(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return []interface{}{int64(valueNull), nil}
+	case string:
+		return []interface{}{int64(valueString), v}
+	case int64:
+		return []interface{}{int64(valueInteger), v}
+	case bool:
+		return []interface{}{int64(valueBoolean), []byte(strconv.FormatBool(v))}
+	case float64:
+		return []interface{}{int64(valueDouble), []byte(strconv.FormatFloat(v, 'f', -1, 64))}
+	case []interface{}:
+		elements := make([]interface{}, len(v))
+		for i, element := range v {
+			elements[i] = x.encodeScalar(element)
+		}
+		return []interface{}{int64(valueArray), elements}
+	case *node:
+		labels := []interface{}{}
+		if v.label != "" {
+			labels = append(labels, int64(x.g.labels.index[v.label]))
+		}
+		return []interface{}{int64(valueNode), []interface{}{v.id, labels, x.encodeProperties(v.props)}}
+	case *edge:
+		return []interface{}{int64(valueEdge), []interface{}{v.id, int64(x.g.relationshipTypes.index[v.relType]),
+			v.src.id, v.dst.id, x.encodeProperties(v.props)}}
+	default:
+		// Maps can't be stored or returned by the client library, return them as strings.
+		return []interface{}{int64(valueString), fmt.Sprintf("%v", v)}
+	}
+}
+
+// Encodes properties as [[key index, type, value], ...].
+func (x *executor) encodeProperties(props map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	encoded := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		encoded = append(encoded, append([]interface{}{int64(x.g.propertyKeys.index[key])},
+			x.encodeScalar(props[key])...))
+	}
+	return encoded
+}
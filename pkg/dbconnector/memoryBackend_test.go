@@ -0,0 +1,77 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"testing"
+
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stolostron/search-aggregator/pkg/dbconnector/memgraph"
+	"github.com/stretchr/testify/assert"
+)
+
+// Runs the queries built by this package against the in-memory graph.
+func TestMemoryBackend(t *testing.T) {
+	previousStore := Store
+	Store = memgraph.New()
+	defer func() { Store = previousStore }()
+	// Returns the first value of the first record, the result of count().
+	count := func(result *rg2.QueryResult, err error) int {
+		t.Helper()
+		assert.NoError(t, err)
+		if !result.Next() {
+			t.Fatal("count() didn't return a record")
+		}
+		return result.Record().GetByIndex(0).(int)
+	}
+
+	_, err := MergeDummyCluster("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count(TotalClusters()))
+
+	resources := []*Resource{
+		{Kind: "Pod", UID: "c1/pod1", Properties: map[string]interface{}{"kind": "Pod", "cluster": "c1",
+			"name": "pod1", "namespace": "ns", "restarts": int64(2), "container": []interface{}{"a", "b"}}},
+		{Kind: "Pod", UID: "c1/pod2", Properties: map[string]interface{}{"kind": "Pod", "cluster": "c1",
+			"name": "pod2", "namespace": "ns"}},
+		{Kind: "Deployment", UID: "c1/dep1", Properties: map[string]interface{}{"kind": "Deployment",
+			"cluster": "c1", "name": "dep1", "namespace": "ns"}},
+	}
+	insertResult := ChunkedInsert(context.Background(), resources, "c1")
+	assert.NoError(t, insertResult.ConnectionError)
+	assert.Empty(t, insertResult.ResourceErrors)
+	assert.Equal(t, 3, count(TotalNodes("c1")))
+
+	edges := []Edge{
+		{SourceUID: "c1/pod1", DestUID: "c1/dep1", EdgeType: "ownedBy", SourceKind: "Pod", DestKind: "Deployment"},
+		{SourceUID: "c1/pod2", DestUID: "c1/dep1", EdgeType: "ownedBy", SourceKind: "Pod", DestKind: "Deployment"},
+	}
+	edgeResult := ChunkedInsertEdge(context.Background(), edges, "c1")
+	assert.Empty(t, edgeResult.ResourceErrors)
+	assert.Equal(t, 2, edgeResult.EdgesAdded)
+	assert.Equal(t, 2, count(TotalIntraEdges("c1")))
+
+	updateResult := ChunkedUpdate(context.Background(), []*Resource{{Kind: "Pod", UID: "c1/pod1", Properties: map[string]interface{}{
+		"kind": "Pod", "cluster": "c1", "name": "pod1", "namespace": "ns", "restarts": int64(3)}}})
+	assert.Empty(t, updateResult.ResourceErrors)
+	result, err := Store.Query("MATCH (n {_uid:'c1/pod1'}) RETURN n.restarts")
+	assert.NoError(t, err)
+	assert.True(t, result.Next())
+	assert.Equal(t, 3, result.Record().GetByIndex(0))
+
+	deleteEdgeResult := ChunkedDeleteEdge(context.Background(), edges[:1], "c1")
+	assert.Empty(t, deleteEdgeResult.ResourceErrors)
+	assert.Equal(t, 1, count(TotalIntraEdges("c1")))
+
+	deleteResult := ChunkedDelete(context.Background(), []string{"c1/pod2"})
+	assert.Empty(t, deleteResult.ResourceErrors)
+	assert.Equal(t, 2, count(TotalNodes("c1")))
+	assert.Equal(t, 0, count(TotalIntraEdges("c1")))
+
+	_, err = DeleteCluster("c1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count(TotalNodes("c1")))
+	assert.Equal(t, 1, count(CheckClusterResource("c1")))
+}
@@ -12,20 +12,21 @@ Copyright (c) 2020 Red Hat, Inc.
 package dbconnector
 
 import (
-	"crypto/tls"
-	"crypto/x509"
-	"io/ioutil"
 	"net"
 	"time"
 
 	"github.com/golang/glog"
 	"github.com/gomodule/redigo/redis"
 	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stolostron/search-aggregator/pkg/dbconnector/memgraph"
 )
 
 // A global redis pool for other parts of this package to use
 var Pool *redis.Pool
 
+// In-memory graph used instead of Redis when DB_BACKEND is memory.
+var memoryGraph *memgraph.Graph
+
 const (
 	IDLE_TIMEOUT = 60 // ReadinessProbe runs every 30 seconds, this keeps the connection alive between probe intervals.
 	GRAPH_NAME   = "search-db"
@@ -42,82 +43,84 @@ func init() {
 		Wait:         true,
 	}
 	Store = RedisGraphStoreV2{}
-
+	if config.Cfg.DBBackend == "memory" {
+		glog.Warning("Using the in-memory graph (DB_BACKEND=memory). The data isn't persisted, use only for development.")
+		memoryGraph = memgraph.New()
+		Store = memoryGraph
+	} else if config.Cfg.CircuitBreakerThreshold > 0 {
+		storeBreaker = newCircuitBreaker(Store)
+		Store = storeBreaker
+	}
 }
 
 func getRedisConnection() (redis.Conn, error) {
-	var port string
-	var sslEnabled bool
+	return dialRedis(30*time.Second, 0)
+}
 
+// Dials a new connection to Redis. A readWriteTimeout of 0 means that commands don't time out.
+func dialRedis(connectTimeout, readWriteTimeout time.Duration) (redis.Conn, error) {
+	if memoryGraph != nil {
+		return memoryGraph.Conn(), nil
+	}
 	host := config.Cfg.RedisHost
+	port := config.Cfg.RedisPort
 	if config.Cfg.RedisSSHPort != "" {
 		port = config.Cfg.RedisSSHPort
-		sslEnabled = true
-	} else {
-		port = config.Cfg.RedisPort
-		sslEnabled = false
+	}
+	sslEnabled := redisTLSRequired()
+	var generation int64
+	if sentinelEnabled() {
+		address, masterGeneration, err := currentMaster.get()
+		if err != nil {
+			glog.Error("Error getting the Redis master from the sentinels. ", err)
+			return nil, err
+		}
+		if host, port, err = net.SplitHostPort(address); err != nil {
+			return nil, err
+		}
+		generation = masterGeneration
 	}
 
 	glog.V(2).Infof("Initializing Redis client with Host: %s, Port: %s, using SSL: %t", host, port, sslEnabled)
 
-	tlsconf := &tls.Config{
-		MinVersion:               tls.VersionTLS12,
-		CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
-		PreferServerCipherSuites: true,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-		},
-		// RootCAs: caCertPool,
-	}
-
-	// Attempt to add RootCAs to tlsconf.
-	caCert, certErr := ioutil.ReadFile("./rediscert/redis.crt")
-	if certErr != nil {
-		if sslEnabled {
-			// If REDIS_SSL_PORT was provided we assume that SSL is required.
-			glog.Error("REDIS_SSH_PORT is configured, but can't load cert. ", certErr)
-			return nil, certErr
-		} else {
-			glog.Warning("Using insecure Redis connection.")
-			glog.Warning("To enable SSL provide REDIS_SSL_PORT and ./rediscert/redis.crt")
-		}
-	} else {
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
-		tlsconf.RootCAs = caCertPool
+	tlsconf, err := redisTLSConfig(sslEnabled)
+	if err != nil {
+		return nil, err
 	}
 
 	redisConn, err := redis.Dial("tcp",
 		net.JoinHostPort(host, port),
 		redis.DialTLSConfig(tlsconf),
 		redis.DialUseTLS(sslEnabled),
-		redis.DialConnectTimeout(30*time.Second))
+		redis.DialConnectTimeout(connectTimeout),
+		redis.DialReadTimeout(readWriteTimeout),
+		redis.DialWriteTimeout(readWriteTimeout))
 	if err != nil {
 		glog.Error("Error connecting redis. Original error: ", err)
 		return nil, err
 	}
 
-	// If a password is provided, then use it to authenticate the Redis connection.
-	if config.Cfg.RedisPassword != "" {
-		glog.V(2).Info("Authenticating Redis client using password from REDIS_PASSWORD.")
-		if _, err := redisConn.Do("AUTH", config.Cfg.RedisPassword); err != nil {
-			glog.Error("Error authenticating Redis client. Original error: ", err)
-			connError := redisConn.Close()
-			if connError != nil {
-				glog.Warning("Failed to close redis connection. Original error: ", connError)
-			}
-			return nil, err
+	if err := authenticateRedis(redisConn); err != nil {
+		glog.Error("Error authenticating Redis client. Original error: ", err)
+		connError := redisConn.Close()
+		if connError != nil {
+			glog.Warning("Failed to close redis connection. Original error: ", connError)
 		}
-	} else {
-		glog.Warning("REDIS_PASSWORD wasn't provided. Attempting to communicate without authentication.")
+		return nil, err
 	}
 
+	if sentinelEnabled() {
+		return &masterConn{Conn: redisConn, generation: generation}, nil
+	}
 	return redisConn, nil
 }
 
-// Used by the pool to test if redis connections are still okay. If they have been idle for less than a minute,
-// just assumes they are okay. If not, calls PING.
+// Used by the pool to test if redis connections are still okay. Connections to a previous Sentinel master are
+// discarded. If they have been idle for less than a minute, just assumes they are okay. If not, calls PING.
 func validateRedisConnection(c redis.Conn, t time.Time) error {
+	if conn, ok := c.(*masterConn); ok && conn.generation != currentMaster.currentGeneration() {
+		return errStaleConnection
+	}
 	if time.Since(t) < IDLE_TIMEOUT*time.Second {
 		return nil
 	}
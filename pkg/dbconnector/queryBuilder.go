@@ -0,0 +1,82 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Builds a parameterized openCypher query. Values are added with param() and sent in the CYPHER header,
+// so they are never parsed as part of the query. Queries with the same shape have the same text after the
+// header, which lets RedisGraph reuse the cached execution plan.
+// Only identifiers (labels, relationship types and property keys) are written into the query text.
+type queryBuilder struct {
+	query  strings.Builder
+	params []interface{}
+}
+
+// Adds a parameter and returns the reference to use in the query, e.g. $p0.
+func (b *queryBuilder) param(value interface{}) string {
+	b.params = append(b.params, value)
+	return fmt.Sprintf("$p%d", len(b.params)-1)
+}
+
+// Appends to the query text. Values must be added with param().
+func (b *queryBuilder) write(format string, args ...interface{}) {
+	fmt.Fprintf(&b.query, format, args...)
+}
+
+// Returns the query with the CYPHER header, e.g. CYPHER p0='abc' p1=5 MATCH (n {_uid: $p0}) SET n.count=$p1
+func (b *queryBuilder) String() string {
+	if len(b.params) == 0 {
+		return b.query.String()
+	}
+	var header strings.Builder
+	header.WriteString("CYPHER")
+	for i, value := range b.params {
+		fmt.Fprintf(&header, " p%d=%s", i, encodeParam(value))
+	}
+	header.WriteString(" ")
+	return header.String() + b.query.String()
+}
+
+// Encodes a parameter value as an openCypher literal.
+func encodeParam(value interface{}) string {
+	switch typedVal := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "'" + sanitizeValue(typedVal) + "'"
+	case int:
+		return strconv.Itoa(typedVal)
+	case int64:
+		return strconv.FormatInt(typedVal, 10)
+	case float64:
+		return strconv.FormatFloat(typedVal, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(typedVal)
+	case []interface{}:
+		elements := make([]string, 0, len(typedVal))
+		for _, e := range typedVal {
+			elements = append(elements, encodeParam(e))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case []string:
+		elements := make([]string, 0, len(typedVal))
+		for _, e := range typedVal {
+			elements = append(elements, encodeParam(e))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case map[string]interface{}: // Keys are identifiers, e.g. {_uid: 'abc', name: 'a'}
+		elements := make([]string, 0, len(typedVal))
+		for _, k := range sortedKeys(typedVal) {
+			elements = append(elements, k+": "+encodeParam(typedVal[k]))
+		}
+		return "{" + strings.Join(elements, ", ") + "}"
+	default:
+		return encodeParam(fmt.Sprintf("%v", typedVal))
+	}
+}
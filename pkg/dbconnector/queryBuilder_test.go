@@ -0,0 +1,51 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"testing"
+
+	"github.com/stolostron/search-aggregator/pkg/dbconnector/memgraph"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_queryBuilder(t *testing.T) {
+	b := &queryBuilder{}
+	b.write("MATCH (n {_uid: %s}) SET n.count=%s, n.list=%s", b.param("a'b"), b.param(int64(5)),
+		b.param([]interface{}{"x", "y"}))
+
+	assert.Equal(t, "CYPHER p0='a\\'b' p1=5 p2=['x', 'y'] MATCH (n {_uid: $p0}) SET n.count=$p1, n.list=$p2",
+		b.String())
+}
+
+func Test_queryBuilder_noParams(t *testing.T) {
+	b := &queryBuilder{}
+	b.write("MATCH (c:Cluster) RETURN count(c)")
+	assert.Equal(t, "MATCH (c:Cluster) RETURN count(c)", b.String())
+}
+
+func Test_sanitizeValue(t *testing.T) {
+	assert.Equal(t, `a\\\' OR 1=1`, sanitizeValue(`a\' OR 1=1`), "Backslashes must not escape the added escapes.")
+	assert.Equal(t, `\"quoted\"`, sanitizeValue(`"quoted"`))
+}
+
+// Values with quotes and backslashes are stored as they were received.
+func Test_insertQuery_specialCharacters(t *testing.T) {
+	previousStore := Store
+	Store = memgraph.New()
+	defer func() { Store = previousStore }()
+
+	value := `it's a \' test \\ "x"`
+	_, err := Store.Query("CREATE (:Cluster {name: 'c1'})")
+	assert.NoError(t, err)
+	_, _, err = Insert([]*Resource{{Kind: "Pod", UID: "c1/pod1", Properties: map[string]interface{}{
+		"kind": "Pod", "name": value, "container": []interface{}{value}}}}, "c1")
+	assert.NoError(t, err)
+
+	result, err := Store.Query("MATCH (n:Pod) RETURN n.name, n.container")
+	assert.NoError(t, err)
+	assert.True(t, result.Next())
+	assert.Equal(t, value, result.Record().GetByIndex(0))
+	assert.Equal(t, []interface{}{value}, result.Record().GetByIndex(1))
+}
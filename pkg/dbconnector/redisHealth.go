@@ -0,0 +1,50 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gomodule/redigo/redis"
+)
+
+// Result of a health check against RedisGraph.
+type HealthStatus struct {
+	RedisError  error // Redis can't be reached or didn't respond to PING.
+	GraphError  error // The graph key can't be read or doesn't hold a graph.
+	GraphExists bool  // False until the first write creates the graph.
+}
+
+// Checks Redis and the search graph key using a dedicated connection, so the check isn't
+// blocked waiting for a pooled connection. The timeout bounds the dial and every command.
+func CheckRedisHealth(timeout time.Duration) HealthStatus {
+	conn, err := dialRedis(timeout, timeout)
+	if err != nil {
+		return HealthStatus{RedisError: err}
+	}
+	defer func() {
+		if closeErr := conn.Close(); closeErr != nil {
+			glog.Warning("Failed to close redis connection. Original error: ", closeErr)
+		}
+	}()
+
+	if _, err = conn.Do("PING"); err != nil {
+		return HealthStatus{RedisError: err}
+	}
+
+	keyType, err := redis.String(conn.Do("TYPE", GRAPH_NAME))
+	if err != nil {
+		return HealthStatus{GraphError: err}
+	}
+	switch keyType {
+	case "graphdata":
+		return HealthStatus{GraphExists: true}
+	case "none": // The graph is created on the first write, this is expected on a new install.
+		return HealthStatus{}
+	default:
+		return HealthStatus{GraphError: fmt.Errorf("key %s holds a %s, expected a graph", GRAPH_NAME, keyType)}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"crypto/tls"
+
+	"github.com/golang/glog"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stolostron/search-aggregator/pkg/config"
+)
+
+// Tells whether the connection to Redis must use TLS: REDIS_SSH_PORT is the TLS port, and a client
+// certificate is only used with TLS.
+func redisTLSRequired() bool {
+	return config.Cfg.RedisSSHPort != "" || config.Cfg.RedisCertFile != ""
+}
+
+// Returns the TLS config to connect to Redis. The CA in REDIS_CA_FILE verifies the server, and the certificate in
+// REDIS_CERT_FILE and REDIS_KEY_FILE authenticates the aggregator for mutual TLS.
+func redisTLSConfig(required bool) (*tls.Config, error) {
+	tlsconf := &tls.Config{
+		MinVersion:               tls.VersionTLS12,
+		CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
+		PreferServerCipherSuites: true,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		},
+	}
+
+	caCertPool, err := config.LoadCertPool(config.Cfg.RedisCAFile)
+	if err != nil {
+		if required {
+			glog.Error("TLS is required to connect to Redis, but can't load the CA from REDIS_CA_FILE. ", err)
+			return nil, err
+		}
+		glog.Warning("Using insecure Redis connection.")
+		glog.Warning("To enable SSL provide REDIS_SSH_PORT and REDIS_CA_FILE")
+	} else {
+		tlsconf.RootCAs = caCertPool
+	}
+
+	if config.Cfg.RedisCertFile != "" || config.Cfg.RedisKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.Cfg.RedisCertFile, config.Cfg.RedisKeyFile)
+		if err != nil {
+			glog.Error("Can't load the Redis client certificate from REDIS_CERT_FILE and REDIS_KEY_FILE. ", err)
+			return nil, err
+		}
+		tlsconf.Certificates = []tls.Certificate{cert}
+	}
+	return tlsconf, nil
+}
+
+// Authenticates the connection with REDIS_PASSWORD, as the ACL user in REDIS_USER when it's set.
+func authenticateRedis(conn redis.Conn) error {
+	if config.Cfg.RedisPassword == "" {
+		if config.Cfg.RedisUser != "" {
+			glog.Warning("REDIS_USER is set without REDIS_PASSWORD, the user isn't authenticated.")
+		}
+		glog.Warning("REDIS_PASSWORD wasn't provided. Attempting to communicate without authentication.")
+		return nil
+	}
+	args := []interface{}{config.Cfg.RedisPassword}
+	if config.Cfg.RedisUser != "" {
+		glog.V(2).Infof("Authenticating Redis client as user %s using password from REDIS_PASSWORD.",
+			config.Cfg.RedisUser)
+		args = []interface{}{config.Cfg.RedisUser, config.Cfg.RedisPassword}
+	} else {
+		glog.V(2).Info("Authenticating Redis client using password from REDIS_PASSWORD.")
+	}
+	_, err := conn.Do("AUTH", args...)
+	return err
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes a self-signed certificate and its key to the directory, and returns their paths.
+func writeTestCertificate(t *testing.T, dir, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err = os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// Sets the Redis TLS files until the test ends.
+func setRedisTLSFiles(t *testing.T, caFile, certFile, keyFile string) {
+	previousCA, previousCert, previousKey := config.Cfg.RedisCAFile, config.Cfg.RedisCertFile, config.Cfg.RedisKeyFile
+	config.Cfg.RedisCAFile, config.Cfg.RedisCertFile, config.Cfg.RedisKeyFile = caFile, certFile, keyFile
+	t.Cleanup(func() {
+		config.Cfg.RedisCAFile, config.Cfg.RedisCertFile, config.Cfg.RedisKeyFile = previousCA, previousCert, previousKey
+	})
+}
+
+func Test_redisTLSConfig_mutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	caFile, _ := writeTestCertificate(t, dir, "redis-ca")
+	certFile, keyFile := writeTestCertificate(t, dir, "search-aggregator")
+	setRedisTLSFiles(t, caFile, certFile, keyFile)
+
+	assert.True(t, redisTLSRequired(), "A client certificate requires TLS.")
+	tlsconf, err := redisTLSConfig(true)
+	assert.NoError(t, err)
+	assert.NotNil(t, tlsconf.RootCAs)
+	assert.Len(t, tlsconf.Certificates, 1)
+}
+
+func Test_redisTLSConfig_missingCA(t *testing.T) {
+	setRedisTLSFiles(t, filepath.Join(t.TempDir(), "missing.crt"), "", "")
+
+	_, err := redisTLSConfig(true)
+	assert.Error(t, err, "The CA is required with TLS.")
+
+	tlsconf, err := redisTLSConfig(false)
+	assert.NoError(t, err)
+	assert.Nil(t, tlsconf.RootCAs)
+}
+
+func Test_redisTLSConfig_missingKey(t *testing.T) {
+	dir := t.TempDir()
+	caFile, _ := writeTestCertificate(t, dir, "redis-ca")
+	certFile, _ := writeTestCertificate(t, dir, "search-aggregator")
+	setRedisTLSFiles(t, caFile, certFile, "")
+
+	_, err := redisTLSConfig(true)
+	assert.Error(t, err)
+}
+
+// Connection recording the commands sent to Redis.
+type recordingConn struct {
+	redis.Conn
+	commands [][]interface{}
+}
+
+func (c *recordingConn) Do(command string, args ...interface{}) (interface{}, error) {
+	c.commands = append(c.commands, append([]interface{}{command}, args...))
+	return "OK", nil
+}
+
+func Test_authenticateRedis(t *testing.T) {
+	previousUser, previousPassword := config.Cfg.RedisUser, config.Cfg.RedisPassword
+	defer func() { config.Cfg.RedisUser, config.Cfg.RedisPassword = previousUser, previousPassword }()
+
+	config.Cfg.RedisUser, config.Cfg.RedisPassword = "search-aggregator", "secret"
+	conn := &recordingConn{}
+	assert.NoError(t, authenticateRedis(conn))
+	assert.Equal(t, [][]interface{}{{"AUTH", "search-aggregator", "secret"}}, conn.commands)
+
+	config.Cfg.RedisUser = ""
+	conn = &recordingConn{}
+	assert.NoError(t, authenticateRedis(conn))
+	assert.Equal(t, [][]interface{}{{"AUTH", "secret"}}, conn.commands)
+
+	config.Cfg.RedisPassword = ""
+	conn = &recordingConn{}
+	assert.NoError(t, authenticateRedis(conn))
+	assert.Empty(t, conn.commands)
+}
@@ -46,6 +46,7 @@ func (RedisGraphStoreV2) Query(q string) (*rg2.QueryResult, error) {
 	if err != nil {
 		glog.Error("Error fetching results from RedisGraph V2 : ", err)
 		glog.V(4).Info("Failed query: ", q)
+		handleFailoverError(err)
 	}
 	return result, err
 
@@ -10,8 +10,6 @@ The source code for this program is not published or otherwise divested of its t
 package dbconnector
 
 import (
-	"time"
-
 	"github.com/golang/glog"
 	"github.com/stolostron/search-aggregator/pkg/config"
 )
@@ -20,10 +18,13 @@ var existingClustersMap map[string]map[string]interface{} // holds current prope
 
 func RedisWatcher() {
 	conn := Pool.Get()
-	interval := time.Duration(config.Cfg.RedisWatchRate) * time.Millisecond
+	generation := currentMaster.currentGeneration()
 
 	for {
 		_, err := conn.Do("PING")
+		if err == nil && generation != currentMaster.currentGeneration() {
+			err = errStaleConnection // The data cached for the previous master may not match the new one.
+		}
 		if err != nil {
 			glog.Warningf("Failed to PING redis - clear in memory data ")
 			clearClusterCache()
@@ -33,7 +34,7 @@ func RedisWatcher() {
 			}
 			break
 		}
-		time.Sleep(interval)
+		config.Sleep(config.RedisWatchRate)
 	}
 
 }
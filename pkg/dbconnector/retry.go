@@ -0,0 +1,91 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-aggregator/pkg/config"
+)
+
+// Max delay between retries.
+const maxRetryBackoff = 10 * time.Second
+
+// Retries the queries of a chunked operation after transient errors, with exponential backoff and jitter. The
+// queries that aren't idempotent are only retried after errors that happened before Redis ran them.
+// It stops retrying when the context is done or the next retry would start after its deadline.
+type retrier struct {
+	ctx     context.Context
+	retries int64 // Number of retries, updated atomically because batches can run concurrently.
+}
+
+func newRetrier(ctx context.Context) *retrier {
+	return &retrier{ctx: ctx}
+}
+
+// Runs a query that isn't idempotent, like the inserts, until it succeeds, fails with an error that could come
+// after Redis ran it, or the retries are exhausted. Returns the error of the last attempt.
+func (r *retrier) do(query func() error) error {
+	return r.retry(isUnsent, query)
+}
+
+// Runs a query that can run twice without changing the result, like the updates and deletes, until it succeeds,
+// fails with an error that isn't transient, or the retries are exhausted. Connection losses and timeouts are
+// retried too. Returns the error of the last attempt.
+func (r *retrier) doIdempotent(query func() error) error {
+	return r.retry(IsTransient, query)
+}
+
+func (r *retrier) retry(retriable func(error) bool, query func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := query()
+		if !retriable(err) || attempt >= config.Cfg.SyncRetryAttempts {
+			return err
+		}
+		if _, open := IsCircuitOpen(err); open { // Fail fast, the circuit stays open longer than the backoff.
+			return err
+		}
+		delay := retryBackoff(attempt)
+		if deadline, ok := r.ctx.Deadline(); ok && time.Until(deadline) < delay {
+			glog.Warning("Not retrying the query, the request deadline is too close. ", err)
+			return err
+		}
+		glog.Warningf("Retrying the query in %s after a transient error (retry %d of %d). %s", delay, attempt+1,
+			config.Cfg.SyncRetryAttempts, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-r.ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		atomic.AddInt64(&r.retries, 1)
+	}
+}
+
+// Returns the number of retries so far.
+func (r *retrier) count() int {
+	return int(atomic.LoadInt64(&r.retries))
+}
+
+// Returns the delay before a retry: SYNC_RETRY_BACKOFF_MS doubled for each previous retry, up to
+// maxRetryBackoff, with a random jitter of up to half the delay so clusters don't retry at the same time.
+func retryBackoff(attempt int) time.Duration {
+	delay := time.Duration(config.Cfg.SyncRetryBackoffMS) * time.Millisecond
+	for i := 0; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	/* #nosec G404 - The jitter doesn't need a secure random number. */
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rg2 "github.com/redislabs/redisgraph-go"
+	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stolostron/search-aggregator/pkg/dbconnector/memgraph"
+	"github.com/stretchr/testify/assert"
+)
+
+// Store failing the first queries with the given error, then passing the queries to the wrapped store.
+type flakyStore struct {
+	store    DBStore
+	failures int
+	err      error
+	queries  int
+}
+
+func (f *flakyStore) Query(q string) (*rg2.QueryResult, error) {
+	f.queries++
+	if f.queries <= f.failures {
+		return nil, f.err
+	}
+	return f.store.Query(q)
+}
+
+// Sets the retry config until the test ends.
+func setRetries(t *testing.T, attempts, backoffMS int) {
+	previousAttempts, previousBackoff := config.Cfg.SyncRetryAttempts, config.Cfg.SyncRetryBackoffMS
+	config.Cfg.SyncRetryAttempts, config.Cfg.SyncRetryBackoffMS = attempts, backoffMS
+	t.Cleanup(func() {
+		config.Cfg.SyncRetryAttempts, config.Cfg.SyncRetryBackoffMS = previousAttempts, previousBackoff
+	})
+}
+
+func Test_IsTransient(t *testing.T) {
+	assert.False(t, IsTransient(nil))
+	assert.True(t, IsTransient(errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")))
+	assert.True(t, IsTransient(errors.New("EOF")))
+	assert.True(t, IsTransient(errors.New("Query timed out")))
+	assert.True(t, IsTransient(errors.New("read tcp 127.0.0.1:6379: i/o timeout")))
+	assert.True(t, IsTransient(errors.New("READONLY You can't write against a read only replica.")))
+	assert.False(t, IsTransient(errors.New("Invalid input")))
+}
+
+func Test_isUnsent(t *testing.T) {
+	assert.False(t, isUnsent(nil))
+	assert.True(t, isUnsent(errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")))
+	assert.True(t, isUnsent(errors.New("dial tcp: lookup redis: no such host")))
+	assert.True(t, isUnsent(errors.New("READONLY You can't write against a read only replica.")))
+	assert.False(t, isUnsent(errors.New("EOF")), "The query may have been applied before the connection was lost.")
+	assert.False(t, isUnsent(errors.New("read tcp 127.0.0.1:6379: i/o timeout")))
+	assert.False(t, isUnsent(errors.New("Query timed out")))
+}
+
+func Test_retrier_transientThenSuccess(t *testing.T) {
+	setRetries(t, 3, 1)
+	r := newRetrier(context.Background())
+	calls := 0
+	err := r.do(func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 2, r.count())
+}
+
+func Test_retrier_exhausted(t *testing.T) {
+	setRetries(t, 2, 1)
+	r := newRetrier(context.Background())
+	calls := 0
+	err := r.do(func() error {
+		calls++
+		return errors.New("connection refused")
+	})
+	assert.EqualError(t, err, "connection refused")
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 2, r.count())
+}
+
+// A query cut off or timed out may have been applied, it isn't retried.
+func Test_retrier_maybeApplied(t *testing.T) {
+	setRetries(t, 3, 1)
+	r := newRetrier(context.Background())
+	calls := 0
+	err := r.do(func() error {
+		calls++
+		return errors.New("EOF")
+	})
+	assert.EqualError(t, err, "EOF")
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 0, r.count())
+}
+
+// An idempotent query is retried after a connection loss or a timeout.
+func Test_retrier_idempotent(t *testing.T) {
+	setRetries(t, 3, 1)
+	r := newRetrier(context.Background())
+	calls := 0
+	err := r.doIdempotent(func() error {
+		calls++
+		switch calls {
+		case 1:
+			return errors.New("EOF")
+		case 2:
+			return errors.New("Query timed out")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 2, r.count())
+}
+
+func Test_retrier_notTransient(t *testing.T) {
+	setRetries(t, 3, 1)
+	r := newRetrier(context.Background())
+	calls := 0
+	err := r.do(func() error {
+		calls++
+		return errors.New("Invalid input")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls, "Errors caused by the query aren't retried.")
+	assert.Equal(t, 0, r.count())
+}
+
+// The retries don't go past the request deadline.
+func Test_retrier_deadline(t *testing.T) {
+	setRetries(t, 3, 1000)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	r := newRetrier(ctx)
+	calls := 0
+	began := time.Now()
+	err := r.do(func() error {
+		calls++
+		return errors.New("connection refused")
+	})
+	assert.EqualError(t, err, "connection refused")
+	assert.Equal(t, 1, calls)
+	assert.Less(t, time.Since(began), 100*time.Millisecond)
+}
+
+func Test_retryBackoff(t *testing.T) {
+	setRetries(t, 3, 200)
+	for attempt, max := range []time.Duration{200, 400, 800} {
+		delay := retryBackoff(attempt)
+		assert.GreaterOrEqual(t, delay, max*time.Millisecond/2)
+		assert.LessOrEqual(t, delay, max*time.Millisecond)
+	}
+	assert.LessOrEqual(t, retryBackoff(20), maxRetryBackoff)
+}
+
+// A chunked operation retries the query that lost the connection and reports the retries.
+func TestChunkedInsert_retries(t *testing.T) {
+	setRetries(t, 3, 1)
+	setBatchWorkers(t, 1)
+	previousStore := Store
+	store := &flakyStore{store: memgraph.New(), failures: 2, err: errors.New("connection refused")}
+	Store = store
+	defer func() { Store = previousStore }()
+
+	resources := []*Resource{
+		{UID: "uid1", Properties: map[string]interface{}{"kind": "Pod", "name": "a"}},
+		{UID: "uid2", Properties: map[string]interface{}{"kind": "Pod", "name": "b"}},
+	}
+	result := ChunkedInsert(context.Background(), resources, "")
+	assert.NoError(t, result.ConnectionError)
+	assert.Equal(t, 2, result.SuccessfulResources)
+	assert.Equal(t, 2, result.Retries)
+
+	store.failures, store.queries = 10, 0
+	result = ChunkedDelete(context.Background(), []string{"uid1", "uid2"})
+	assert.EqualError(t, result.ConnectionError, "connection refused")
+	assert.Equal(t, 3, result.Retries)
+
+	// The delete cut off is retried, running it twice deletes the same resources.
+	store.failures, store.queries, store.err = 1, 0, errors.New("EOF")
+	result = ChunkedDelete(context.Background(), []string{"uid1", "uid2"})
+	assert.NoError(t, result.ConnectionError)
+	assert.Equal(t, 1, result.Retries)
+
+	// The insert cut off isn't retried, Redis may have created the resources.
+	store.failures, store.queries, store.err = 1, 0, errors.New("EOF")
+	result = ChunkedInsert(context.Background(), resources, "")
+	assert.EqualError(t, result.ConnectionError, "EOF")
+	assert.Equal(t, 0, result.Retries)
+	assert.Equal(t, 1, store.queries)
+}
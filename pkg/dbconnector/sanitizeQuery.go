@@ -10,7 +10,8 @@ import (
 
 // Escape any characters that could break the openCypher query.
 func sanitizeValue(value string) string {
-	res1 := strings.Replace(value, "\"", "\\\"", -1) // Escape all double quotes.
+	res0 := strings.Replace(value, "\\", "\\\\", -1) // Escape backslashes first, so they can't escape the quotes.
+	res1 := strings.Replace(res0, "\"", "\\\"", -1)  // Escape all double quotes.
 	res2 := strings.Replace(res1, "'", "\\'", -1)    // Escape all single quotes.
 	return res2
 }
@@ -28,4 +29,4 @@ func SanitizeQuery(queryTemplate string, values ...interface{}) string {
 		}
 	}
 	return fmt.Sprintf(queryTemplate, sanitizedValues...)
-}
\ No newline at end of file
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gomodule/redigo/redis"
+	"github.com/stolostron/search-aggregator/pkg/config"
+)
+
+const (
+	sentinelTimeout        = 5 * time.Second // Max time to wait for a Sentinel to answer.
+	sentinelLookupInterval = time.Second     // A burst of failed queries asks the Sentinels only once.
+)
+
+var errStaleConnection = errors.New("connection to a previous Redis master")
+
+// Address of the Redis master discovered from the Sentinels. The generation increments each time the master
+// changes, so the pool discards the connections dialed to a previous master.
+type redisMaster struct {
+	mutex      sync.Mutex
+	address    string // host:port, empty until the first lookup succeeds.
+	generation int64
+	lastLookup time.Time
+}
+
+var currentMaster = &redisMaster{}
+
+// Connection to the master of the given generation, only used in Sentinel mode.
+type masterConn struct {
+	redis.Conn
+	generation int64
+}
+
+// Asks a Sentinel for the address of the master. Replaced in tests.
+var querySentinel = func(sentinel, master string) (string, error) {
+	conn, err := redis.Dial("tcp", sentinel,
+		redis.DialConnectTimeout(sentinelTimeout),
+		redis.DialReadTimeout(sentinelTimeout),
+		redis.DialWriteTimeout(sentinelTimeout))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if closeErr := conn.Close(); closeErr != nil {
+			glog.Warning("Failed to close sentinel connection. Original error: ", closeErr)
+		}
+	}()
+	reply, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", master))
+	if err != nil {
+		return "", err // redis.ErrNil when the Sentinel doesn't monitor the master.
+	}
+	if len(reply) != 2 {
+		return "", fmt.Errorf("unexpected reply from sentinel %s: %v", sentinel, reply)
+	}
+	return net.JoinHostPort(reply[0], reply[1]), nil
+}
+
+// Tells whether the master is discovered with Sentinel, instead of using REDIS_HOST and REDIS_PORT.
+func sentinelEnabled() bool {
+	return config.Cfg.RedisSentinelAddresses != ""
+}
+
+// Asks the Sentinels for the master, in order, and returns the first answer.
+func lookupMaster() (string, error) {
+	master := config.Cfg.RedisSentinelMaster
+	var lastErr error
+	for _, sentinel := range strings.Split(config.Cfg.RedisSentinelAddresses, ",") {
+		sentinel = strings.TrimSpace(sentinel)
+		if sentinel == "" {
+			continue
+		}
+		address, err := querySentinel(sentinel, master)
+		if err == nil {
+			return address, nil
+		}
+		glog.Warningf("Sentinel %s couldn't give the address of the Redis master %s. %s", sentinel, master, err)
+		lastErr = err
+	}
+	return "", fmt.Errorf("no sentinel gave the address of the Redis master %s: %v", master, lastErr)
+}
+
+// Returns the address of the master and its generation, asking the Sentinels if it isn't known yet.
+func (m *redisMaster) get() (string, int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.address == "" {
+		if err := m.refresh(); err != nil {
+			return "", 0, err
+		}
+	}
+	return m.address, m.generation, nil
+}
+
+func (m *redisMaster) currentGeneration() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.generation
+}
+
+// Asks the Sentinels for the master, and starts a new generation if it changed. Must hold the mutex.
+func (m *redisMaster) refresh() error {
+	m.lastLookup = time.Now()
+	address, err := lookupMaster()
+	if err != nil {
+		return err
+	}
+	if address != m.address {
+		if m.address == "" {
+			glog.Infof("Using the Redis master %s given by the sentinels.", address)
+		} else {
+			glog.Warningf("The Redis master moved from %s to %s, draining the connections to the previous master.",
+				m.address, address)
+		}
+		m.address = address
+		m.generation++
+	}
+	return nil
+}
+
+// Looks up the master again after an error that can be caused by a failover: the master can't be dialed, the
+// connection was lost, or the node became a read-only replica. Does nothing without Sentinel, or if the master
+// was looked up recently.
+func handleFailoverError(err error) {
+	if !sentinelEnabled() || !(isUnsent(err) || isConnectionError(err)) {
+		return
+	}
+	currentMaster.mutex.Lock()
+	defer currentMaster.mutex.Unlock()
+	if time.Since(currentMaster.lastLookup) < sentinelLookupInterval {
+		return
+	}
+	if lookupErr := currentMaster.refresh(); lookupErr != nil {
+		glog.Warning("Unable to look up the Redis master after a failed query. ", lookupErr)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package dbconnector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// Enables the Sentinel mode with fake sentinels until the test ends. The sentinels answer with the master in
+// the returned map, or fail when it's missing.
+func mockSentinels(t *testing.T, sentinels string) map[string]string {
+	masters := map[string]string{}
+	previousQuery, previousAddresses, previousMaster := querySentinel, config.Cfg.RedisSentinelAddresses,
+		currentMaster
+	querySentinel = func(sentinel, master string) (string, error) {
+		assert.Equal(t, "mymaster", master)
+		if address, ok := masters[sentinel]; ok {
+			return address, nil
+		}
+		return "", errors.New("dial tcp " + sentinel + ": connect: connection refused")
+	}
+	config.Cfg.RedisSentinelAddresses = sentinels
+	currentMaster = &redisMaster{}
+	t.Cleanup(func() {
+		querySentinel, config.Cfg.RedisSentinelAddresses, currentMaster = previousQuery, previousAddresses,
+			previousMaster
+	})
+	return masters
+}
+
+func Test_redisMaster_get(t *testing.T) {
+	masters := mockSentinels(t, "sentinel-0:26379, sentinel-1:26379")
+	masters["sentinel-1:26379"] = "10.0.0.1:6379"
+
+	address, generation, err := currentMaster.get()
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:6379", address, "The master is given by the first sentinel that answers.")
+	assert.Equal(t, int64(1), generation)
+}
+
+func Test_redisMaster_noSentinel(t *testing.T) {
+	mockSentinels(t, "sentinel-0:26379")
+
+	_, _, err := currentMaster.get()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "mymaster")
+}
+
+// A failover error looks up the master again, and the connections to the previous master become stale.
+func Test_handleFailoverError(t *testing.T) {
+	masters := mockSentinels(t, "sentinel-0:26379")
+	masters["sentinel-0:26379"] = "10.0.0.1:6379"
+	_, generation, _ := currentMaster.get()
+	conn := &masterConn{generation: generation}
+	assert.NoError(t, validateRedisConnection(conn, time.Now()))
+
+	masters["sentinel-0:26379"] = "10.0.0.2:6379"
+	handleFailoverError(errors.New("READONLY You can't write against a read only replica."))
+	assert.Equal(t, "10.0.0.1:6379", currentMaster.address, "The master was looked up less than a second ago.")
+
+	currentMaster.lastLookup = time.Now().Add(-sentinelLookupInterval)
+	handleFailoverError(errors.New("Invalid input"))
+	assert.Equal(t, "10.0.0.1:6379", currentMaster.address, "Query errors aren't caused by a failover.")
+	handleFailoverError(errors.New("Query timed out"))
+	assert.Equal(t, "10.0.0.1:6379", currentMaster.address, "A slow query isn't caused by a failover.")
+
+	handleFailoverError(errors.New("READONLY You can't write against a read only replica."))
+	assert.Equal(t, "10.0.0.2:6379", currentMaster.address)
+	assert.Equal(t, int64(2), currentMaster.currentGeneration())
+	assert.Equal(t, errStaleConnection, validateRedisConnection(conn, time.Now()))
+}
+
+// The generation only changes when the master moves.
+func Test_handleFailoverError_sameMaster(t *testing.T) {
+	masters := mockSentinels(t, "sentinel-0:26379")
+	masters["sentinel-0:26379"] = "10.0.0.1:6379"
+	_, _, _ = currentMaster.get()
+
+	currentMaster.lastLookup = time.Time{}
+	handleFailoverError(errors.New("EOF"))
+	assert.Equal(t, int64(1), currentMaster.currentGeneration())
+}
+
+// The master is looked up again when the previous master can't be dialed.
+func Test_handleFailoverError_dialTimeout(t *testing.T) {
+	masters := mockSentinels(t, "sentinel-0:26379")
+	masters["sentinel-0:26379"] = "10.0.0.1:6379"
+	_, _, _ = currentMaster.get()
+
+	masters["sentinel-0:26379"] = "10.0.0.2:6379"
+	currentMaster.lastLookup = time.Time{}
+	handleFailoverError(errors.New("dial tcp 10.0.0.1:6379: i/o timeout"))
+	assert.Equal(t, "10.0.0.2:6379", currentMaster.address)
+}
+
+func Test_handleFailoverError_disabled(t *testing.T) {
+	mockSentinels(t, "")
+	handleFailoverError(errors.New("EOF"))
+	assert.True(t, currentMaster.lastLookup.IsZero())
+}
@@ -10,6 +10,7 @@ Copyright (c) 2020 Red Hat, Inc.
 package dbconnector
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"strings"
@@ -20,12 +21,13 @@ import (
 
 // Recursive helper for ChunkedUpdate. Takes a single chunk, and recursively attempts to insert that chunk,
 // then the first and second halves of that chunk independently, and so on.
-func chunkedUpdateHelper(resources []*Resource) ChunkedOperationResult {
+func chunkedUpdateHelper(r *retrier, resources []*Resource) ChunkedOperationResult {
 	if len(resources) == 0 {
 		return ChunkedOperationResult{} // No errors, and no SuccessfulResources
 	}
-	_, _, err := Update(resources) // We ignore encoding errors as they are always recoverable.
-	if IsBadConnection(err) {      // this is false if err is nil
+	// We ignore encoding errors as they are always recoverable.
+	err := r.doIdempotent(func() error { _, _, err := Update(resources); return err })
+	if IsTransient(err) { // this is false if err is nil
 		return ChunkedOperationResult{
 			ConnectionError: err,
 		}
@@ -36,8 +38,8 @@ func chunkedUpdateHelper(resources []*Resource) ChunkedOperationResult {
 				ResourceErrors: map[string]error{resources[0].UID: err},
 			}
 		} else { // If this is multiple resources, we make a recursive call to find which half had the error.
-			firstHalf := chunkedUpdateHelper(resources[0 : len(resources)/2])
-			secondHalf := chunkedUpdateHelper(resources[len(resources)/2:])
+			firstHalf := chunkedUpdateHelper(r, resources[0:len(resources)/2])
+			secondHalf := chunkedUpdateHelper(r, resources[len(resources)/2:])
 			if firstHalf.ConnectionError != nil || secondHalf.ConnectionError != nil {
 				// Again, if either one has a redis conn issue we just instantly bail
 				return ChunkedOperationResult{
@@ -58,23 +60,19 @@ func chunkedUpdateHelper(resources []*Resource) ChunkedOperationResult {
 }
 
 // Updates the given resources in the graph, does chunking for you and returns errors related to individual resources.
-func ChunkedUpdate(resources []*Resource) ChunkedOperationResult {
-	var resourceErrors map[string]error
-	totalSuccessful := 0
-	for i := 0; i < len(resources); i += CHUNK_SIZE {
-		endIndex := min(i+CHUNK_SIZE, len(resources))
-		chunkResult := chunkedUpdateHelper(resources[i:endIndex])
-		if chunkResult.ConnectionError != nil {
-			return chunkResult
-		} else if chunkResult.ResourceErrors != nil {
-			resourceErrors = mergeErrorMaps(resourceErrors, chunkResult.ResourceErrors) // if both are nil, this is nil
-		}
-		totalSuccessful += chunkResult.SuccessfulResources
-	}
-	return ChunkedOperationResult{
-		ResourceErrors:      resourceErrors,
-		SuccessfulResources: totalSuccessful,
+func ChunkedUpdate(ctx context.Context, resources []*Resource) ChunkedOperationResult {
+	resources, resourceErrors := validateResources(resources)
+	groups := groupResources(resources)
+	r := newRetrier(ctx)
+	ret := runBatches(updateSizer, resourceGroupSizes(groups), func(group, start, end int) ChunkedOperationResult {
+		return chunkedUpdateHelper(r, groups[group][start:end])
+	})
+	ret.Retries = r.count()
+	if ret.ConnectionError != nil {
+		return ret
 	}
+	ret.ResourceErrors = mergeErrorMaps(resourceErrors, ret.ResourceErrors) // if both are nil, this is nil
+	return ret
 }
 
 // Updates given resources into graph, transparently builds query for you and
@@ -86,9 +84,9 @@ func Update(resources []*Resource) (*rg2.QueryResult, map[string]error, error) {
 	return resp, encodingErrors, err
 }
 
-// Given a set of resources, returns Query string for replacing the existing versions of them
+// Given a set of resources of the same kind, returns Query string for replacing the existing versions of them
 // in redisgraph with the given ones.
-// Will not delete old properties.
+// Will not delete old properties, properties a resource doesn't have keep their value.
 func updateQuery(resources []*Resource) (string, map[string]error) {
 
 	if len(resources) == 0 {
@@ -96,41 +94,50 @@ func updateQuery(resources []*Resource) (string, map[string]error) {
 	}
 	encodingErrors := make(map[string]error)
 
-	// Form query string with MATCH and SET to update all the resources at once.
+	// Send the resources as a list parameter and update them with a single UNWIND.
 	// Useful doc: https://oss.redislabs.com/redisgraph/commands/#set
-	matchStrings := []string{} // Build the MATCH portion
-	setStrings := []string{}   // Build the SET portion. Declare this here so that we can do this in one pass.
-	for i, resource := range resources {
+	kind := resources[0].Properties["kind"]
+	rows := make([]interface{}, 0, len(resources))
+	keys := make(map[string]interface{}) // All the property keys in the batch.
+	for _, resource := range resources {
+		if resource.Properties["kind"] != kind {
+			encodingErrors[resource.UID] = fmt.Errorf("kind %v doesn't match the kind of the batch %v",
+				resource.Properties["kind"], kind)
+			continue
+		}
 		resource.addRbacProperty()
-		// e.g. (n0:Pod {_uid: 'abc123'})
-		matchStrings = append(matchStrings, fmt.Sprintf("(n%d:%s {_uid: '%s'})",
-			i, resource.Properties["kind"], resource.UID))
 		encodedProps, err := resource.EncodeProperties()
 		if err != nil {
 			glog.Error("Cannot encode resource ", resource.UID, ", excluding it from update: ", err)
 			encodingErrors[resource.UID] = err
 			continue
 		}
-		for k, v := range encodedProps {
-			switch typed := v.(type) { // This is either string or int64 with base type string or []interface
-			// Need to wrap in quotes if it's string
-			case int64:
-				setStrings = append(setStrings, fmt.Sprintf("n%d.%s=%d", i, k, typed)) // e.g. n0.<key>=<value>
-			case []interface{}, map[string]interface{}: // Values are individually quoted already in encodeProperty
-				setStrings = append(setStrings, fmt.Sprintf("n%d.%s=%s", i, k, typed)) // e.g. n0.<key>=<value>
-			default:
-				setStrings = append(setStrings, fmt.Sprintf("n%d.%s='%s'", i, k, typed)) // e.g. n0.<key>='<value>'
-			}
+		for k := range encodedProps {
+			keys[k] = nil
 		}
+		encodedProps["_uid"] = resource.UID
+		rows = append(rows, encodedProps)
 	}
-
-	queryString := fmt.Sprintf(
-		"%s%s", "MATCH "+strings.Join(matchStrings, ", "), " SET "+strings.Join(setStrings, ", "))
-
+	delete(keys, "_uid")
+
+	// e.g. CYPHER p0=[{_uid: 'abc123', prop1: 5}] UNWIND $p0 AS r MATCH (n:Pod {_uid: r._uid})
+	// SET n.prop1=coalesce(r.prop1, n.prop1)
+	b := &queryBuilder{}
+	b.write("UNWIND %s AS r MATCH (n:%s {_uid: r._uid})", b.param(rows), kind)
+	set := make([]string, 0, len(keys))
+	for _, k := range sortedKeys(keys) {
+		set = append(set, fmt.Sprintf("n.%s=coalesce(r.%[1]s, n.%[1]s)", k))
+	}
+	b.write(" SET %s", strings.Join(set, ", "))
+	queryString := b.String()
 	return queryString, encodingErrors
 }
 
 func UpdateByName(resource Resource) (*rg2.QueryResult, error, bool) {
+	if err := resource.validateIdentifiers(); err != nil {
+		glog.Error("Cannot update resource ", resource.UID, ": ", err)
+		return &rg2.QueryResult{}, err, false
+	}
 	resource.addRbacProperty()
 	encodedProps, err := resource.EncodeProperties()
 	if err != nil {
@@ -153,22 +160,17 @@ func UpdateByName(resource Resource) (*rg2.QueryResult, error, bool) {
 		}
 
 	}
-	setStrings := []string{} // Build the SET portion.
-	for k, v := range encodedProps {
-		switch typed := v.(type) { // Here it's either string or int64 or list. Need to wrap in quotes if it's string
-		case int64:
-			setStrings = append(setStrings, fmt.Sprintf("n.%s=%d", k, typed)) // e.g. n.<key>=<value>
-		case []interface{}, map[string]interface{}:
-			setStrings = append(setStrings, fmt.Sprintf("n.%s=%s", k, typed)) // e.g. n.<key>=<value>
-		default:
-			setStrings = append(setStrings, fmt.Sprintf("n.%s='%s'", k, typed)) // e.g. n.<key>=<value>
+	glog.V(2).Infof("Updating properties for cluster %s on db.", resource.Properties["name"])
+	// e.g. "CYPHER p0='abc123' p1=4 MATCH (n:Cluster {name: $p0}) SET n.foo=$p1"
+	b := &queryBuilder{}
+	b.write("MATCH (n:%s {name: %s}) SET ", resource.Properties["kind"], b.param(resource.Properties["name"]))
+	for i, k := range sortedKeys(encodedProps) {
+		if i > 0 {
+			b.write(", ")
 		}
+		b.write("n.%s=%s", k, b.param(encodedProps[k])) // e.g. n.<key>=$p1
 	}
-
-	glog.V(2).Infof("Updating properties for cluster %s on db.", resource.Properties["name"])
-	// e.g. "MATCH (n:Cluster {name: 'abc123'}) SET n.foo=4"
-	queryString := fmt.Sprintf("MATCH (n:%s {name: '%s'}) SET %s",
-		resource.Properties["kind"], resource.Properties["name"], strings.Join(setStrings, ", "))
+	queryString := b.String()
 	resp, err := Store.Query(queryString)
 	//if there is no error store the Map in Global encodedPropsMap
 	if err == nil {
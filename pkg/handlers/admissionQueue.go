@@ -0,0 +1,268 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/stolostron/search-aggregator/pkg/config"
+)
+
+// Priority classes for sync requests waiting in the admission queue. Lower values are admitted first.
+const (
+	priorityLocalCluster = iota // The hub, this is how we debug search.
+	priorityIncremental         // Small updates from the collector.
+	priorityClearAll            // Full resync of a cluster, usually large.
+)
+
+// Weight of the last request when updating the average sync duration.
+const syncDurationSmoothing = 0.2
+
+// Sync request waiting for, or holding, a slot in the admission queue.
+type admissionTicket struct {
+	clusterName string
+	priority    int
+	size        int64 // Content-Length of the request, -1 if unknown.
+	seq         uint64
+	admitted    bool
+	ready       chan struct{} // Closed when the request is admitted.
+	start       time.Time
+}
+
+// Error returned when a sync request isn't admitted.
+type admissionError struct {
+	message    string
+	retryAfter time.Duration
+}
+
+func (e admissionError) Error() string {
+	return e.message
+}
+
+// Limits the number of sync requests processed concurrently. Requests that exceed the limit wait in a bounded
+// queue and are admitted by priority: local-cluster first, then incremental syncs before ClearAll resyncs,
+// then smaller requests first. Requests with the same priority and size are admitted in arrival order.
+type admissionQueue struct {
+	mutex       sync.Mutex
+	waiting     []*admissionTicket
+	active      int
+	clusters    map[string]bool // Clusters with a request active or waiting.
+	nextSeq     uint64
+	avgDuration time.Duration // Moving average of the time requests hold a slot.
+
+	// Read from the tunables reloaded at runtime by default, tests replace these.
+	limit    func() int
+	maxQueue func() int
+	maxWait  func() time.Duration
+}
+
+var syncAdmissionQueue = newAdmissionQueue()
+
+func newAdmissionQueue() *admissionQueue {
+	return &admissionQueue{
+		clusters: make(map[string]bool),
+		limit:    func() int { return config.CurrentTunables().RequestLimit },
+		maxQueue: func() int { return config.CurrentTunables().RequestQueueLimit },
+		maxWait: func() time.Duration {
+			return time.Duration(config.CurrentTunables().RequestQueueWaitMS) * time.Millisecond
+		},
+	}
+}
+
+// Bytes of the body read before admission to find the clearAll field.
+const clearAllPeekSize = 256
+
+// Builds the ticket for a sync request. The body is only decoded after the request is admitted, so a ClearAll
+// resync is identified by peeking at the beginning of a JSON body without consuming it, or by the ?clearAll=true
+// query parameter for the other body formats.
+func newAdmissionTicket(clusterName string, r *http.Request, body *bufio.Reader) *admissionTicket {
+	ticket := &admissionTicket{clusterName: clusterName, priority: priorityIncremental, size: r.ContentLength}
+	if clusterName == "local-cluster" {
+		ticket.priority = priorityLocalCluster
+	} else if r.URL.Query().Get("clearAll") == "true" || (requestFormat(r) == contentTypeJSON && peekClearAll(body)) {
+		ticket.priority = priorityClearAll
+	}
+	return ticket
+}
+
+// Tells whether the JSON body sets clearAll before its first list. The collector sends clearAll first, the
+// fields before it are decoded from the peeked bytes and the search stops at anything that doesn't fit in them.
+func peekClearAll(body *bufio.Reader) bool {
+	prefix, _ := body.Peek(clearAllPeekSize) // Shorter when the body is.
+	decoder := json.NewDecoder(bytes.NewReader(prefix))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return false
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		key, ok := token.(string)
+		if err != nil || !ok {
+			return false
+		}
+		if strings.EqualFold(key, "clearAll") {
+			var clearAll bool
+			return decoder.Decode(&clearAll) == nil && clearAll
+		}
+		var ignored json.RawMessage
+		if err = decoder.Decode(&ignored); err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// Returns true if a should be admitted before b.
+func (a *admissionTicket) before(b *admissionTicket) bool {
+	if a.priority != b.priority {
+		return a.priority < b.priority
+	}
+	if a.size != b.size && a.size >= 0 && b.size >= 0 {
+		return a.size < b.size
+	}
+	return a.seq < b.seq
+}
+
+// Waits until the request is admitted. Returns an admissionError if the cluster already has a pending request,
+// the queue is full, or the wait expires. Returns the context error if the client goes away while waiting.
+// Admitted requests must call release() when done.
+func (q *admissionQueue) acquire(ctx context.Context, ticket *admissionTicket) error {
+	q.mutex.Lock()
+	if q.clusters[ticket.clusterName] {
+		q.mutex.Unlock()
+		return admissionError{
+			message:    "A previous request from this cluster is processing, retry later.",
+			retryAfter: q.retryAfter(0),
+		}
+	}
+	// The local-cluster is never rejected because of the queue limit.
+	if ticket.priority != priorityLocalCluster && q.active >= q.limit() && len(q.waiting) >= q.maxQueue() {
+		retryAfter := q.retryAfter(len(q.waiting))
+		q.mutex.Unlock()
+		glog.Warningf("Admission queue is full (%d). Rejecting sync from %s", q.maxQueue(), ticket.clusterName)
+		return admissionError{message: "Aggregator has many pending requests, retry later.", retryAfter: retryAfter}
+	}
+	ticket.seq = q.nextSeq
+	q.nextSeq++
+	ticket.ready = make(chan struct{})
+	q.clusters[ticket.clusterName] = true
+	q.waiting = append(q.waiting, ticket)
+	queuedRequestsGauge.Set(float64(len(q.waiting)))
+	q.dispatch()
+	q.mutex.Unlock()
+
+	timer := time.NewTimer(q.maxWait())
+	defer timer.Stop()
+	for waiting := true; waiting; {
+		select {
+		case <-ticket.ready:
+			return nil
+		case <-config.TunablesChanged():
+			// The request limit may have been raised.
+			q.mutex.Lock()
+			q.dispatch()
+			q.mutex.Unlock()
+		case <-timer.C:
+			waiting = false
+		case <-ctx.Done():
+			waiting = false
+		}
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if ticket.admitted { // Admitted while the wait expired.
+		return nil
+	}
+	q.remove(ticket)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	glog.Warningf("Sync request from %s waited %s in the admission queue. Rejecting.", ticket.clusterName, q.maxWait())
+	return admissionError{
+		message:    "Aggregator has many pending requests, retry later.",
+		retryAfter: q.retryAfter(len(q.waiting)),
+	}
+}
+
+// Frees the slot held by an admitted request and admits the next requests in the queue.
+func (q *admissionQueue) release(ticket *admissionTicket) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	duration := time.Since(ticket.start)
+	if q.avgDuration == 0 {
+		q.avgDuration = duration
+	} else {
+		q.avgDuration = time.Duration(syncDurationSmoothing*float64(duration) +
+			(1-syncDurationSmoothing)*float64(q.avgDuration))
+	}
+	q.active--
+	delete(q.clusters, ticket.clusterName)
+	q.dispatch()
+}
+
+// Admits the waiting requests with the highest priority while there are free slots.
+// The local-cluster is admitted even when all the slots are taken. Must be called with the mutex held.
+func (q *admissionQueue) dispatch() {
+	for len(q.waiting) > 0 {
+		next := q.waiting[0]
+		for _, ticket := range q.waiting[1:] {
+			if ticket.before(next) {
+				next = ticket
+			}
+		}
+		if q.active >= q.limit() && next.priority != priorityLocalCluster {
+			return
+		}
+		q.removeWaiting(next)
+		q.active++
+		next.admitted = true
+		next.start = time.Now()
+		close(next.ready)
+	}
+}
+
+// Removes a request that wasn't admitted. Must be called with the mutex held.
+func (q *admissionQueue) remove(ticket *admissionTicket) {
+	q.removeWaiting(ticket)
+	delete(q.clusters, ticket.clusterName)
+}
+
+func (q *admissionQueue) removeWaiting(ticket *admissionTicket) {
+	for i, waiting := range q.waiting {
+		if waiting == ticket {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			break
+		}
+	}
+	queuedRequestsGauge.Set(float64(len(q.waiting)))
+}
+
+// Estimates when a request would be admitted if it joined the queue behind depth requests, using the average
+// time a request holds a slot. Must be called with the mutex held.
+func (q *admissionQueue) retryAfter(depth int) time.Duration {
+	avgDuration := q.avgDuration
+	if avgDuration == 0 {
+		avgDuration = time.Second
+	}
+	limit := q.limit()
+	if limit < 1 {
+		limit = 1
+	}
+	return time.Duration(float64(depth+1) * float64(avgDuration) / float64(limit))
+}
+
+// Formats a duration for the Retry-After header, in whole seconds and at least 1.
+func retryAfterSeconds(retryAfter time.Duration) string {
+	return fmt.Sprintf("%d", int(math.Max(1, math.Ceil(retryAfter.Seconds()))))
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAdmissionQueue(limit, maxQueue int, maxWait time.Duration) *admissionQueue {
+	q := newAdmissionQueue()
+	q.limit = func() int { return limit }
+	q.maxQueue = func() int { return maxQueue }
+	q.maxWait = func() time.Duration { return maxWait }
+	return q
+}
+
+func newTestTicket(clusterName string, priority int, size int64) *admissionTicket {
+	return &admissionTicket{clusterName: clusterName, priority: priority, size: size}
+}
+
+func Test_newAdmissionTicket(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/aggregator/clusters/cluster1/sync?clearAll=true", nil)
+	r.ContentLength = 100
+	incrementalRequest, _ := http.NewRequest("POST", "/aggregator/clusters/cluster1/sync", nil)
+	noBody := func() *bufio.Reader { return bufio.NewReader(strings.NewReader("")) }
+
+	clearAll := newAdmissionTicket("cluster1", r, noBody())
+	incremental := newAdmissionTicket("cluster1", incrementalRequest, noBody())
+	local := newAdmissionTicket("local-cluster", r, noBody())
+
+	assert.Equal(t, priorityClearAll, clearAll.priority)
+	assert.Equal(t, int64(100), clearAll.size)
+	assert.Equal(t, priorityIncremental, incremental.priority)
+	assert.Equal(t, priorityLocalCluster, local.priority)
+}
+
+// The collector sends clearAll as the first field of the JSON body, without a query parameter.
+func Test_newAdmissionTicket_collectorBody(t *testing.T) {
+	collectorBody := `{"clearAll":true,"AddResources":[{"kind":"Pod","uid":"local-cluster/0b8a0b9c",` +
+		`"properties":{"kind":"Pod","name":"search-collector","namespace":"open-cluster-management",` +
+		`"label":{"app":"search"}}}],"UpdateResources":null,"DeleteResources":null,"AddEdges":[],` +
+		`"DeleteEdges":null,"RequestId":42}`
+	ticket := func(body string, contentType string) *admissionTicket {
+		r, _ := http.NewRequest("POST", "/aggregator/clusters/cluster1/sync", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		return newAdmissionTicket("cluster1", r, bufio.NewReader(strings.NewReader(body)))
+	}
+
+	assert.Equal(t, priorityClearAll, ticket(collectorBody, "application/json").priority)
+	assert.Equal(t, priorityClearAll, ticket(`{"RequestId": 7, "ClearAll": true}`, "application/json").priority)
+	assert.Equal(t, priorityIncremental, ticket(`{"AddResources":[],"RequestId":43}`, "application/json").priority)
+	assert.Equal(t, priorityIncremental, ticket(`{"clearAll":false,"AddResources":[]}`, "application/json").priority)
+	largeList := `{"AddResources":[` + strings.Repeat(`{"uid":"uid"},`, 50) + `{"uid":"uid"}],"clearAll":true}`
+	assert.Equal(t, priorityIncremental, ticket(largeList, "application/json").priority,
+		"The fields after the peeked bytes aren't found.")
+	assert.Equal(t, priorityIncremental, ticket(collectorBody, "application/msgpack").priority)
+}
+
+// Waiting requests should be admitted by priority, then by size.
+func Test_admissionQueue_priority(t *testing.T) {
+	q := newTestAdmissionQueue(1, 10, time.Minute)
+	first := newTestTicket("cluster0", priorityIncremental, 10)
+	assert.Nil(t, q.acquire(context.Background(), first))
+
+	tickets := []*admissionTicket{
+		newTestTicket("cluster1", priorityClearAll, 10),
+		newTestTicket("cluster2", priorityIncremental, 500),
+		newTestTicket("cluster3", priorityIncremental, 20),
+	}
+	admitted := make(chan string, len(tickets))
+	for _, ticket := range tickets {
+		go func(ticket *admissionTicket) {
+			assert.Nil(t, q.acquire(context.Background(), ticket))
+			admitted <- ticket.clusterName
+			q.release(ticket)
+		}(ticket)
+	}
+	assert.Eventually(t, func() bool {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		return len(q.waiting) == len(tickets)
+	}, time.Second, time.Millisecond)
+
+	q.release(first)
+	assert.Equal(t, "cluster3", <-admitted)
+	assert.Equal(t, "cluster2", <-admitted)
+	assert.Equal(t, "cluster1", <-admitted)
+}
+
+// The local-cluster should be admitted even when all the slots are taken.
+func Test_admissionQueue_localCluster(t *testing.T) {
+	q := newTestAdmissionQueue(1, 0, time.Millisecond)
+	assert.Nil(t, q.acquire(context.Background(), newTestTicket("cluster1", priorityIncremental, 10)))
+
+	assert.Nil(t, q.acquire(context.Background(), newTestTicket("local-cluster", priorityLocalCluster, 10)))
+}
+
+func Test_admissionQueue_waitExpires(t *testing.T) {
+	q := newTestAdmissionQueue(1, 10, 10*time.Millisecond)
+	assert.Nil(t, q.acquire(context.Background(), newTestTicket("cluster1", priorityIncremental, 10)))
+
+	err := q.acquire(context.Background(), newTestTicket("cluster2", priorityIncremental, 10))
+
+	assert.IsType(t, admissionError{}, err)
+	assert.Equal(t, time.Second, err.(admissionError).retryAfter)
+	assert.Empty(t, q.waiting)
+	assert.False(t, q.clusters["cluster2"])
+}
+
+func Test_admissionQueue_full(t *testing.T) {
+	q := newTestAdmissionQueue(1, 0, time.Minute)
+	assert.Nil(t, q.acquire(context.Background(), newTestTicket("cluster1", priorityIncremental, 10)))
+
+	err := q.acquire(context.Background(), newTestTicket("cluster2", priorityIncremental, 10))
+
+	assert.IsType(t, admissionError{}, err)
+}
+
+func Test_admissionQueue_duplicateCluster(t *testing.T) {
+	q := newTestAdmissionQueue(5, 10, time.Minute)
+	assert.Nil(t, q.acquire(context.Background(), newTestTicket("cluster1", priorityIncremental, 10)))
+
+	err := q.acquire(context.Background(), newTestTicket("cluster1", priorityIncremental, 10))
+
+	assert.EqualError(t, err, "A previous request from this cluster is processing, retry later.")
+}
+
+func Test_admissionQueue_retryAfter(t *testing.T) {
+	q := newTestAdmissionQueue(2, 10, time.Minute)
+	q.avgDuration = 4 * time.Second
+
+	assert.Equal(t, 6*time.Second, q.retryAfter(2))
+	assert.Equal(t, "1", retryAfterSeconds(100*time.Millisecond))
+	assert.Equal(t, "3", retryAfterSeconds(2500*time.Millisecond))
+}
+
+// Waiting requests should be admitted when REQUEST_LIMIT is raised at runtime.
+func Test_admissionQueue_limitReloaded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("REQUEST_LIMIT: 1\n"), 0600))
+	previousConfigFile := config.Cfg.ConfigFile
+	config.Cfg.ConfigFile = path
+	defer func() {
+		config.Cfg.ConfigFile = previousConfigFile
+		assert.NoError(t, config.Reload())
+	}()
+	assert.NoError(t, config.Reload())
+
+	q := newAdmissionQueue()
+	assert.Nil(t, q.acquire(context.Background(), newTestTicket("cluster1", priorityIncremental, 10)))
+	admitted := make(chan error)
+	go func() {
+		admitted <- q.acquire(context.Background(), newTestTicket("cluster2", priorityIncremental, 10))
+	}()
+	assert.Eventually(t, func() bool {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		return len(q.waiting) == 1
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, os.WriteFile(path, []byte("REQUEST_LIMIT: 2\n"), 0600))
+	assert.NoError(t, config.Reload())
+	select {
+	case err := <-admitted:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Error("The waiting request wasn't admitted after REQUEST_LIMIT was raised.")
+	}
+}
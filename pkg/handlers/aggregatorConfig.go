@@ -0,0 +1,36 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/stolostron/search-aggregator/pkg/config"
+)
+
+// AggregatorConfigResponse - Response to GET /aggregator/config
+type AggregatorConfigResponse struct {
+	Config  config.Config     // Effective config with the current tunables, the credentials and paths redacted.
+	Sources map[string]string // Source of each setting by environment variable: environment, config file or default.
+}
+
+// RequireDebugEndpoints - Responds with 404 unless DEBUG_ENDPOINTS is true. The debug endpoints don't require
+// authentication, so they are only served on request.
+func RequireDebugEndpoints(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.Cfg.DebugEndpoints != "true" {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// GetAggregatorConfig - Returns the effective configuration, to debug the deployment.
+func GetAggregatorConfig(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, AggregatorConfigResponse{
+		Config:  config.Effective().Redacted(),
+		Sources: config.Sources(),
+	})
+}
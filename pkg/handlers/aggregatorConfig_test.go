@@ -0,0 +1,53 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAggregatorConfig(t *testing.T) {
+	previousPassword, previousKeyFile := config.Cfg.RedisPassword, config.Cfg.RedisKeyFile
+	config.Cfg.RedisPassword, config.Cfg.RedisKeyFile = "secret", "/etc/redis/client.key"
+	defer func() { config.Cfg.RedisPassword, config.Cfg.RedisKeyFile = previousPassword, previousKeyFile }()
+
+	req, err := http.NewRequest("GET", "/aggregator/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(GetAggregatorConfig).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "secret")
+	assert.NotContains(t, rr.Body.String(), "/etc/redis/client.key")
+
+	var response AggregatorConfigResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "[REDACTED]", response.Config.RedisPassword)
+	assert.Equal(t, config.Cfg.RedisHost, response.Config.RedisHost)
+	assert.Contains(t, response.Sources, "BATCH_SIZE")
+}
+
+// The debug endpoints aren't served unless DEBUG_ENDPOINTS is true.
+func TestRequireDebugEndpoints(t *testing.T) {
+	previous := config.Cfg.DebugEndpoints
+	defer func() { config.Cfg.DebugEndpoints = previous }()
+	handler := RequireDebugEndpoints(GetAggregatorConfig)
+
+	config.Cfg.DebugEndpoints = "false"
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/aggregator/config", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	config.Cfg.DebugEndpoints = "true"
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/aggregator/config", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
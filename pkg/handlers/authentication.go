@@ -0,0 +1,166 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	"github.com/stolostron/search-aggregator/pkg/config"
+	authv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Time a validated token is trusted before it's reviewed again.
+const tokenReviewCacheTTL = time.Minute
+
+// Result of a TokenReview, cached by the hash of the token.
+type tokenReviewResult struct {
+	authenticated bool
+	user          authv1.UserInfo
+	expires       time.Time
+}
+
+// Validates bearer tokens with the Kubernetes TokenReview API.
+type tokenAuthenticator struct {
+	client kubernetes.Interface
+	mutex  sync.Mutex
+	cache  map[string]tokenReviewResult
+}
+
+var (
+	collectorAuthenticator     *tokenAuthenticator
+	collectorAuthenticatorOnce sync.Once
+)
+
+func newTokenAuthenticator(client kubernetes.Interface) *tokenAuthenticator {
+	return &tokenAuthenticator{client: client, cache: make(map[string]tokenReviewResult)}
+}
+
+func getCollectorAuthenticator() *tokenAuthenticator {
+	collectorAuthenticatorOnce.Do(func() {
+		var client kubernetes.Interface
+		if kubeClient := config.GetKubeClient(); kubeClient != nil {
+			client = kubeClient
+		}
+		collectorAuthenticator = newTokenAuthenticator(client)
+	})
+	return collectorAuthenticator
+}
+
+// Returns the user of a valid token. Returns false if the token isn't valid.
+func (a *tokenAuthenticator) authenticate(ctx context.Context, token string) (authv1.UserInfo, bool, error) {
+	hash := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(hash[:])
+
+	a.mutex.Lock()
+	cached, found := a.cache[key]
+	a.mutex.Unlock()
+	if found && time.Now().Before(cached.expires) {
+		return cached.user, cached.authenticated, nil
+	}
+
+	if a.client == nil {
+		return authv1.UserInfo{}, false, errors.New("the kube client isn't available")
+	}
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(ctx,
+		&authv1.TokenReview{Spec: authv1.TokenReviewSpec{Token: token}}, metav1.CreateOptions{})
+	if err != nil {
+		return authv1.UserInfo{}, false, err
+	}
+	result := tokenReviewResult{
+		authenticated: review.Status.Authenticated,
+		user:          review.Status.User,
+		expires:       time.Now().Add(tokenReviewCacheTTL),
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	// Remove the expired results, so tokens that are no longer used don't stay in memory.
+	for cachedKey, cachedResult := range a.cache {
+		if time.Now().After(cachedResult.expires) {
+			delete(a.cache, cachedKey)
+		}
+	}
+	a.cache[key] = result
+	return result.user, result.authenticated, nil
+}
+
+// Checks if the user is allowed to sync the cluster. The identities come from SYNC_ALLOWED_IDENTITIES,
+// where {cluster} is replaced with the cluster name. An identity matches the username or one of the groups.
+func identityAllowed(user authv1.UserInfo, clusterName string) bool {
+	for _, template := range strings.Split(config.Cfg.SyncAllowedIdentities, ",") {
+		template = strings.TrimSpace(template)
+		if template == "" {
+			continue
+		}
+		identity := strings.ReplaceAll(template, "{cluster}", clusterName)
+		if user.Username == identity {
+			return true
+		}
+		for _, group := range user.Groups {
+			if group == identity {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the token from the Authorization header, or an empty string if there isn't a bearer token.
+func bearerToken(r *http.Request) string {
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < len("Bearer ") || !strings.EqualFold(authHeader[:len("Bearer ")], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(authHeader[len("Bearer "):])
+}
+
+// AuthenticateCollector - Requires a bearer token from an identity allowed to sync the cluster in the request path.
+// Does nothing unless SYNC_AUTHENTICATION is true.
+func AuthenticateCollector(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.Cfg.SyncAuthentication != "true" {
+			next(w, r)
+			return
+		}
+		clusterName := mux.Vars(r)["id"]
+
+		token := bearerToken(r)
+		if token == "" {
+			glog.Warningf("Rejecting sync request for cluster %s without a bearer token.", clusterName)
+			http.Error(w, "A bearer token is required.", http.StatusUnauthorized)
+			return
+		}
+
+		user, authenticated, err := getCollectorAuthenticator().authenticate(r.Context(), token)
+		if err != nil {
+			glog.Errorf("Error reviewing the token of a sync request for cluster %s. %s", clusterName, err)
+			http.Error(w, "Unable to validate the token, retry later.", http.StatusServiceUnavailable)
+			return
+		}
+		if !authenticated {
+			glog.Warningf("Rejecting sync request for cluster %s with an invalid token.", clusterName)
+			http.Error(w, "The bearer token isn't valid.", http.StatusUnauthorized)
+			return
+		}
+		if !identityAllowed(user, clusterName) {
+			glog.Warningf("Rejecting sync request for cluster %s. User %s isn't allowed to sync this cluster.",
+				clusterName, user.Username)
+			http.Error(w, "Not allowed to sync this cluster.", http.StatusForbidden)
+			return
+		}
+		glog.V(4).Infof("Sync request for cluster %s authenticated as %s", clusterName, user.Username)
+		next(w, r)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Uses a fake clientset that accepts the token "valid-token" for the given user.
+func mockTokenReview(user authv1.UserInfo) *int {
+	reviews := 0
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authv1.TokenReview)
+		if review.Spec.Token == "valid-token" {
+			review.Status = authv1.TokenReviewStatus{Authenticated: true, User: user}
+		}
+		return true, review, nil
+	})
+	collectorAuthenticatorOnce.Do(func() {})
+	collectorAuthenticator = newTokenAuthenticator(client)
+	return &reviews
+}
+
+func runAuthenticatedSync(t *testing.T, clusterName, authHeader string) *httptest.ResponseRecorder {
+	config.Cfg.SyncAuthentication = "true"
+	defer func() { config.Cfg.SyncAuthentication = "false" }()
+
+	req, err := http.NewRequest("POST", "/aggregator/clusters/"+clusterName+"/sync", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/sync", AuthenticateCollector(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAuthenticateCollector(t *testing.T) {
+	reviews := mockTokenReview(authv1.UserInfo{Username: "system:serviceaccount:cluster1:search-collector"})
+
+	assert.Equal(t, http.StatusOK, runAuthenticatedSync(t, "cluster1", "Bearer valid-token").Code)
+	assert.Equal(t, http.StatusOK, runAuthenticatedSync(t, "cluster1", "Bearer valid-token").Code)
+	assert.Equal(t, 1, *reviews, "The result of the TokenReview should be cached.")
+}
+
+func TestAuthenticateCollector_otherCluster(t *testing.T) {
+	mockTokenReview(authv1.UserInfo{Username: "system:serviceaccount:cluster1:search-collector"})
+
+	rr := runAuthenticatedSync(t, "cluster2", "Bearer valid-token")
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestAuthenticateCollector_invalidToken(t *testing.T) {
+	mockTokenReview(authv1.UserInfo{})
+
+	assert.Equal(t, http.StatusUnauthorized, runAuthenticatedSync(t, "cluster1", "Bearer other-token").Code)
+	assert.Equal(t, http.StatusUnauthorized, runAuthenticatedSync(t, "cluster1", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, runAuthenticatedSync(t, "cluster1", "Basic dXNlcjpwYXNz").Code)
+}
+
+func Test_identityAllowed_group(t *testing.T) {
+	config.Cfg.SyncAllowedIdentities = "system:open-cluster-management:cluster:{cluster}:addon:search-collector"
+	defer func() { config.Cfg.SyncAllowedIdentities = config.DEFAULT_SYNC_ALLOWED_IDENTITIES }()
+	user := authv1.UserInfo{
+		Username: "agent",
+		Groups:   []string{"system:open-cluster-management:cluster:cluster1:addon:search-collector"},
+	}
+
+	assert.True(t, identityAllowed(user, "cluster1"))
+	assert.False(t, identityAllowed(user, "cluster2"))
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	"github.com/stolostron/search-aggregator/pkg/config"
+)
+
+// Checks if the certificate was issued to the cluster, either in the Common Name or a DNS Subject Alternative Name.
+func certificateMatchesCluster(cert *x509.Certificate, clusterName string) bool {
+	if cert.Subject.CommonName == clusterName {
+		return true
+	}
+	for _, dnsName := range cert.DNSNames {
+		if dnsName == clusterName {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyClientCertificate - Requires a client certificate issued to the cluster in the request path.
+// The certificate is verified against CLIENT_CA_FILE during the TLS handshake.
+// Does nothing unless CLIENT_CA_FILE is set.
+func VerifyClientCertificate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.Cfg.ClientCAFile == "" {
+			next(w, r)
+			return
+		}
+		clusterName := mux.Vars(r)["id"]
+
+		// The TLS server only fills the verified chains for certificates signed by the client CA.
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			glog.Warningf("Rejecting sync request for cluster %s without a verified client certificate.", clusterName)
+			http.Error(w, "A client certificate is required.", http.StatusUnauthorized)
+			return
+		}
+		cert := r.TLS.VerifiedChains[0][0]
+		if !certificateMatchesCluster(cert, clusterName) {
+			glog.Warningf("Rejecting sync request for cluster %s. The client certificate was issued to %s.",
+				clusterName, cert.Subject.CommonName)
+			http.Error(w, "The client certificate doesn't match this cluster.", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func runSyncWithCertificate(t *testing.T, clusterName string, cert *x509.Certificate) *httptest.ResponseRecorder {
+	config.Cfg.ClientCAFile = "ca.crt"
+	defer func() { config.Cfg.ClientCAFile = "" }()
+
+	req, err := http.NewRequest("POST", "/aggregator/clusters/"+clusterName+"/sync", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/sync", VerifyClientCertificate(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestVerifyClientCertificate(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "cluster1"}}
+
+	assert.Equal(t, http.StatusOK, runSyncWithCertificate(t, "cluster1", cert).Code)
+	assert.Equal(t, http.StatusForbidden, runSyncWithCertificate(t, "cluster2", cert).Code)
+	assert.Equal(t, http.StatusUnauthorized, runSyncWithCertificate(t, "cluster1", nil).Code)
+}
+
+func TestVerifyClientCertificate_subjectAltName(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "search-collector"}, DNSNames: []string{"cluster1"}}
+
+	assert.Equal(t, http.StatusOK, runSyncWithCertificate(t, "cluster1", cert).Code)
+}
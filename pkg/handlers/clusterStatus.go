@@ -0,0 +1,184 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	"github.com/stolostron/search-aggregator/pkg/config"
+	db "github.com/stolostron/search-aggregator/pkg/dbconnector"
+)
+
+// In memory sync state of each known cluster that has sent a sync request since the aggregator started.
+type clusterSyncState struct {
+	lastSuccessfulSync      time.Time
+	lastSuccessfulRequestId int
+	lastError               string
+	lastErrorTime           time.Time
+	recentResponses         []cachedSyncResponse // Oldest first.
+}
+
+var (
+	clusterSyncStates      = make(map[string]*clusterSyncState)
+	clusterSyncStatesMutex = sync.RWMutex{}
+)
+
+// AggregatorStatusResponse - Response to GET /aggregator/status
+type AggregatorStatusResponse struct {
+	TotalClusters   int // Cluster nodes in the graph.
+	PendingRequests int
+	Clusters        []ClusterStatusResponse // Clusters that have sent a sync request since the aggregator started.
+	Version         string
+}
+
+// ClusterStatusResponse - Response to GET /aggregator/clusters/{id}/status
+type ClusterStatusResponse struct {
+	ClusterName             string
+	LastSuccessfulSync      *time.Time `json:",omitempty"`
+	LastSuccessfulRequestId int
+	LastError               string     `json:",omitempty"`
+	LastErrorTime           *time.Time `json:",omitempty"`
+	SyncPending             bool
+	TotalResources          int `json:",omitempty"` // Only in the status of a single cluster.
+	TotalEdges              int `json:",omitempty"` // Only in the status of a single cluster.
+}
+
+// Records the result of a sync request from a cluster.
+func recordSyncResult(clusterName string, status int, response SyncResponse) {
+	clusterSyncStatesMutex.Lock()
+	defer clusterSyncStatesMutex.Unlock()
+	state, exists := clusterSyncStates[clusterName]
+	if !exists {
+		state = &clusterSyncState{}
+		clusterSyncStates[clusterName] = state
+	}
+	if status == http.StatusOK {
+		state.lastSuccessfulSync = time.Now()
+		state.lastSuccessfulRequestId = response.RequestId
+	} else {
+		state.lastError = syncErrorMessage(status, response)
+		state.lastErrorTime = time.Now()
+	}
+}
+
+// Records a sync request rejected before the cluster was validated. Only a cluster that already has a recorded
+// state is updated, so requests for any cluster name don't grow the states.
+func recordSyncRejection(clusterName string, status int) {
+	clusterSyncStatesMutex.Lock()
+	defer clusterSyncStatesMutex.Unlock()
+	if state, exists := clusterSyncStates[clusterName]; exists {
+		state.lastError = syncErrorMessage(status, SyncResponse{})
+		state.lastErrorTime = time.Now()
+	}
+}
+
+// Summarizes why a sync request failed.
+func syncErrorMessage(status int, response SyncResponse) string {
+	resourceErrors := len(response.AddErrors) + len(response.UpdateErrors) + len(response.DeleteErrors)
+	edgeErrors := len(response.AddEdgeErrors) + len(response.DeleteEdgeErrors)
+	switch {
+	case status == http.StatusTooManyRequests:
+		return fmt.Sprintf("Request rejected with status %d, the aggregator is busy.", status)
+	case status == http.StatusConflict:
+		return fmt.Sprintf("Request %d was out of order, a resync was requested.", response.RequestId)
+	case status == http.StatusServiceUnavailable:
+		return fmt.Sprintf("Request %d failed with status %d, RedisGraph is unavailable.", response.RequestId, status)
+	case resourceErrors > 0 || edgeErrors > 0:
+		return fmt.Sprintf("Request %d failed with status %d, %d resource errors and %d edge errors.",
+			response.RequestId, status, resourceErrors, edgeErrors)
+	default:
+		return fmt.Sprintf("Request %d failed with status %d.", response.RequestId, status)
+	}
+}
+
+// Builds the status of a cluster from the recorded state. Returns false if the cluster hasn't sent any request.
+func getClusterSyncStatus(clusterName string) (ClusterStatusResponse, bool) {
+	status := ClusterStatusResponse{ClusterName: clusterName}
+
+	PendingRequestsMutex.RLock()
+	_, status.SyncPending = PendingRequests[clusterName]
+	PendingRequestsMutex.RUnlock()
+
+	clusterSyncStatesMutex.RLock()
+	defer clusterSyncStatesMutex.RUnlock()
+	state, exists := clusterSyncStates[clusterName]
+	if !exists {
+		return status, status.SyncPending
+	}
+	if !state.lastSuccessfulSync.IsZero() {
+		lastSync := state.lastSuccessfulSync
+		status.LastSuccessfulSync = &lastSync
+		status.LastSuccessfulRequestId = state.lastSuccessfulRequestId
+	}
+	if state.lastError != "" {
+		lastErrorTime := state.lastErrorTime
+		status.LastError = state.lastError
+		status.LastErrorTime = &lastErrorTime
+	}
+	return status, true
+}
+
+// GetAggregatorStatus - Returns the number of clusters and the sync status of each cluster.
+func GetAggregatorStatus(w http.ResponseWriter, r *http.Request) {
+	response := AggregatorStatusResponse{
+		TotalClusters: computeClusterCount(),
+		Clusters:      []ClusterStatusResponse{},
+		Version:       config.AGGREGATOR_API_VERSION,
+	}
+
+	PendingRequestsMutex.RLock()
+	response.PendingRequests = len(PendingRequests)
+	PendingRequestsMutex.RUnlock()
+
+	clusterSyncStatesMutex.RLock()
+	clusterNames := make([]string, 0, len(clusterSyncStates))
+	for clusterName := range clusterSyncStates {
+		clusterNames = append(clusterNames, clusterName)
+	}
+	clusterSyncStatesMutex.RUnlock()
+	sort.Strings(clusterNames)
+
+	for _, clusterName := range clusterNames {
+		if status, exists := getClusterSyncStatus(clusterName); exists {
+			response.Clusters = append(response.Clusters, status)
+		}
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// GetClusterStatus - Returns the sync status and the number of resources and edges of a cluster.
+func GetClusterStatus(w http.ResponseWriter, r *http.Request) {
+	clusterName := mux.Vars(r)["id"]
+	if err := db.ValidateClusterName(clusterName); err != nil {
+		glog.Warning("Invalid Cluster Name: ", clusterName)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status, tracked := getClusterSyncStatus(clusterName)
+	if !tracked && !clusterNodeExists(clusterName) {
+		http.Error(w, fmt.Sprintf("Cluster %s not found.", clusterName), http.StatusNotFound)
+		return
+	}
+	status.TotalResources = computeNodeCount(clusterName)
+	status.TotalEdges = computeIntraEdges(clusterName)
+
+	respondJSON(w, http.StatusOK, status)
+}
+
+func respondJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		glog.Error("Error encoding response: ", err)
+	}
+}
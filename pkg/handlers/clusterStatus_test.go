@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	db "github.com/stolostron/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+func getClusterStatusResponse(t *testing.T, clusterName string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", "/aggregator/clusters/"+clusterName+"/status", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": clusterName})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(GetClusterStatus).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGetClusterStatus(t *testing.T) {
+	db.Store = MockCache{}
+	recordSyncResult("status-cluster-1", http.StatusOK, SyncResponse{RequestId: 7})
+	recordSyncResult("status-cluster-1", http.StatusServiceUnavailable, SyncResponse{RequestId: 8})
+
+	rr := getClusterStatusResponse(t, "status-cluster-1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var status ClusterStatusResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+	assert.Equal(t, "status-cluster-1", status.ClusterName)
+	assert.NotNil(t, status.LastSuccessfulSync)
+	assert.Equal(t, 7, status.LastSuccessfulRequestId)
+	assert.Equal(t, "Request 8 failed with status 503, RedisGraph is unavailable.", status.LastError)
+	assert.False(t, status.SyncPending)
+}
+
+func TestGetClusterStatus_notFound(t *testing.T) {
+	db.Store = MockCache{}
+	rr := getClusterStatusResponse(t, "unknown-cluster")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = getClusterStatusResponse(t, "bad=cluster")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestGetAggregatorStatus(t *testing.T) {
+	db.Store = MockCache{}
+	recordSyncResult("status-cluster-2", http.StatusBadRequest,
+		SyncResponse{RequestId: 3, AddErrors: []SyncError{{ResourceUID: "uid-1", Message: "error"}}})
+
+	req, err := http.NewRequest("GET", "/aggregator/status", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(GetAggregatorStatus).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var status AggregatorStatusResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+	found := false
+	for _, cluster := range status.Clusters {
+		if cluster.ClusterName == "status-cluster-2" {
+			found = true
+			assert.Nil(t, cluster.LastSuccessfulSync)
+			assert.Equal(t, "Request 3 failed with status 400, 1 resource errors and 0 edge errors.", cluster.LastError)
+		}
+	}
+	assert.True(t, found, "Expected the status of status-cluster-2.")
+}
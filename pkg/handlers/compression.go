@@ -0,0 +1,112 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stolostron/search-aggregator/pkg/config"
+)
+
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+)
+
+// Wraps the request body to decompress it according to the Content-Encoding header. The reads fail with an
+// *http.MaxBytesError past MAX_REQUEST_BODY_MB of decompressed data, so a small compressed body can't expand
+// without bound. Returns an error if the encoding isn't supported or the compressed stream is invalid.
+func decompressRequestBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	limit := int64(config.Cfg.MaxRequestBodyMB) << 20
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return http.MaxBytesReader(w, r.Body, limit), nil
+	case encodingGzip, "x-gzip":
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return http.MaxBytesReader(w, gzipReader, limit), nil
+	case encodingZstd:
+		zstdReader, err := zstd.NewReader(r.Body, zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(limit)))
+		if err != nil {
+			return nil, err
+		}
+		return http.MaxBytesReader(w, zstdReader.IOReadCloser(), limit), nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding: %s", encoding)
+	}
+}
+
+// Tells whether the request body was larger than MAX_REQUEST_BODY_MB. The zstd decoder fails before reading
+// a frame that declares a larger size.
+func isBodyTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge) || errors.Is(err, zstd.ErrDecoderSizeExceeded)
+}
+
+// ResponseWriter that compresses everything written to the body.
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	writer io.WriteCloser
+}
+
+func (c compressedResponseWriter) Write(b []byte) (int, error) {
+	return c.writer.Write(b)
+}
+
+// Returns the first supported encoding listed in the Accept-Encoding header, or an empty string.
+func acceptedEncoding(r *http.Request) string {
+	for _, accepted := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		// Ignore the quality values, but skip encodings explicitly refused with q=0.
+		parts := strings.Split(accepted, ";")
+		encoding := strings.ToLower(strings.TrimSpace(parts[0]))
+		if len(parts) > 1 && strings.ReplaceAll(strings.TrimSpace(parts[1]), " ", "") == "q=0" {
+			continue
+		}
+		if encoding == encodingGzip || encoding == encodingZstd {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// Wraps the ResponseWriter to compress the response with an encoding accepted by the client.
+// Returns the original writer if the client doesn't accept any supported encoding.
+// The returned function must be called after writing the response to flush the compressed stream.
+func compressResponse(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	encoding := acceptedEncoding(r)
+	var writer io.WriteCloser
+	switch encoding {
+	case encodingGzip:
+		writer = gzip.NewWriter(w)
+	case encodingZstd:
+		zstdWriter, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			glog.Warning("Unable to create zstd writer, responding uncompressed. ", err)
+			return w, func() {}
+		}
+		writer = zstdWriter
+	default:
+		return w, func() {}
+	}
+
+	w.Header().Set("Content-Encoding", encoding)
+	w.Header().Add("Vary", "Accept-Encoding")
+	w.Header().Del("Content-Length")
+	return compressedResponseWriter{ResponseWriter: w, writer: writer}, func() {
+		if err := writer.Close(); err != nil {
+			glog.Warning("Error closing compressed response. ", err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPayload = `{"clearAll":true,"RequestId":1}`
+
+func newCompressedRequest(t *testing.T, encoding string, body []byte) *http.Request {
+	req, err := http.NewRequest("POST", "/aggregator/clusters/cluster1/sync", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Encoding", encoding)
+	return req
+}
+
+func Test_decompressRequestBody_gzip(t *testing.T) {
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, _ = gzipWriter.Write([]byte(testPayload))
+	assert.NoError(t, gzipWriter.Close())
+
+	body, err := decompressRequestBody(httptest.NewRecorder(), newCompressedRequest(t, "gzip", compressed.Bytes()))
+	assert.NoError(t, err)
+	decoded, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, testPayload, string(decoded))
+}
+
+func Test_decompressRequestBody_zstd(t *testing.T) {
+	encoder, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+	compressed := encoder.EncodeAll([]byte(testPayload), nil)
+
+	body, err := decompressRequestBody(httptest.NewRecorder(), newCompressedRequest(t, "zstd", compressed))
+	assert.NoError(t, err)
+	decoded, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, testPayload, string(decoded))
+}
+
+func Test_decompressRequestBody_unsupported(t *testing.T) {
+	_, err := decompressRequestBody(httptest.NewRecorder(), newCompressedRequest(t, "br", []byte(testPayload)))
+	assert.EqualError(t, err, "unsupported Content-Encoding: br")
+
+	body, err := decompressRequestBody(httptest.NewRecorder(), newCompressedRequest(t, "", []byte(testPayload)))
+	assert.NoError(t, err)
+	decoded, _ := io.ReadAll(body)
+	assert.Equal(t, testPayload, string(decoded), "Uncompressed bodies are read as is.")
+}
+
+// A small compressed body can't expand past MAX_REQUEST_BODY_MB.
+func Test_decompressRequestBody_tooLarge(t *testing.T) {
+	previousLimit := config.Cfg.MaxRequestBodyMB
+	config.Cfg.MaxRequestBodyMB = 1
+	defer func() { config.Cfg.MaxRequestBodyMB = previousLimit }()
+	payload := bytes.Repeat([]byte(" "), 2<<20)
+
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, _ = gzipWriter.Write(payload)
+	assert.NoError(t, gzipWriter.Close())
+	encoder, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+
+	for encoding, compressed := range map[string][]byte{"gzip": gzipped.Bytes(), "zstd": encoder.EncodeAll(payload, nil),
+		"": payload} {
+		body, err := decompressRequestBody(httptest.NewRecorder(), newCompressedRequest(t, encoding, compressed))
+		assert.NoError(t, err)
+		decoded, err := io.ReadAll(body)
+		assert.True(t, isBodyTooLarge(err), "Expected the %q body to be too large, got: %v", encoding, err)
+		assert.LessOrEqual(t, len(decoded), 1<<20)
+	}
+}
+
+func Test_compressResponse(t *testing.T) {
+	req := newCompressedRequest(t, "", nil)
+	req.Header.Set("Accept-Encoding", "br;q=1.0, gzip;q=0.8")
+	rr := httptest.NewRecorder()
+
+	w, closeResponse := compressResponse(rr, req)
+	_, _ = w.Write([]byte(testPayload))
+	closeResponse()
+
+	assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	gzipReader, err := gzip.NewReader(rr.Body)
+	assert.NoError(t, err)
+	decoded, _ := io.ReadAll(gzipReader)
+	assert.Equal(t, testPayload, string(decoded))
+}
+
+func Test_acceptedEncoding(t *testing.T) {
+	req := newCompressedRequest(t, "", nil)
+	assert.Equal(t, "", acceptedEncoding(req))
+
+	req.Header.Set("Accept-Encoding", "zstd;q=0, gzip")
+	assert.Equal(t, "gzip", acceptedEncoding(req), "Encodings with q=0 must be skipped.")
+
+	req.Header.Set("Accept-Encoding", "zstd, gzip")
+	assert.Equal(t, "zstd", acceptedEncoding(req))
+}
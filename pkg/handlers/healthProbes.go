@@ -12,33 +12,107 @@ Copyright (c) 2020 Red Hat, Inc.
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/golang/glog"
+	"github.com/stolostron/search-aggregator/pkg/clustermgmt"
+	"github.com/stolostron/search-aggregator/pkg/config"
+	db "github.com/stolostron/search-aggregator/pkg/dbconnector"
 )
 
+// Status values reported for each component of the readiness probe.
+const (
+	statusOK       = "OK"
+	statusError    = "Error"
+	statusNotFound = "NotFound"
+	statusSyncing  = "Syncing"
+)
+
+// Dependencies of the readiness probe and the sync requests, replaced in tests.
+var (
+	checkRedisHealth       = db.CheckRedisHealth
+	clusterInformersSynced = clustermgmt.InformersSynced
+	redisCircuitState      = db.CircuitBreakerState
+)
+
+// ReadinessResponse - Response of the readiness probe with the status of each component.
+type ReadinessResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// ComponentStatus - Status of a component checked by the readiness probe.
+type ComponentStatus struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message,omitempty"`
+	Details map[string]bool `json:"details,omitempty"`
+}
+
 // LivenessProbe is used to check if this service is alive.
 func LivenessProbe(w http.ResponseWriter, r *http.Request) {
 	glog.V(2).Info("livenessProbe")
 	fmt.Fprint(w, "OK")
 }
 
-// ReadinessProbe checks if Redis is available.
+// ReadinessProbe checks if RedisGraph is available and the cluster informers have synced.
 func ReadinessProbe(w http.ResponseWriter, r *http.Request) {
-	glog.V(2).Info("readinessProbe - Checking Redis connection.")
-
-	// Go straight to the pool's Dial because we don't actually want to play by the pool's
-	// rules here - just want a connection unrelated to all the other ones,
-	// conn, err := db.Pool.Dial()
-	// if err != nil {
-	// 	// Respond with error.
-	// 	glog.Warning("Unable to reach Redis.")
-	// 	http.Error(w, "Unable to reach Redis.", 503)
-	// 	return
-	// }
-
-	// defer conn.Close()
-	// Respond with success
-	fmt.Fprint(w, "OK")
+	glog.V(2).Info("readinessProbe - Checking Redis connection and cluster informers.")
+	response := ReadinessResponse{Status: statusOK, Components: make(map[string]ComponentStatus)}
+	ready := true
+
+	// Use a dedicated connection instead of the pool, so the probe isn't blocked behind pending sync requests.
+	health := checkRedisHealth(time.Duration(config.Cfg.ReadinessTimeoutMS) * time.Millisecond)
+	if health.RedisError != nil {
+		glog.Warning("Readiness probe unable to reach Redis. ", health.RedisError)
+		ready = false
+		response.Components["redis"] = ComponentStatus{Status: statusError, Message: health.RedisError.Error()}
+		response.Components["graph"] = ComponentStatus{Status: statusError, Message: "Redis is unavailable."}
+	} else {
+		response.Components["redis"] = ComponentStatus{Status: statusOK}
+		if health.GraphError != nil {
+			glog.Warning("Readiness probe unable to read the graph. ", health.GraphError)
+			ready = false
+			response.Components["graph"] = ComponentStatus{Status: statusError, Message: health.GraphError.Error()}
+		} else if !health.GraphExists {
+			// Not an error, the graph gets created with the first write.
+			response.Components["graph"] = ComponentStatus{Status: statusNotFound,
+				Message: fmt.Sprintf("Graph %s will be created on the first write.", db.GRAPH_NAME)}
+		} else {
+			response.Components["graph"] = ComponentStatus{Status: statusOK}
+		}
+	}
+
+	// Sync requests fail fast while the circuit is open, so the aggregator isn't ready. It's ready again when the
+	// circuit is half-open, to let a sync request probe Redis.
+	switch state, retryAfter := redisCircuitState(); state {
+	case db.CircuitOpen:
+		ready = false
+		response.Components["circuitBreaker"] = ComponentStatus{Status: string(state),
+			Message: fmt.Sprintf("Failing Redis queries after repeated connection errors, retry in %s.",
+				retryAfter.Round(time.Millisecond))}
+	case db.CircuitHalfOpen:
+		response.Components["circuitBreaker"] = ComponentStatus{Status: string(state)}
+	default:
+		response.Components["circuitBreaker"] = ComponentStatus{Status: statusOK}
+	}
+
+	synced, informers := clusterInformersSynced()
+	if synced {
+		response.Components["clusterInformers"] = ComponentStatus{Status: statusOK, Details: informers}
+	} else {
+		ready = false
+		response.Components["clusterInformers"] = ComponentStatus{Status: statusSyncing, Details: informers}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		response.Status = statusError
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		glog.Error("Error encoding readiness response: ", err)
+	}
 }
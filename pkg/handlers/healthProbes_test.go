@@ -4,9 +4,15 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	db "github.com/stolostron/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
 )
 
 // Test the liveness probe.
@@ -40,64 +46,105 @@ func TestLivenessProbe(t *testing.T) {
 	}
 }
 
-// Test the readiness probe.
-/*func TestReadinessProbe_unableToConnect(t *testing.T) {
-	// Create a request to pass to our handler. We don't have any query parameters for now, so we'll
-	// pass 'nil' as the third parameter.
+// Replaces the readiness probe dependencies for the duration of a test.
+func mockReadinessChecks(t *testing.T, health db.HealthStatus, synced bool) {
+	origRedis, origInformers := checkRedisHealth, clusterInformersSynced
+	checkRedisHealth = func(time.Duration) db.HealthStatus { return health }
+	clusterInformersSynced = func() (bool, map[string]bool) {
+		return synced, map[string]bool{"cluster.open-cluster-management.io/v1": synced}
+	}
+	t.Cleanup(func() { checkRedisHealth, clusterInformersSynced = origRedis, origInformers })
+}
+
+func runReadinessProbe(t *testing.T) (*httptest.ResponseRecorder, ReadinessResponse) {
 	req, err := http.NewRequest("GET", "/readiness", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	// We create a ResponseRecorder (which satisfies http.ResponseWriter) to record the response.
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(ReadinessProbe)
+	http.HandlerFunc(ReadinessProbe).ServeHTTP(rr, req)
 
-	// Our handlers satisfy http.Handler, so we can call their ServeHTTP method
-	// directly and pass in our Request and ResponseRecorder.
-	handler.ServeHTTP(rr, req)
-
-	// Check the status code is what we expect.
-	if status := rr.Code; status != http.StatusServiceUnavailable {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusServiceUnavailable)
+	var response ReadinessResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Unable to decode readiness response %s: %s", rr.Body.String(), err)
 	}
+	return rr, response
+}
 
-	// Check the response body is what we expect.
-	expected := "Unable to reach Redis.\n"
-	if rr.Body.String() != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			rr.Body.String(), expected)
-	}
-}*/
+// Test the readiness probe when Redis can't be reached.
+func TestReadinessProbe_unableToConnect(t *testing.T) {
+	mockReadinessChecks(t, db.HealthStatus{RedisError: errors.New("connection refused")}, true)
+
+	rr, response := runReadinessProbe(t)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "Error", response.Status)
+	assert.Equal(t, "Error", response.Components["redis"].Status)
+	assert.Equal(t, "connection refused", response.Components["redis"].Message)
+	assert.Equal(t, "Error", response.Components["graph"].Status)
+}
 
-// Test the readiness probe.
+// Test the readiness probe when all the components are available.
 func TestReadinessProbe_ableToConnect(t *testing.T) {
-	// Create a request to pass to our handler. We don't have any query parameters for now, so we'll
-	// pass 'nil' as the third parameter.
-	req, err := http.NewRequest("GET", "/readiness", nil)
-	if err != nil {
-		t.Fatal(err)
-	}
+	mockReadinessChecks(t, db.HealthStatus{GraphExists: true}, true)
 
-	// We create a ResponseRecorder (which satisfies http.ResponseWriter) to record the response.
-	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(ReadinessProbe)
+	rr, response := runReadinessProbe(t)
 
-	// Our handlers satisfy http.Handler, so we can call their ServeHTTP method
-	// directly and pass in our Request and ResponseRecorder.
-	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "OK", response.Status)
+	assert.Equal(t, "OK", response.Components["redis"].Status)
+	assert.Equal(t, "OK", response.Components["graph"].Status)
+	assert.Equal(t, "OK", response.Components["clusterInformers"].Status)
+	assert.Equal(t, "OK", response.Components["circuitBreaker"].Status)
+}
 
-	// Check the status code is what we expect.
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusServiceUnavailable)
-	}
+// A missing graph is expected before the first write and shouldn't fail the probe.
+func TestReadinessProbe_graphNotFound(t *testing.T) {
+	mockReadinessChecks(t, db.HealthStatus{}, true)
 
-	// Check the response body is what we expect.
-	expected := "OK"
-	if rr.Body.String() != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			rr.Body.String(), expected)
-	}
+	rr, response := runReadinessProbe(t)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "NotFound", response.Components["graph"].Status)
+}
+
+// Test the readiness probe before the cluster informers have synced.
+func TestReadinessProbe_informersNotSynced(t *testing.T) {
+	mockReadinessChecks(t, db.HealthStatus{GraphExists: true}, false)
+
+	rr, response := runReadinessProbe(t)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "Syncing", response.Components["clusterInformers"].Status)
+	assert.Equal(t, false, response.Components["clusterInformers"].Details["cluster.open-cluster-management.io/v1"])
+}
+
+// Replaces the state of the Redis circuit breaker for the duration of a test.
+func mockCircuitState(t *testing.T, state db.CircuitState, retryAfter time.Duration) {
+	orig := redisCircuitState
+	redisCircuitState = func() (db.CircuitState, time.Duration) { return state, retryAfter }
+	t.Cleanup(func() { redisCircuitState = orig })
+}
+
+// The aggregator isn't ready while the circuit breaker fails the Redis queries.
+func TestReadinessProbe_circuitOpen(t *testing.T) {
+	mockReadinessChecks(t, db.HealthStatus{GraphExists: true}, true)
+	mockCircuitState(t, db.CircuitOpen, 5*time.Second)
+
+	rr, response := runReadinessProbe(t)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "Open", response.Components["circuitBreaker"].Status)
+	assert.Contains(t, response.Components["circuitBreaker"].Message, "retry in 5s")
+}
+
+// A half-open circuit lets requests probe Redis, so the aggregator is ready.
+func TestReadinessProbe_circuitHalfOpen(t *testing.T) {
+	mockReadinessChecks(t, db.HealthStatus{GraphExists: true}, true)
+	mockCircuitState(t, db.CircuitHalfOpen, 0)
+
+	rr, response := runReadinessProbe(t)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "HalfOpen", response.Components["circuitBreaker"].Status)
 }
@@ -65,6 +65,26 @@ func computeIntraEdges(clusterName string) int {
 	return 0
 }
 
+// computeClusterCount counts the Cluster nodes in the graph.
+func computeClusterCount() int {
+	resp, err := db.TotalClusters()
+	if err != nil {
+		glog.Error("Error fetching cluster count: ", err)
+		return 0
+	}
+	//Iterating to next record to get count - count is in the first index(0) of the first record
+	for resp.Next() {
+		record := resp.Record()
+		countInterface := record.GetByIndex(0)
+		if count, ok := countInterface.(int); ok {
+			return count
+		} else {
+			glog.Error("Could not parse cluster count results")
+		}
+	}
+	return 0
+}
+
 func assertClusterNode(clusterName string) bool {
 	if clusterName == "local-cluster" || config.Cfg.SkipClusterValidation == "true" {
 		_, err := db.MergeDummyCluster(clusterName)
@@ -72,27 +92,32 @@ func assertClusterNode(clusterName string) bool {
 			glog.Error("Could not merge local cluster Cluster resource: ", err)
 			return false
 		}
-	} else {
-		resp, err := db.CheckClusterResource(clusterName)
-		if err != nil {
-			glog.Error("Could not check cluster resource by name: ", err)
-			return false
-		}
-		if resp.Empty() {
-			glog.Infof("Cluster %s does not exist.", clusterName)
-			return false
-		}
-		//Iterating to next record to get count - count is in the first index(0) of the first record
-		for resp.Next() {
-			record := resp.Record()
-			countInterface := record.GetByIndex(0)
-			if count, ok := countInterface.(int); ok {
-				if count <= 0 {
-					return false
-				}
-			} else {
-				glog.Errorf("Could not parse Cluster count results for cluster %s", clusterName)
+		return true
+	}
+	return clusterNodeExists(clusterName)
+}
+
+// clusterNodeExists checks if the graph has a Cluster node with the given name.
+func clusterNodeExists(clusterName string) bool {
+	resp, err := db.CheckClusterResource(clusterName)
+	if err != nil {
+		glog.Error("Could not check cluster resource by name: ", err)
+		return false
+	}
+	if resp.Empty() {
+		glog.Infof("Cluster %s does not exist.", clusterName)
+		return false
+	}
+	//Iterating to next record to get count - count is in the first index(0) of the first record
+	for resp.Next() {
+		record := resp.Record()
+		countInterface := record.GetByIndex(0)
+		if count, ok := countInterface.(int); ok {
+			if count <= 0 {
+				return false
 			}
+		} else {
+			glog.Errorf("Could not parse Cluster count results for cluster %s", clusterName)
 		}
 	}
 
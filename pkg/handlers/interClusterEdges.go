@@ -55,8 +55,9 @@ func BuildInterClusterEdges() {
 	}
 
 	for {
-		interval := time.Duration(config.Cfg.EdgeBuildRateMS) * time.Millisecond
-		time.Sleep(interval)
+		began := time.Now()
+		config.Sleep(config.EdgeBuildRate) // The rate is reloaded at runtime.
+		interval := time.Since(began)
 
 		glog.V(3).Info("Building intercluster edges")
 
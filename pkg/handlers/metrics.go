@@ -11,10 +11,13 @@ Copyright (c) 2020 Red Hat, Inc.
 package handlers
 
 import (
+	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Track clusters with pending requests.
@@ -23,6 +26,54 @@ var (
 	PendingRequestsMutex = sync.RWMutex{}
 )
 
+// Buckets used for the sync duration histograms, in seconds. A ClearAll resync of a large cluster
+// can take minutes, so the buckets go up to the default HTTP_TIMEOUT.
+var syncDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Prometheus metrics exported on the /metrics endpoint.
+var (
+	syncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "search_aggregator_sync_duration_seconds",
+		Help:    "Total time to process a sync request from a cluster.",
+		Buckets: syncDurationBuckets,
+	}, []string{"cluster"})
+	nodeSyncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "search_aggregator_node_sync_duration_seconds",
+		Help:    "Time spent syncing the resources (nodes) of a sync request.",
+		Buckets: syncDurationBuckets,
+	}, []string{"cluster"})
+	edgeSyncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "search_aggregator_edge_sync_duration_seconds",
+		Help:    "Time spent syncing the edges of a sync request.",
+		Buckets: syncDurationBuckets,
+	}, []string{"cluster"})
+	resourcesSynced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "search_aggregator_resources_synced_total",
+		Help: "Number of resources added, updated or deleted by sync requests.",
+	}, []string{"cluster", "operation"})
+	edgesSynced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "search_aggregator_edges_synced_total",
+		Help: "Number of edges added or deleted by sync requests.",
+	}, []string{"cluster", "operation"})
+	pendingRequestsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "search_aggregator_pending_requests",
+		Help: "Number of sync requests currently being processed.",
+	})
+	queuedRequestsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "search_aggregator_queued_requests",
+		Help: "Number of sync requests waiting in the admission queue.",
+	})
+	syncErrorResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "search_aggregator_sync_error_responses_total",
+		Help: "Number of sync requests answered with 400, 409, 413, 429 or 503.",
+	}, []string{"cluster", "code"})
+)
+
+func init() {
+	prometheus.MustRegister(syncDuration, nodeSyncDuration, edgeSyncDuration, resourcesSynced, edgesSynced,
+		pendingRequestsGauge, queuedRequestsGauge, syncErrorResponses)
+}
+
 // Used to collect sync performance metrics
 type SyncMetrics struct {
 	clusterName   string
@@ -38,6 +89,7 @@ func InitSyncMetrics(clusterName string) SyncMetrics {
 	s := SyncMetrics{clusterName: clusterName, syncStart: time.Now()}
 	PendingRequestsMutex.Lock()
 	PendingRequests[clusterName] = &s
+	pendingRequestsGauge.Set(float64(len(PendingRequests)))
 	PendingRequestsMutex.Unlock()
 	return s
 }
@@ -46,17 +98,18 @@ func (m SyncMetrics) CompleteSyncEvent() {
 	glog.V(2).Info("Completed sync of cluster: ", m.clusterName)
 	PendingRequestsMutex.Lock()
 	delete(PendingRequests, m.clusterName)
+	pendingRequestsGauge.Set(float64(len(PendingRequests)))
 	PendingRequestsMutex.Unlock()
 }
 
-func (m SyncMetrics) LogPerformanceMetrics(syncEvent SyncEvent) {
+func (m SyncMetrics) LogPerformanceMetrics(requestId int, counts syncEventCounts) {
 	elapsed := time.Since(m.syncStart)
 	if int(elapsed.Seconds()) > 1 {
 		glog.Warningf("SyncResources from %s took %s", m.clusterName, elapsed)
 		glog.Warningf(
 			"Increased processing time {request: %d, add: %d, update: %d, delete: %d edge add: %d edge delete: %d}",
-			syncEvent.RequestId, len(syncEvent.AddResources), len(syncEvent.UpdateResources),
-			len(syncEvent.DeleteResources), len(syncEvent.AddEdges), len(syncEvent.DeleteEdges))
+			requestId, counts.addResources, counts.updateResources,
+			counts.deleteResources, counts.addEdges, counts.deleteEdges)
 		glog.Warning("  > Nodes sync took: ", m.NodeSyncEnd.Sub(m.NodeSyncStart))
 		glog.Warning("  > Edges sync took: ", m.EdgeSyncEnd.Sub(m.EdgeSyncStart))
 	} else {
@@ -65,3 +118,30 @@ func (m SyncMetrics) LogPerformanceMetrics(syncEvent SyncEvent) {
 		glog.V(4).Info("  > Edges sync took: ", m.EdgeSyncEnd.Sub(m.EdgeSyncStart))
 	}
 }
+
+// Exports the durations and totals of a completed sync event to Prometheus.
+func (m SyncMetrics) ObserveSyncMetrics(response SyncResponse) {
+	syncDuration.WithLabelValues(m.clusterName).Observe(m.SyncEnd.Sub(m.syncStart).Seconds())
+	// A phase isn't timed when the request didn't have any resources or edges.
+	if !m.NodeSyncStart.IsZero() {
+		nodeSyncDuration.WithLabelValues(m.clusterName).Observe(m.NodeSyncEnd.Sub(m.NodeSyncStart).Seconds())
+	}
+	if !m.EdgeSyncStart.IsZero() {
+		edgeSyncDuration.WithLabelValues(m.clusterName).Observe(m.EdgeSyncEnd.Sub(m.EdgeSyncStart).Seconds())
+	}
+
+	resourcesSynced.WithLabelValues(m.clusterName, "added").Add(float64(response.TotalAdded))
+	resourcesSynced.WithLabelValues(m.clusterName, "updated").Add(float64(response.TotalUpdated))
+	resourcesSynced.WithLabelValues(m.clusterName, "deleted").Add(float64(response.TotalDeleted))
+	edgesSynced.WithLabelValues(m.clusterName, "added").Add(float64(response.TotalEdgesAdded))
+	edgesSynced.WithLabelValues(m.clusterName, "deleted").Add(float64(response.TotalEdgesDeleted))
+}
+
+// Counts the sync requests rejected with 400, 409, 413, 429 or 503. Other status codes are ignored.
+func observeSyncResponseStatus(clusterName string, status int) {
+	switch status {
+	case http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusTooManyRequests,
+		http.StatusServiceUnavailable:
+		syncErrorResponses.WithLabelValues(clusterName, strconv.Itoa(status)).Inc()
+	}
+}
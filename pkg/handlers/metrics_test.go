@@ -10,7 +10,12 @@ irrespective of what has been deposited with the U.S. Copyright Office.
 package handlers
 
 import (
+	"net/http"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
 )
 
 //Checks that multiple clusters can update simultaneously without causing a concurrent map write error.
@@ -30,3 +35,28 @@ func InitClusterMetrics(clusterName string) {
 		i++
 	}
 }
+
+// Checks that the totals of a sync response are exported as Prometheus counters.
+func TestObserveSyncMetrics(t *testing.T) {
+	start := time.Now()
+	metrics := SyncMetrics{clusterName: "metrics-cluster", syncStart: start, SyncEnd: start.Add(2 * time.Second)}
+	metrics.ObserveSyncMetrics(SyncResponse{TotalAdded: 3, TotalUpdated: 2, TotalDeleted: 1, TotalEdgesAdded: 5})
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(resourcesSynced.WithLabelValues("metrics-cluster", "added")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(resourcesSynced.WithLabelValues("metrics-cluster", "updated")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(resourcesSynced.WithLabelValues("metrics-cluster", "deleted")))
+	assert.Equal(t, float64(5), testutil.ToFloat64(edgesSynced.WithLabelValues("metrics-cluster", "added")))
+	assert.Equal(t, 1, testutil.CollectAndCount(syncDuration))
+}
+
+// Only 400, 429 and 503 responses should be counted.
+func TestObserveSyncResponseStatus(t *testing.T) {
+	observeSyncResponseStatus("status-cluster", http.StatusOK)
+	observeSyncResponseStatus("status-cluster", http.StatusTooManyRequests)
+	observeSyncResponseStatus("status-cluster", http.StatusTooManyRequests)
+	observeSyncResponseStatus("status-cluster", http.StatusServiceUnavailable)
+
+	assert.Equal(t, float64(0), testutil.ToFloat64(syncErrorResponses.WithLabelValues("status-cluster", "200")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(syncErrorResponses.WithLabelValues("status-cluster", "429")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(syncErrorResponses.WithLabelValues("status-cluster", "503")))
+}
@@ -12,8 +12,10 @@ Copyright (c) 2020 Red Hat, Inc.
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"time"
 
@@ -26,25 +28,73 @@ func getEdgeUID(sourceUID string, edgeType string, destUID string) string {
 	return fmt.Sprintf("%s-%s->%s", sourceUID, edgeType, destUID)
 }
 
-func resyncCluster(clusterName string, resources []*db.Resource, edges []db.Edge, metrics *SyncMetrics) (stats SyncResponse, err error) {
-	glog.Info("Resync for cluster: ", clusterName, " edges to insert: ", len(edges))
+// State of a ClearAll resync. The incoming resources and edges can be passed in batches, which allows
+// processing a streamed SyncEvent without holding it in memory. All the resources must be passed before the edges.
+type resyncSession struct {
+	ctx         context.Context
+	clusterName string
+	metrics     *SyncMetrics
+	stats       SyncResponse
+	err         error
+
+	existingResources map[string]*rg2.Node // Resources in the datastore that haven't been received yet.
+	resourcesDone     bool
+
+	existingEdges      map[string]db.Edge // Edges in the datastore that haven't been received yet.
+	existingEdgesCount int
+	incomingEdges      map[string]bool // Used to detect duplicate edges in the payload.
+	incomingEdgesCount int
+	edgesAdded         int
+	edgesDeleted       int
+
+	dryRun bool // Compute the diff without writing to the datastore.
+	diff   ResyncDiff
+}
+
+// ResyncDiff - Changes that a ClearAll resync would apply. Returned instead of applying them for a dry run.
+type ResyncDiff struct {
+	AddResources       []string // UIDs
+	UpdateResources    []string // UIDs
+	DeleteResources    []string // UIDs
+	DuplicateResources []string // UIDs with more than one node, these are deleted and added again.
+	AddEdges           []string // Keys from getEdgeUID()
+	DeleteEdges        []string // Keys from getEdgeUID()
+}
+
+// Starts a resync, loading the existing resources for the cluster. Returns an error if the existing resources
+// can't be loaded, the resync must be aborted because every incoming resource would be added again.
+// A dry run only computes the diff, nothing is written to the datastore.
+func newResyncSession(ctx context.Context, clusterName string, metrics *SyncMetrics,
+	dryRun bool) (*resyncSession, error) {
+	if dryRun {
+		glog.Info("Resync dry run for cluster: ", clusterName)
+	} else {
+		glog.Info("Resync for cluster: ", clusterName)
+	}
+	s := &resyncSession{
+		ctx:               ctx,
+		clusterName:       clusterName,
+		metrics:           metrics,
+		dryRun:            dryRun,
+		existingResources: make(map[string]*rg2.Node),
+		incomingEdges:     make(map[string]bool),
+	}
 
 	// First get the existing resources from the datastore for the cluster
 	result, error := db.Store.Query(db.SanitizeQuery("MATCH (n {cluster: '%s'}) RETURN n", clusterName))
 
 	if error != nil {
-		glog.Error("Error getting existing resources for cluster ", clusterName)
-		err = error // For return value.
+		glog.Error("Error getting existing resources for cluster ", clusterName, ". Aborting the resync. ", error)
+		return nil, error
 	}
 	// Build a map with all the current resources by UID.
 	// Build a map of duplicated resources.
-	var existingResources = make(map[string]*rg2.Node)
 	var duplicatedResources = make(map[string]int)
 	for result.Next() {
 		record := result.Record()
 		if rgNode, ok := record.GetByIndex(0).(*rg2.Node); ok {
 			if existingResourceUID, ok := rgNode.Properties["_uid"].(string); ok {
-				if _, exists := existingResources[existingResourceUID]; exists {
+				if _, exists := s.existingResources[existingResourceUID]; exists {
 					dupeCount, dupeExists := duplicatedResources[existingResourceUID]
 					if !dupeExists {
 						duplicatedResources[existingResourceUID] = 1
@@ -52,7 +102,7 @@ func resyncCluster(clusterName string, resources []*db.Resource, edges []db.Edge
 						duplicatedResources[existingResourceUID] = dupeCount + 1
 					}
 				} else {
-					existingResources[existingResourceUID] = rgNode
+					s.existingResources[existingResourceUID] = rgNode
 				}
 			}
 		}
@@ -63,98 +113,145 @@ func resyncCluster(clusterName string, resources []*db.Resource, edges []db.Edge
 		glog.Warningf("RedisGraph contains duplicate records for some UIDs in cluster %s. Total uids duplicates: %d",
 			clusterName, len(duplicatedResources))
 		for dupeUID, dupeCount := range duplicatedResources {
+			delete(s.existingResources, dupeUID) // Delete from existing resources.
+			if dryRun {
+				s.diff.DuplicateResources = append(s.diff.DuplicateResources, dupeUID)
+				continue
+			}
 			_, delError := db.Store.Query(db.SanitizeQuery("MATCH (n {_uid:'%s'}) DELETE n", dupeUID))
 			if delError != nil {
 				glog.Error("Error deleting duplicates for ", dupeUID, delError)
 			}
 			glog.V(3).Infof("Deleted %d duplicates of UID %s", dupeCount, dupeUID)
-			delete(existingResources, dupeUID) // Delete from existing resources.
 		}
 	}
+	metrics.NodeSyncStart = time.Now()
+	return s, nil
+}
+
+// Inserts or updates a batch of incoming resources.
+func (s *resyncSession) syncResources(resources []*db.Resource) {
+	if s.resourcesDone {
+		glog.Error("Received resources after the edges in resync for cluster ", s.clusterName)
+		return
+	}
 
 	// Loop through incoming resources and check if each resource exist and if it needs to be updated.
 	var resourcesToAdd = make([]*db.Resource, 0)
 	var resourcesToUpdate = make([]*db.Resource, 0)
 	for _, newResource := range resources {
-		existingResource, exist := existingResources[newResource.UID]
+		existingResource, exist := s.existingResources[newResource.UID]
 
 		if !exist {
 			// Resource needs to be added.
 			resourcesToAdd = append(resourcesToAdd, newResource)
 		} else {
 			// Resource exists, but we need to check if it needs to be updated.
-			newEncodedProperties, encodeError := newResource.EncodeProperties()
-			if encodeError != nil {
-				// Assume we need to update this resource if we hit an encoding error.
-				glog.Warning("Error encoding properties of resource. ", encodeError)
+			if resourceChanged(newResource, existingResource) {
 				resourcesToUpdate = append(resourcesToUpdate, newResource)
-			} else {
-				for key, value := range newEncodedProperties {
-					var isInterface bool
-					var existingProperty, stringValue string
-					_, interfaceTypeTrue := value.([]interface{})
-					existingInterface, existingInterfaceTypeTrue := existingResource.Properties[key].([]interface{})
-					if interfaceTypeTrue && existingInterfaceTypeTrue {
-						isInterface = true
-					} else {
-						// Need to compare everything other than interfaces as strings
-						// because that's what we get from RedisGraph.
-						stringValue = valueToString(value)
-						existingProperty = valueToString(existingResource.Properties[key])
-					}
-					if (isInterface && !reflect.DeepEqual(newResource.Properties[key], existingInterface)) ||
-						existingProperty != stringValue {
-						resourcesToUpdate = append(resourcesToUpdate, newResource)
-						break
-					}
-				}
 			}
 			// Remove the resource because it has been proccessed.
 			// Any resources remaining when we are done will need to be deleted.
-			delete(existingResources, newResource.UID)
+			delete(s.existingResources, newResource.UID)
 		}
 	}
 
+	if s.dryRun {
+		for _, resource := range resourcesToAdd {
+			s.diff.AddResources = append(s.diff.AddResources, resource.UID)
+		}
+		for _, resource := range resourcesToUpdate {
+			s.diff.UpdateResources = append(s.diff.UpdateResources, resource.UID)
+		}
+		return
+	}
+
 	// INSERT Resources
 
-	metrics.NodeSyncStart = time.Now()
-	insertResponse := db.ChunkedInsert(resourcesToAdd, clusterName)
-	stats.TotalAdded = insertResponse.SuccessfulResources // could be 0
+	insertResponse := db.ChunkedInsert(s.ctx, resourcesToAdd, s.clusterName)
+	s.stats.TotalAdded += insertResponse.SuccessfulResources // could be 0
+	s.stats.TotalRetries += insertResponse.Retries
 	if insertResponse.ConnectionError != nil {
-		err = insertResponse.ConnectionError
+		s.err = insertResponse.ConnectionError
 	} else if len(insertResponse.ResourceErrors) != 0 {
-		stats.AddErrors = processSyncErrors(insertResponse.ResourceErrors, "inserted")
+		s.stats.AddErrors = append(s.stats.AddErrors, processSyncErrors(insertResponse.ResourceErrors, "inserted")...)
 	}
 
 	// UPDATE Resources
 
-	updateResponse := db.ChunkedUpdate(resourcesToUpdate)
-	stats.TotalUpdated = updateResponse.SuccessfulResources // could be 0
+	updateResponse := db.ChunkedUpdate(s.ctx, resourcesToUpdate)
+	s.stats.TotalUpdated += updateResponse.SuccessfulResources // could be 0
+	s.stats.TotalRetries += updateResponse.Retries
 	if updateResponse.ConnectionError != nil {
-		err = updateResponse.ConnectionError
+		s.err = updateResponse.ConnectionError
 	} else if len(updateResponse.ResourceErrors) != 0 {
-		stats.UpdateErrors = processSyncErrors(updateResponse.ResourceErrors, "updated")
+		s.stats.UpdateErrors = append(s.stats.UpdateErrors, processSyncErrors(updateResponse.ResourceErrors, "updated")...)
 	}
+}
+
+// Checks if the properties of an incoming resource are different from the existing node.
+func resourceChanged(newResource *db.Resource, existingResource *rg2.Node) bool {
+	newEncodedProperties, encodeError := newResource.EncodeProperties()
+	if encodeError != nil {
+		// Assume we need to update this resource if we hit an encoding error.
+		glog.Warning("Error encoding properties of resource. ", encodeError)
+		return true
+	}
+	for key, value := range newEncodedProperties {
+		var isInterface bool
+		var existingProperty, stringValue string
+		_, interfaceTypeTrue := value.([]interface{})
+		existingInterface, existingInterfaceTypeTrue := existingResource.Properties[key].([]interface{})
+		if interfaceTypeTrue && existingInterfaceTypeTrue {
+			isInterface = true
+		} else {
+			// Need to compare everything other than interfaces as strings
+			// because that's what we get from RedisGraph.
+			stringValue = valueToString(value)
+			existingProperty = valueToString(existingResource.Properties[key])
+		}
+		if (isInterface && !reflect.DeepEqual(value, existingInterface)) ||
+			existingProperty != stringValue {
+			return true
+		}
+	}
+	return false
+}
+
+// Deletes the existing resources that weren't received and loads the existing edges.
+// Called once, before syncing the first batch of edges.
+func (s *resyncSession) finishResources() {
+	if s.resourcesDone {
+		return
+	}
+	s.resourcesDone = true
+	clusterName := s.clusterName
 
 	// DELETE Resources
 
-	deleteUIDS := make([]string, 0, len(existingResources))
-	for _, resource := range existingResources {
+	deleteUIDS := make([]string, 0, len(s.existingResources))
+	for _, resource := range s.existingResources {
 		deleteUIDS = append(deleteUIDS, resource.Properties["_uid"].(string))
 	}
-	deleteResponse := db.ChunkedDelete(deleteUIDS)
-	stats.TotalDeleted = deleteResponse.SuccessfulResources // could be 0
-	if deleteResponse.ConnectionError != nil {
-		err = deleteResponse.ConnectionError
-	} else if len(deleteResponse.ResourceErrors) != 0 {
-		stats.DeleteErrors = processSyncErrors(deleteResponse.ResourceErrors, "deleted")
+	s.existingResources = nil
+	if s.dryRun {
+		s.diff.DeleteResources = deleteUIDS
+	} else {
+		deleteResponse := db.ChunkedDelete(s.ctx, deleteUIDS)
+		s.stats.TotalDeleted = deleteResponse.SuccessfulResources // could be 0
+		s.stats.TotalRetries += deleteResponse.Retries
+		if deleteResponse.ConnectionError != nil {
+			s.err = deleteResponse.ConnectionError
+		} else if len(deleteResponse.ResourceErrors) != 0 {
+			s.stats.DeleteErrors = processSyncErrors(deleteResponse.ResourceErrors, "deleted")
+		}
 	}
 
-	metrics.NodeSyncEnd = time.Now()
+	s.metrics.NodeSyncEnd = time.Now()
 
 	// RE-SYNC Edges
 
-	metrics.EdgeSyncStart = time.Now()
+	s.metrics.EdgeSyncStart = time.Now()
 
 	currEdgesCount := computeIntraEdges(clusterName)
 	glog.V(4).Info("Number of intra edges for cluster ", clusterName, " before removing duplicates: ", currEdgesCount)
@@ -163,10 +260,9 @@ func resyncCluster(clusterName string, resources []*db.Resource, edges []db.Edge
 		clusterName, clusterName))
 	if edgesError != nil {
 		glog.Warning("Error getting all existing edges for cluster ", clusterName, edgesError)
-		err = edgesError
+		s.err = edgesError
 	}
-	var existingEdges = make(map[string]db.Edge)
-	var edgesToAdd = make([]db.Edge, 0)
+	s.existingEdges = make(map[string]db.Edge)
 
 	// Create a map with the existing edges.
 
@@ -176,8 +272,8 @@ func resyncCluster(clusterName string, resources []*db.Resource, edges []db.Edge
 			e := currEdges.Record()
 			key := getEdgeUID(valueToString(e.GetByIndex(0)), valueToString(e.GetByIndex(1)),
 				valueToString(e.GetByIndex(2)))
-			if _, ok := existingEdges[key]; !ok {
-				existingEdges[key] = db.Edge{
+			if _, ok := s.existingEdges[key]; !ok {
+				s.existingEdges[key] = db.Edge{
 					SourceUID: valueToString(e.GetByIndex(0)),
 					EdgeType:  valueToString(e.GetByIndex(1)),
 					DestUID:   valueToString(e.GetByIndex(2)),
@@ -189,12 +285,16 @@ func resyncCluster(clusterName string, resources []*db.Resource, edges []db.Edge
 	}
 
 	glog.V(4).Info("Duplicate edge count: ", dupCount)
+	if s.dryRun {
+		s.existingEdgesCount = len(s.existingEdges)
+		return
+	}
 
 	//Redisgraph 2.0 supports addition of duplicate edges. Delete duplicate edges, if any, in the cluster
 	dupEdgedeleted, delEdgesError := db.Store.Query(fmt.Sprintf("MATCH (s {cluster:'%s'})-[r]->(d {cluster:'%s'}) WHERE (r._interCluster <> true) OR (r._interCluster IS NULL) WITH s as source, d as dest, TYPE(r) as edge, COLLECT (r) AS edges WHERE size(edges) >1 UNWIND edges[1..] AS dupedges DELETE dupedges", clusterName, clusterName))
 	if delEdgesError != nil {
 		glog.Warning("Error deleting duplicate edges for cluster ", clusterName, delEdgesError)
-		err = delEdgesError
+		s.err = delEdgesError
 	} else {
 		glog.V(4).Info("For cluster, ", clusterName, ": Deleted duplicate edges: ", dupEdgedeleted.RelationshipsDeleted())
 	}
@@ -202,85 +302,121 @@ func resyncCluster(clusterName string, resources []*db.Resource, edges []db.Edge
 	currEdgesCount = computeIntraEdges(clusterName)
 	glog.V(4).Info("Number of intra edges for cluster ", clusterName, " after removing duplicates: ", currEdgesCount)
 
-	existingEdgesMapLength := len(existingEdges)
-	glog.V(4).Info("Existing edges map length: ", len(existingEdges))
+	s.existingEdgesCount = len(s.existingEdges)
+	glog.V(4).Info("Existing edges map length: ", len(s.existingEdges))
+}
 
-	var verifyEdges = make(map[string]bool)
+// Inserts a batch of incoming edges that don't exist yet.
+func (s *resyncSession) syncEdges(edges []db.Edge) {
+	s.finishResources()
+	s.incomingEdgesCount += len(edges)
 
+	var edgesToAdd = make([]db.Edge, 0)
 	//Loop through incoming new edges and decide if each edge needs to be added.
 	for _, e := range edges {
-		verifyEdges[getEdgeUID(e.SourceUID, e.EdgeType, e.DestUID)] = true
-		if _, exists := existingEdges[getEdgeUID(e.SourceUID, e.EdgeType, e.DestUID)]; exists {
-			delete(existingEdges, getEdgeUID(e.SourceUID, e.EdgeType, e.DestUID))
+		s.incomingEdges[getEdgeUID(e.SourceUID, e.EdgeType, e.DestUID)] = true
+		if _, exists := s.existingEdges[getEdgeUID(e.SourceUID, e.EdgeType, e.DestUID)]; exists {
+			delete(s.existingEdges, getEdgeUID(e.SourceUID, e.EdgeType, e.DestUID))
 		} else {
 			edgesToAdd = append(edgesToAdd, e)
 		}
 	}
-	if len(verifyEdges) != len(edges) {
-		glog.Error("There are duplicate edges in the payload from cluster: ", clusterName)
-	}
-
-	// Compute edges to delete.
-	// These are the remaining objects in existingEdges after processing all the incoming new edges.
-	var edgesToDelete = make([]db.Edge, 0)
-	for _, e := range existingEdges {
-		edgesToDelete = append(edgesToDelete, e)
+	s.edgesAdded += len(edgesToAdd)
+	if s.dryRun {
+		for _, e := range edgesToAdd {
+			s.diff.AddEdges = append(s.diff.AddEdges, getEdgeUID(e.SourceUID, e.EdgeType, e.DestUID))
+		}
+		return
 	}
 
-	expectedEdgesAfterProcessing := existingEdgesMapLength + len(edgesToAdd) - len(edgesToDelete)
-	if expectedEdgesAfterProcessing != len(edges) {
-		glog.Warningf("For cluster %s expectedEdgesAfterProcessing [%d] doesn't match received len(edges) [%d]",
-			clusterName, expectedEdgesAfterProcessing, len(edges))
-	}
 	// INSERT Edges
-	glog.V(4).Info("Resync for cluster ", clusterName, ": Number of edges to insert: ", len(edgesToAdd))
-	insertEdgeResponse := db.ChunkedInsertEdge(edgesToAdd, clusterName)
-	stats.TotalEdgesAdded = insertEdgeResponse.SuccessfulResources // could be 0
+	glog.V(4).Info("Resync for cluster ", s.clusterName, ": Number of edges to insert: ", len(edgesToAdd))
+	insertEdgeResponse := db.ChunkedInsertEdge(s.ctx, edgesToAdd, s.clusterName)
+	s.stats.TotalEdgesAdded += insertEdgeResponse.SuccessfulResources // could be 0
+	s.stats.TotalRetries += insertEdgeResponse.Retries
 	if insertEdgeResponse.ConnectionError != nil {
-		err = insertEdgeResponse.ConnectionError
+		s.err = insertEdgeResponse.ConnectionError
 	} else if len(insertEdgeResponse.ResourceErrors) != 0 {
-		stats.AddEdgeErrors = processSyncErrors(insertEdgeResponse.ResourceErrors, "inserted by edge")
+		s.stats.AddEdgeErrors = append(s.stats.AddEdgeErrors,
+			processSyncErrors(insertEdgeResponse.ResourceErrors, "inserted by edge")...)
 	}
 
 	if len(edgesToAdd) != insertEdgeResponse.EdgesAdded {
 		glog.V(4).Info("Edges to add len: ", len(edgesToAdd))
 		glog.V(4).Info("Edge add errors: ", len(insertEdgeResponse.ResourceErrors))
 		glog.V(4).Info("Edge add errors: ", insertEdgeResponse.ResourceErrors)
-		currEdgesCount = computeIntraEdges(clusterName)
-		glog.V(4).Infof("Number of intra edges for cluster %s after adding edges: %d",
-			clusterName, currEdgesCount)
-		glog.V(4).Info("currEdgesCount: ", currEdgesCount, " incoming edges: ", len(edges))
 		glog.V(4).Infof("Added edge count %d didn't match expected number: %d",
 			insertEdgeResponse.EdgesAdded, len(edgesToAdd))
 	}
+}
+
+// Deletes the existing edges that weren't received and returns the stats of the resync.
+func (s *resyncSession) finish() (SyncResponse, error) {
+	s.finishResources()
+	clusterName := s.clusterName
+
+	if len(s.incomingEdges) != s.incomingEdgesCount {
+		glog.Error("There are duplicate edges in the payload from cluster: ", clusterName)
+	}
+
+	// Compute edges to delete.
+	// These are the remaining objects in existingEdges after processing all the incoming new edges.
+	var edgesToDelete = make([]db.Edge, 0)
+	for _, e := range s.existingEdges {
+		edgesToDelete = append(edgesToDelete, e)
+	}
+
+	expectedEdgesAfterProcessing := s.existingEdgesCount + s.edgesAdded - len(edgesToDelete)
+	if expectedEdgesAfterProcessing != s.incomingEdgesCount {
+		glog.Warningf("For cluster %s expectedEdgesAfterProcessing [%d] doesn't match received len(edges) [%d]",
+			clusterName, expectedEdgesAfterProcessing, s.incomingEdgesCount)
+	}
+
+	if s.dryRun {
+		for key := range s.existingEdges {
+			s.diff.DeleteEdges = append(s.diff.DeleteEdges, key)
+		}
+		s.diff.sort()
+		s.metrics.EdgeSyncEnd = time.Now()
+		return s.stats, s.err
+	}
 
 	// DELETE Edges
 	glog.V(4).Info("Resync for cluster ", clusterName, ": Number of edges to delete: ", len(edgesToDelete))
-	deleteEdgeResponse := db.ChunkedDeleteEdge(edgesToDelete, clusterName)
-	stats.TotalEdgesDeleted = deleteEdgeResponse.SuccessfulResources // could be 0
+	deleteEdgeResponse := db.ChunkedDeleteEdge(s.ctx, edgesToDelete, clusterName)
+	s.stats.TotalEdgesDeleted = deleteEdgeResponse.SuccessfulResources // could be 0
+	s.stats.TotalRetries += deleteEdgeResponse.Retries
 	if deleteEdgeResponse.ConnectionError != nil {
-		err = deleteEdgeResponse.ConnectionError
+		s.err = deleteEdgeResponse.ConnectionError
 	} else if len(deleteEdgeResponse.ResourceErrors) != 0 {
-		stats.DeleteEdgeErrors = processSyncErrors(deleteEdgeResponse.ResourceErrors, "removed by edge")
+		s.stats.DeleteEdgeErrors = processSyncErrors(deleteEdgeResponse.ResourceErrors, "removed by edge")
 	}
 
 	if len(edgesToDelete) != deleteEdgeResponse.EdgesDeleted {
 		glog.V(4).Info("Edges to delete: len", len(edgesToDelete))
 		glog.V(4).Info("Edge delete errors: ", len(deleteEdgeResponse.ResourceErrors))
 		glog.V(4).Info("Edge delete errors: ", deleteEdgeResponse.ResourceErrors)
-		currEdgesCount = computeIntraEdges(clusterName)
+		currEdgesCount := computeIntraEdges(clusterName)
 		glog.V(4).Info("Number of intra edges for cluster ", clusterName, " after deleting edges: ", currEdgesCount)
-		glog.V(4).Info("currEdgesCount: ", currEdgesCount, " incoming edges: ", len(edges))
+		glog.V(4).Info("currEdgesCount: ", currEdgesCount, " incoming edges: ", s.incomingEdgesCount)
 		glog.V(4).Infof("Deleted edge count %d didn't match expected number: %d",
 			deleteEdgeResponse.EdgesDeleted, len(edgesToDelete))
 	}
 
 	// There's no need to UPDATE edges because edges don't have properties yet.
 
-	metrics.EdgeSyncEnd = time.Now()
+	s.metrics.EdgeSyncEnd = time.Now()
 	glog.V(4).Infof("resyncCluster complete. Done updating resources for cluster %s, preparing response", clusterName)
 
-	return stats, err
+	return s.stats, s.err
+}
+
+// Sorts the lists of the diff, so the result doesn't depend on the order of the maps.
+func (d *ResyncDiff) sort() {
+	for _, list := range [][]string{d.AddResources, d.UpdateResources, d.DeleteResources, d.DuplicateResources,
+		d.AddEdges, d.DeleteEdges} {
+		sort.Strings(list)
+	}
 }
 
 func valueToString(value interface{}) string {
@@ -4,7 +4,15 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
+
+	rg2 "github.com/redislabs/redisgraph-go"
+	db "github.com/stolostron/search-aggregator/pkg/dbconnector"
+	"github.com/stolostron/search-aggregator/pkg/dbconnector/memgraph"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_getEdgeUID(t *testing.T) {
@@ -15,3 +23,120 @@ func Test_getEdgeUID(t *testing.T) {
 		t.Errorf("Failed building edge UID. Expected: source-type->dest but got: %s", result)
 	}
 }
+
+// Store that records the queries and returns empty results.
+type recordingStore struct {
+	queries *[]string
+}
+
+func (rs recordingStore) Query(q string) (*rg2.QueryResult, error) {
+	*rs.queries = append(*rs.queries, q)
+	return &rg2.QueryResult{}, nil
+}
+
+// A dry run should compute the diff without writing to the datastore.
+func Test_resyncSession_dryRun(t *testing.T) {
+	queries := []string{}
+	db.Store = recordingStore{queries: &queries}
+	metrics := SyncMetrics{clusterName: "dry-run-cluster"}
+
+	session, err := newResyncSession(context.Background(), "dry-run-cluster", &metrics, true)
+	assert.Nil(t, err)
+	session.syncResources([]*db.Resource{
+		{Kind: "Pod", UID: "uid-b", Properties: map[string]interface{}{"name": "b"}},
+		{Kind: "Pod", UID: "uid-a", Properties: map[string]interface{}{"name": "a"}},
+	})
+	session.syncEdges([]db.Edge{{SourceUID: "uid-a", DestUID: "uid-b", EdgeType: "ownedBy"}})
+	stats, err := session.finish()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.TotalAdded)
+	assert.Equal(t, []string{"uid-a", "uid-b"}, session.diff.AddResources)
+	assert.Equal(t, []string{"uid-a-ownedBy->uid-b"}, session.diff.AddEdges)
+	assert.Empty(t, session.diff.DeleteResources)
+	for _, q := range queries {
+		for _, write := range []string{"CREATE", "DELETE", "SET", "MERGE"} {
+			assert.NotContains(t, strings.ToUpper(q), write, "A dry run shouldn't write: %s", q)
+		}
+	}
+}
+
+// Store that fails every query.
+type failingStore struct {
+	queries *[]string
+}
+
+func (fs failingStore) Query(q string) (*rg2.QueryResult, error) {
+	*fs.queries = append(*fs.queries, q)
+	return nil, errors.New("Query timed out")
+}
+
+// The resync is aborted when the existing resources can't be loaded, instead of adding every resource again.
+func Test_newResyncSession_queryError(t *testing.T) {
+	queries := []string{}
+	db.Store = failingStore{queries: &queries}
+	metrics := SyncMetrics{clusterName: "failing-cluster"}
+
+	session, err := newResyncSession(context.Background(), "failing-cluster", &metrics, false)
+	assert.EqualError(t, err, "Query timed out")
+	assert.Nil(t, session)
+	assert.Len(t, queries, 1, "Nothing is written after the existing resources failed to load.")
+}
+
+// A resync against the in-memory graph adds, updates and deletes resources and edges.
+func Test_resyncSession_memoryGraph(t *testing.T) {
+	db.Store = memgraph.New()
+	resync := func(resources []*db.Resource, edges []db.Edge) SyncResponse {
+		metrics := SyncMetrics{clusterName: "memory-cluster"}
+		session, err := newResyncSession(context.Background(), "memory-cluster", &metrics, false)
+		assert.Nil(t, err)
+		session.syncResources(resources)
+		session.syncEdges(edges)
+		stats, err := session.finish()
+		assert.Nil(t, err)
+		return stats
+	}
+	pod := func(uid, name string) *db.Resource {
+		return &db.Resource{Kind: "Pod", UID: uid, Properties: map[string]interface{}{"kind": "Pod",
+			"cluster": "memory-cluster", "name": name}}
+	}
+	_, err := db.Store.Query("CREATE (:Cluster {name: 'memory-cluster', kind: 'cluster'})")
+	assert.Nil(t, err)
+
+	stats := resync([]*db.Resource{pod("uid-a", "a"), pod("uid-b", "b"), pod("uid-c", "c")},
+		[]db.Edge{{SourceUID: "uid-a", DestUID: "uid-b", EdgeType: "ownedBy"}})
+	assert.Equal(t, 3, stats.TotalAdded)
+	assert.Equal(t, 1, stats.TotalEdgesAdded)
+
+	stats = resync([]*db.Resource{pod("uid-a", "renamed"), pod("uid-b", "b")}, []db.Edge{})
+	assert.Equal(t, 0, stats.TotalAdded)
+	assert.Equal(t, 1, stats.TotalUpdated)
+	assert.Equal(t, 1, stats.TotalDeleted)
+	assert.Equal(t, 1, stats.TotalEdgesDeleted)
+}
+
+// Labels are stored as a sorted list of strings, a resource with the same labels isn't updated again.
+func Test_resyncSession_memoryGraphLabels(t *testing.T) {
+	db.Store = memgraph.New()
+	resync := func() SyncResponse {
+		metrics := SyncMetrics{clusterName: "labels-cluster"}
+		session, err := newResyncSession(context.Background(), "labels-cluster", &metrics, false)
+		assert.Nil(t, err)
+		session.syncResources([]*db.Resource{{Kind: "Pod", UID: "uid-a", Properties: map[string]interface{}{
+			"kind": "Pod", "cluster": "labels-cluster", "name": "a",
+			"label":     map[string]interface{}{"app": "search", "tier": "backend"},
+			"container": []interface{}{"redis", "aggregator"},
+		}}})
+		session.syncEdges([]db.Edge{})
+		stats, err := session.finish()
+		assert.Nil(t, err)
+		return stats
+	}
+	_, err := db.Store.Query("CREATE (:Cluster {name: 'labels-cluster', kind: 'cluster'})")
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, resync().TotalAdded)
+	stats := resync()
+	assert.Equal(t, 0, stats.TotalAdded)
+	assert.Equal(t, 0, stats.TotalUpdated)
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strings"
+
+	db "github.com/stolostron/search-aggregator/pkg/dbconnector"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Media types accepted by the sync endpoint.
+const (
+	contentTypeJSON    = "application/json"
+	contentTypeMsgpack = "application/msgpack"
+)
+
+// Returns true if the media type is MessagePack. Parameters like charset are ignored.
+func isMsgpack(mediaType string) bool {
+	parsed, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return false
+	}
+	return parsed == contentTypeMsgpack || parsed == "application/x-msgpack"
+}
+
+// Returns the format of the request body from the Content-Type header. Defaults to JSON.
+func requestFormat(r *http.Request) string {
+	if isMsgpack(r.Header.Get("Content-Type")) {
+		return contentTypeMsgpack
+	}
+	return contentTypeJSON
+}
+
+// Returns the format of the response from the Accept header. Defaults to JSON.
+func responseFormat(r *http.Request) string {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if isMsgpack(strings.TrimSpace(accepted)) {
+			return contentTypeMsgpack
+		}
+	}
+	return contentTypeJSON
+}
+
+// Decodes a SyncEvent in the given format. MessagePack uses the same field names as JSON.
+func decodeSyncEvent(body []byte, format string, syncEvent *SyncEvent) error {
+	if format != contentTypeMsgpack {
+		return json.NewDecoder(bytes.NewReader(body)).Decode(syncEvent)
+	}
+	decoder := msgpack.NewDecoder(bytes.NewReader(body))
+	decoder.SetCustomStructTag("json")
+	if err := decoder.Decode(syncEvent); err != nil {
+		return err
+	}
+	for _, resources := range [][]*db.Resource{syncEvent.AddResources, syncEvent.UpdateResources} {
+		for _, resource := range resources {
+			for key, value := range resource.Properties {
+				normalized, err := normalizeMsgpackValue(value)
+				if err != nil {
+					return fmt.Errorf("property %s of resource %s: %w", key, resource.UID, err)
+				}
+				resource.Properties[key] = normalized
+			}
+		}
+	}
+	return nil
+}
+
+// Converts a decoded MessagePack value to the types json.Unmarshal produces, which are the types expected by
+// the property encoding. Integers become int64, so they aren't converted from float64.
+func normalizeMsgpackValue(value interface{}) (interface{}, error) {
+	switch typedVal := value.(type) {
+	case nil, string, bool, int64, float64:
+		return typedVal, nil
+	case int8:
+		return int64(typedVal), nil
+	case int16:
+		return int64(typedVal), nil
+	case int32:
+		return int64(typedVal), nil
+	case int:
+		return int64(typedVal), nil
+	case uint8:
+		return int64(typedVal), nil
+	case uint16:
+		return int64(typedVal), nil
+	case uint32:
+		return int64(typedVal), nil
+	case uint64:
+		if typedVal > math.MaxInt64 {
+			return nil, fmt.Errorf("integer %d is too large", typedVal)
+		}
+		return int64(typedVal), nil
+	case float32:
+		return float64(typedVal), nil
+	case []byte:
+		return string(typedVal), nil
+	case []interface{}:
+		for i, element := range typedVal {
+			normalized, err := normalizeMsgpackValue(element)
+			if err != nil {
+				return nil, err
+			}
+			typedVal[i] = normalized
+		}
+		return typedVal, nil
+	case map[string]interface{}:
+		for key, element := range typedVal {
+			normalized, err := normalizeMsgpackValue(element)
+			if err != nil {
+				return nil, err
+			}
+			typedVal[key] = normalized
+		}
+		return typedVal, nil
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(typedVal))
+		for key, element := range typedVal {
+			normalized, err := normalizeMsgpackValue(element)
+			if err != nil {
+				return nil, err
+			}
+			converted[fmt.Sprintf("%v", key)] = normalized
+		}
+		return converted, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", value)
+	}
+}
+
+// Encodes the response in the given format.
+func encodeSyncResponse(w io.Writer, format string, response *SyncResponse) error {
+	if format != contentTypeMsgpack {
+		return json.NewEncoder(w).Encode(response)
+	}
+	encoder := msgpack.NewEncoder(w)
+	encoder.SetCustomStructTag("json")
+	return encoder.Encode(response)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+
+	db "github.com/stolostron/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var testEncodingEvent = SyncEvent{
+	ClearAll: true,
+	AddResources: []*db.Resource{{
+		Kind: "Pod",
+		UID:  "uid-1",
+		Properties: map[string]interface{}{
+			"kind":      "Pod",
+			"name":      "pod1",
+			"restarts":  3,
+			"cpu":       int64(1 << 40),
+			"ready":     true,
+			"label":     map[string]interface{}{"app": "search", "tier": "backend"},
+			"container": []interface{}{"search-api", "proxy"},
+		},
+	}},
+	DeleteResources: []DeleteResourceEvent{{UID: "uid-2"}},
+	AddEdges:        []db.Edge{{SourceUID: "uid-1", DestUID: "uid-3", EdgeType: "ownedBy", SourceKind: "Pod"}},
+	RequestId:       12,
+}
+
+func encodeTestEvent(t *testing.T, format string) []byte {
+	var buf bytes.Buffer
+	var err error
+	if format == contentTypeMsgpack {
+		encoder := msgpack.NewEncoder(&buf)
+		encoder.SetCustomStructTag("json")
+		err = encoder.Encode(testEncodingEvent)
+	} else {
+		err = json.NewEncoder(&buf).Encode(testEncodingEvent)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// A resource decoded from MessagePack should have the same encoded properties as the one decoded from JSON.
+func Test_decodeSyncEvent_msgpack(t *testing.T) {
+	var fromJSON, fromMsgpack SyncEvent
+	assert.Nil(t, decodeSyncEvent(encodeTestEvent(t, contentTypeJSON), contentTypeJSON, &fromJSON))
+	assert.Nil(t, decodeSyncEvent(encodeTestEvent(t, contentTypeMsgpack), contentTypeMsgpack, &fromMsgpack))
+
+	assert.True(t, fromMsgpack.ClearAll)
+	assert.Equal(t, 12, fromMsgpack.RequestId)
+	assert.Equal(t, fromJSON.DeleteResources, fromMsgpack.DeleteResources)
+	assert.Equal(t, fromJSON.AddEdges, fromMsgpack.AddEdges)
+	assert.Equal(t, "uid-1", fromMsgpack.AddResources[0].UID)
+	assert.Equal(t, int64(3), fromMsgpack.AddResources[0].Properties["restarts"])
+
+	jsonProperties, err := fromJSON.AddResources[0].EncodeProperties()
+	assert.Nil(t, err)
+	msgpackProperties, err := fromMsgpack.AddResources[0].EncodeProperties()
+	assert.Nil(t, err)
+	assert.Equal(t, jsonProperties, msgpackProperties)
+}
+
+func Test_normalizeMsgpackValue_unsupported(t *testing.T) {
+	_, err := normalizeMsgpackValue(struct{}{})
+
+	assert.NotNil(t, err)
+}
+
+// An unsigned integer above the int64 range is rejected instead of wrapping to a negative number.
+func Test_normalizeMsgpackValue_uint64(t *testing.T) {
+	normalized, err := normalizeMsgpackValue(uint64(math.MaxInt64))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(math.MaxInt64), normalized)
+
+	_, err = normalizeMsgpackValue([]interface{}{uint64(math.MaxInt64) + 1})
+	assert.EqualError(t, err, "integer 9223372036854775808 is too large")
+
+	var body bytes.Buffer
+	encoder := msgpack.NewEncoder(&body)
+	encoder.SetCustomStructTag("json")
+	assert.Nil(t, encoder.Encode(SyncEvent{AddResources: []*db.Resource{{Kind: "Pod", UID: "uid-a",
+		Properties: map[string]interface{}{"restarts": uint64(math.MaxUint64)}}}}))
+	var syncEvent SyncEvent
+	assert.EqualError(t, decodeSyncEvent(body.Bytes(), contentTypeMsgpack, &syncEvent),
+		"property restarts of resource uid-a: integer 18446744073709551615 is too large")
+}
+
+func Test_requestAndResponseFormat(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/aggregator/clusters/cluster1/sync", nil)
+	assert.Equal(t, contentTypeJSON, requestFormat(r))
+	assert.Equal(t, contentTypeJSON, responseFormat(r))
+
+	r.Header.Set("Content-Type", "application/x-msgpack")
+	r.Header.Set("Accept", "application/json;q=0.5, application/msgpack")
+	assert.Equal(t, contentTypeMsgpack, requestFormat(r))
+	assert.Equal(t, contentTypeMsgpack, responseFormat(r))
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/stolostron/search-aggregator/pkg/config"
+)
+
+// Response to a successful sync request, kept to answer a retry of the same request without applying it again.
+type cachedSyncResponse struct {
+	requestId   int
+	fingerprint string // Hash of the request body, so a reused RequestId with a different body isn't replayed.
+	response    SyncResponse
+}
+
+// Returns the fingerprint of a sync request body.
+func syncEventFingerprint(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// Keeps the response to a successful sync request. Only the last REPLAY_CACHE_SIZE responses of each cluster are kept.
+func cacheSyncResponse(clusterName string, fingerprint string, response SyncResponse) {
+	cacheSize := config.Cfg.ReplayCacheSize
+	if cacheSize <= 0 {
+		return
+	}
+	clusterSyncStatesMutex.Lock()
+	defer clusterSyncStatesMutex.Unlock()
+	state, exists := clusterSyncStates[clusterName]
+	if !exists {
+		state = &clusterSyncState{}
+		clusterSyncStates[clusterName] = state
+	}
+	state.recentResponses = append(state.recentResponses,
+		cachedSyncResponse{requestId: response.RequestId, fingerprint: fingerprint, response: response})
+	if len(state.recentResponses) > cacheSize {
+		state.recentResponses = state.recentResponses[len(state.recentResponses)-cacheSize:]
+	}
+}
+
+// Returns the cached response if the cluster already sent a successful request with the same RequestId and body.
+func getCachedSyncResponse(clusterName string, requestId int, fingerprint string) (SyncResponse, bool) {
+	clusterSyncStatesMutex.RLock()
+	defer clusterSyncStatesMutex.RUnlock()
+	state, exists := clusterSyncStates[clusterName]
+	if !exists {
+		return SyncResponse{}, false
+	}
+	for i := len(state.recentResponses) - 1; i >= 0; i-- {
+		cached := state.recentResponses[i]
+		if cached.requestId == requestId && cached.fingerprint == fingerprint {
+			return cached.response, true
+		}
+	}
+	return SyncResponse{}, false
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stolostron/search-aggregator/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getCachedSyncResponse(t *testing.T) {
+	fingerprint := syncEventFingerprint([]byte(`{"RequestId":1}`))
+	cacheSyncResponse("replay-cluster", fingerprint, SyncResponse{RequestId: 1, TotalAdded: 3})
+
+	cached, found := getCachedSyncResponse("replay-cluster", 1, fingerprint)
+	assert.True(t, found)
+	assert.Equal(t, 3, cached.TotalAdded)
+
+	_, found = getCachedSyncResponse("replay-cluster", 1, syncEventFingerprint([]byte(`{"RequestId":1,"clearAll":true}`)))
+	assert.False(t, found, "A request with the same RequestId but a different body shouldn't be replayed.")
+
+	_, found = getCachedSyncResponse("replay-cluster", 2, fingerprint)
+	assert.False(t, found)
+
+	_, found = getCachedSyncResponse("unknown-cluster", 1, fingerprint)
+	assert.False(t, found)
+}
+
+// Only the last REPLAY_CACHE_SIZE responses should be kept.
+func Test_cacheSyncResponse_evictsOldest(t *testing.T) {
+	for requestId := 1; requestId <= config.Cfg.ReplayCacheSize+1; requestId++ {
+		cacheSyncResponse("evict-cluster", "fingerprint", SyncResponse{RequestId: requestId})
+	}
+
+	_, found := getCachedSyncResponse("evict-cluster", 1, "fingerprint")
+	assert.False(t, found)
+	_, found = getCachedSyncResponse("evict-cluster", 2, "fingerprint")
+	assert.True(t, found)
+	assert.Len(t, clusterSyncStates["evict-cluster"].recentResponses, config.Cfg.ReplayCacheSize)
+}
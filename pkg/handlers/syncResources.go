@@ -12,8 +12,10 @@ Copyright (c) 2020 Red Hat, Inc.
 package handlers
 
 import (
-	"encoding/json"
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -51,6 +53,7 @@ type SyncResponse struct {
 	TotalEdgesAdded   int
 	TotalEdgesDeleted int
 	TotalEdges        int
+	TotalRetries      int // Queries retried after transient Redis errors.
 	AddErrors         []SyncError
 	UpdateErrors      []SyncError
 	DeleteErrors      []SyncError
@@ -58,6 +61,8 @@ type SyncResponse struct {
 	DeleteEdgeErrors  []SyncError
 	Version           string
 	RequestId         int
+	ResyncRequired    bool        `json:",omitempty"` // The request was out of order, the collector must send a ClearAll.
+	Diff              *ResyncDiff `json:",omitempty"` // Only for a ClearAll dry run.
 }
 
 // SyncError is used to respond with errors.
@@ -66,41 +71,120 @@ type SyncError struct {
 	Message     string // Often comes out of a golang error using .Error()
 }
 
+// Number of items received in each list of a SyncEvent.
+type syncEventCounts struct {
+	addResources, updateResources, deleteResources, addEdges, deleteEdges int
+}
+
+// Error that stops processing a sync request, with the status to respond.
+type syncStatusError struct {
+	status     int
+	message    string
+	retryAfter time.Duration // Sent in the Retry-After header when set.
+}
+
+func (e syncStatusError) Error() string {
+	return e.message
+}
+
+// Error for a query that couldn't reach Redis. While the circuit breaker is open, the collector is told when
+// to retry.
+func connectionStatusError(err error) syncStatusError {
+	retryAfter, _ := db.IsCircuitOpen(err)
+	return syncStatusError{status: http.StatusServiceUnavailable, message: err.Error(), retryAfter: retryAfter}
+}
+
+// State of a sync request while its SyncEvent is applied. The SyncEvent can be applied all at once
+// or in batches when it's decoded as a stream.
+type syncRequest struct {
+	ctx                 context.Context // Bounds the retries of the queries by the request deadline.
+	clusterName         string
+	clearAll            bool
+	response            SyncResponse
+	metrics             *SyncMetrics
+	resync              *resyncSession // Only for ClearAll requests.
+	checkSequence       bool           // The RequestId is known before applying the changes.
+	dryRun              bool           // Compute the changes of a ClearAll without applying them.
+	clusterValidated    bool           // The cluster name is valid and the cluster exists, its result is recorded.
+	retryAfter          time.Duration  // Sent in the Retry-After header of an error response.
+	counts              syncEventCounts
+	subscriptionUIDMap  map[string]bool // map to hold exisiting subscription uids
+	subscriptionUpdated bool            // flag to decide the time when last suscription was changed
+}
+
 // SyncResources - Process Add, Update, and Delete events.
 func SyncResources(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	// The body can be JSON or MessagePack, and the response uses the format in the Accept header.
+	format := requestFormat(r)
+	w.Header().Set("Content-Type", responseFormat(r))
 	params := mux.Vars(r)
 	clusterName := params["id"]
 
-	// Limit amount of concurrent requests to prevent overloading Redis.
-	// Give priority to the local-cluster, because it's the hub and this is how we debug search.
-	// TODO: The next step is to degrade performance instead of rejecting the request.
-	//       We will give priority to nodes over edges after reaching certain load.
-	//       Will also prioritize small updates over a large resync.
-	if _, exist := PendingRequests[clusterName]; exist {
-		glog.Warningf("Rejecting request from %s. A previous request from this cluster is processing.", clusterName)
-		http.Error(w, "A previous request from this cluster is processing, retry later.", http.StatusTooManyRequests)
+	// Decompress the request body and compress the response when the collector supports it.
+	decompressedBody, err := decompressRequestBody(w, r)
+	if err != nil {
+		glog.Warningf("Rejecting request from %s. %s", clusterName, err)
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	defer decompressedBody.Close()
+	body := bufio.NewReader(decompressedBody)
+
+	// Fail fast while Redis is down, instead of waiting for a connection that can't be dialed.
+	if state, retryAfter := redisCircuitState(); state == db.CircuitOpen {
+		glog.Warningf("Rejecting request from %s, RedisGraph is unavailable.", clusterName)
+		observeSyncResponseStatus(clusterName, http.StatusServiceUnavailable)
+		recordSyncRejection(clusterName, http.StatusServiceUnavailable)
+		w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+		http.Error(w, "RedisGraph is unavailable", http.StatusServiceUnavailable)
 		return
 	}
-	if len(PendingRequests) >= config.Cfg.RequestLimit && clusterName != "local-cluster" {
-		glog.Warningf("Too many pending requests (%d). Rejecting sync from %s", len(PendingRequests), clusterName)
-		http.Error(w, "Aggregator has many pending requests, retry later.", http.StatusTooManyRequests)
+
+	// Limit amount of concurrent requests to prevent overloading Redis.
+	// Requests over the limit wait in the admission queue, which gives priority to the local-cluster
+	// and to small updates over a large resync.
+	ticket := newAdmissionTicket(clusterName, r, body)
+	if err = syncAdmissionQueue.acquire(r.Context(), ticket); err != nil {
+		admissionErr, ok := err.(admissionError)
+		if !ok {
+			glog.Warningf("Sync request from %s was canceled while waiting in the admission queue. %s", clusterName, err)
+			return
+		}
+		glog.Warningf("Rejecting request from %s. %s", clusterName, admissionErr.message)
+		observeSyncResponseStatus(clusterName, http.StatusTooManyRequests)
+		recordSyncRejection(clusterName, http.StatusTooManyRequests)
+		w.Header().Set("Retry-After", retryAfterSeconds(admissionErr.retryAfter))
+		http.Error(w, admissionErr.message, http.StatusTooManyRequests)
 		return
 	}
+	defer syncAdmissionQueue.release(ticket)
+
+	w, closeResponse := compressResponse(w, r)
+	defer closeResponse()
 
 	glog.V(2).Info("Starting SyncResources() for cluster: ", clusterName)
 	metrics := InitSyncMetrics(clusterName)
 	defer metrics.CompleteSyncEvent()
 
-	subscriptionUpdated := false                // flag to decide the time when last suscription was changed
-	subscriptionUIDMap := make(map[string]bool) // map to hold exisiting subscription uids
-	response := SyncResponse{Version: config.AGGREGATOR_API_VERSION}
+	// The server drops the connection after HTTP_TIMEOUT, there's no point in retrying queries after that.
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(config.Cfg.HTTPTimeout)*time.Millisecond)
+	defer cancel()
+
+	s := &syncRequest{
+		ctx:                ctx,
+		clusterName:        clusterName,
+		response:           SyncResponse{Version: config.AGGREGATOR_API_VERSION},
+		metrics:            &metrics,
+		dryRun:             r.URL.Query().Get("dryRun") == "true",
+		subscriptionUIDMap: make(map[string]bool),
+	}
+	response := &s.response
 
 	// Function that sends the current response and the given status code.
 	// If you want to bail out early, make sure to call return right after.
 	respond := func(status int) {
 		statusMessage := fmt.Sprintf(
-			"Responding to cluster %s with requestId %d, status %d, stats: {Added: %d, Updated: %d, Deleted: %d, Edges Added: %d, Edges Deleted: %d, Total Resources: %d, Total Edges: %d}",
+			"Responding to cluster %s with requestId %d, status %d, stats: {Added: %d, Updated: %d, Deleted: %d, Edges Added: %d, Edges Deleted: %d, Total Resources: %d, Total Edges: %d, Retries: %d}",
 			clusterName,
 			response.RequestId,
 			status,
@@ -111,53 +195,134 @@ func SyncResources(w http.ResponseWriter, r *http.Request) {
 			response.TotalEdgesDeleted,
 			response.TotalResources,
 			response.TotalEdges,
+			response.TotalRetries,
 		)
 		if status == http.StatusOK {
 			glog.Infof(statusMessage)
 		} else {
 			glog.Errorf(statusMessage)
 		}
+		observeSyncResponseStatus(clusterName, status)
+		if s.clusterValidated && !s.dryRun { // A dry run doesn't change the sync state of the cluster.
+			recordSyncResult(clusterName, status, *response)
+		} else if !s.dryRun {
+			recordSyncRejection(clusterName, status)
+		}
+		if s.retryAfter > 0 {
+			w.Header().Set("Retry-After", retryAfterSeconds(s.retryAfter))
+		}
 		w.WriteHeader(status)
-		encodeError := json.NewEncoder(w).Encode(response)
+		encodeError := encodeSyncResponse(w, responseFormat(r), response)
 		if encodeError != nil {
 			glog.Error("Error responding to SyncEvent:", encodeError, response)
 		}
 	}
 
-	var syncEvent SyncEvent
-	err := json.NewDecoder(r.Body).Decode(&syncEvent)
-	if err != nil {
-		glog.Error("Error decoding body of syncEvent: ", err)
-		respond(http.StatusBadRequest)
-		return
+	fingerprint := "" // The body isn't kept when streaming, so those requests can't be replayed.
+	if config.Cfg.StreamingDecode == "true" && format == contentTypeJSON {
+		// Apply the resources and edges in batches while the body is decoded.
+		header, streamErr := decodeSyncEventStream(body, db.BatchSize(), s)
+		response.RequestId = header.RequestId
+		err = streamErr
+		// The collector sends the RequestId after the lists, so the sequence is checked once the changes are
+		// applied. A request out of order still gets a 409, the ClearAll resync it requests repairs the cluster.
+		if err == nil && config.Cfg.RequestSequenceCheck == "true" && !s.clearAll {
+			err = s.verifySequence()
+		}
+	} else {
+		var syncEvent SyncEvent
+		rawBody, readErr := io.ReadAll(body)
+		if readErr != nil {
+			glog.Error("Error reading body of syncEvent: ", readErr)
+			if isBodyTooLarge(readErr) {
+				respond(http.StatusRequestEntityTooLarge)
+			} else {
+				respond(http.StatusBadRequest)
+			}
+			return
+		}
+		err = decodeSyncEvent(rawBody, format, &syncEvent)
+		if err != nil {
+			glog.Error("Error decoding body of syncEvent: ", err)
+			respond(http.StatusBadRequest)
+			return
+		}
+
+		// A collector that timed out retries the same request. Respond with the result of the
+		// first attempt instead of applying the changes again. A dry run is always computed.
+		if !s.dryRun {
+			fingerprint = syncEventFingerprint(rawBody)
+			if cached, ok := getCachedSyncResponse(clusterName, syncEvent.RequestId, fingerprint); ok {
+				glog.Infof("Request %d from cluster %s was already applied, responding with the previous result.",
+					syncEvent.RequestId, clusterName)
+				*response = cached
+				respond(http.StatusOK)
+				return
+			}
+		}
+		glog.V(3).Infof(
+			"Processing Request { request: %d, add: %d, update: %d, delete: %d edge add: %d edge delete: %d }",
+			syncEvent.RequestId, len(syncEvent.AddResources), len(syncEvent.UpdateResources),
+			len(syncEvent.DeleteResources), len(syncEvent.AddEdges), len(syncEvent.DeleteEdges))
+
+		s.checkSequence = config.Cfg.RequestSequenceCheck == "true"
+		err = s.begin(syncEvent)
+		if err == nil {
+			err = s.apply(syncEvent)
+		}
+	}
+	status := s.complete(err)
+	if status == http.StatusOK && fingerprint != "" {
+		cacheSyncResponse(clusterName, fingerprint, *response)
 	}
-	response.RequestId = syncEvent.RequestId
-	glog.V(3).Infof(
-		"Processing Request { request: %d, add: %d, update: %d, delete: %d edge add: %d edge delete: %d }",
-		syncEvent.RequestId, len(syncEvent.AddResources), len(syncEvent.UpdateResources),
-		len(syncEvent.DeleteResources), len(syncEvent.AddEdges), len(syncEvent.DeleteEdges))
+	respond(status)
 
-	err = db.ValidateClusterName(clusterName)
+	if status == http.StatusOK && s.subscriptionUpdated && !s.dryRun {
+		ApplicationLastUpdated = time.Now()
+	}
+}
+
+// Rejects an incremental request that doesn't follow the last successful request from the cluster, and asks the
+// collector for a ClearAll resync.
+func (s *syncRequest) verifySequence() error {
+	if expected, inOrder := checkRequestSequence(s.clusterName, s.response.RequestId); !inOrder {
+		glog.Warningf("Rejecting request %d from cluster %s, expected request %d. Requesting a resync.",
+			s.response.RequestId, s.clusterName, expected)
+		s.response.ResyncRequired = true
+		return syncStatusError{status: http.StatusConflict, message: "request out of order"}
+	}
+	return nil
+}
+
+// Validates the cluster and prepares to apply the SyncEvent.
+func (s *syncRequest) begin(header SyncEvent) error {
+	s.clearAll = header.ClearAll
+	s.response.RequestId = header.RequestId
+
+	err := db.ValidateClusterName(s.clusterName)
 	if err != nil {
-		glog.Warning("Invalid Cluster Name: ", clusterName)
-		respond(http.StatusBadRequest)
-		return
+		glog.Warning("Invalid Cluster Name: ", s.clusterName)
+		return syncStatusError{status: http.StatusBadRequest, message: err.Error()}
+	}
+
+	if s.dryRun && !s.clearAll {
+		glog.Warning("Rejecting dry run of an incremental sync from cluster ", s.clusterName)
+		return syncStatusError{status: http.StatusBadRequest, message: "dryRun is only supported with clearAll"}
 	}
 
 	// Validate that we have a Cluster CRD so we can build edges on create
-	if !assertClusterNode(clusterName) {
+	if !s.clusterNodeAvailable() {
 		glog.Warningf(
-			"Warning, couldn't find a Cluster node with name: %s. This means that the sync request came from a managed cluster that hasn’t joined. Rejecting the incoming sync request.", clusterName)
-		respond(http.StatusBadRequest)
-		return
+			"Warning, couldn't find a Cluster node with name: %s. This means that the sync request came from a managed cluster that hasn’t joined. Rejecting the incoming sync request.", s.clusterName)
+		return syncStatusError{status: http.StatusBadRequest, message: "cluster not found"}
 	}
+	s.clusterValidated = true
 
-	// add cluster fields
-	for i := range syncEvent.AddResources {
-		syncEvent.AddResources[i].Properties["cluster"] = clusterName
-	}
-	for i := range syncEvent.UpdateResources {
-		syncEvent.UpdateResources[i].Properties["cluster"] = clusterName
+	// A delayed request could overwrite newer changes, and a missed request leaves the cluster out of sync.
+	if s.checkSequence && !s.clearAll {
+		if err = s.verifySequence(); err != nil {
+			return err
+		}
 	}
 
 	// let us store the Current Subscription Uids in a map [String] -> boolean
@@ -167,7 +332,7 @@ func SyncResources(w http.ResponseWriter, r *http.Request) {
 			for uidresults.Next() {
 				record := uidresults.Record()
 				uid := record.GetByIndex(0).(string)
-				subscriptionUIDMap[uid] = true
+				s.subscriptionUIDMap[uid] = true
 			}
 		}
 
@@ -177,140 +342,217 @@ func SyncResources(w http.ResponseWriter, r *http.Request) {
 
 	// This usually indicates that something has gone wrong, basically that the collector detected we
 	// are out of sync and wants us to resync.
-	if syncEvent.ClearAll {
-		stats, err := resyncCluster(clusterName, syncEvent.AddResources, syncEvent.AddEdges, &metrics)
+	if s.clearAll {
+		resync, err := newResyncSession(s.ctx, s.clusterName, s.metrics, s.dryRun)
 		if err != nil {
-			glog.Warning("Error on resyncCluster. ", clusterName, err)
-		} else {
-			response.TotalAdded = stats.TotalAdded
-			response.TotalUpdated = stats.TotalUpdated
-			response.TotalDeleted = stats.TotalDeleted
-			response.TotalEdgesAdded = stats.TotalEdgesAdded
-			response.TotalEdgesDeleted = stats.TotalEdgesDeleted
-			response.AddErrors = stats.AddErrors
-			response.UpdateErrors = stats.UpdateErrors
-			response.DeleteErrors = stats.DeleteErrors
-			response.AddEdgeErrors = stats.AddEdgeErrors
-			response.DeleteEdgeErrors = stats.DeleteEdgeErrors
+			return connectionStatusError(err)
+		}
+		s.resync = resync
+	}
+	return nil
+}
+
+// Checks that the Cluster node exists, creating it if needed for the local-cluster.
+// A dry run doesn't create the Cluster node.
+func (s *syncRequest) clusterNodeAvailable() bool {
+	if !s.dryRun {
+		return assertClusterNode(s.clusterName)
+	}
+	if s.clusterName == "local-cluster" || config.Cfg.SkipClusterValidation == "true" {
+		return true
+	}
+	return clusterNodeExists(s.clusterName)
+}
+
+// Applies the lists of a SyncEvent. Called once with the complete SyncEvent, or once per batch when streaming.
+func (s *syncRequest) apply(event SyncEvent) error {
+	s.counts.addResources += len(event.AddResources)
+	s.counts.updateResources += len(event.UpdateResources)
+	s.counts.deleteResources += len(event.DeleteResources)
+	s.counts.addEdges += len(event.AddEdges)
+	s.counts.deleteEdges += len(event.DeleteEdges)
+
+	// add cluster fields
+	for i := range event.AddResources {
+		event.AddResources[i].Properties["cluster"] = s.clusterName
+	}
+	for i := range event.UpdateResources {
+		event.UpdateResources[i].Properties["cluster"] = s.clusterName
+	}
+	if !s.subscriptionUpdated && (hasSubscription(event.AddResources) || hasSubscription(event.UpdateResources)) {
+		s.subscriptionUpdated = true
+	}
+
+	if s.clearAll {
+		// A resync only uses the resources and edges to add, everything else in the cluster gets deleted.
+		if len(event.AddResources) > 0 {
+			s.resync.syncResources(event.AddResources)
+		}
+		if len(event.AddEdges) > 0 {
+			s.resync.syncEdges(event.AddEdges)
+		}
+		return nil
+	}
+	return s.applyIncremental(event)
+}
+
+// Applies the lists in order: add, update and delete resources, then add and delete edges.
+// Stops at the first list with errors.
+func (s *syncRequest) applyIncremental(event SyncEvent) error {
+	clusterName := s.clusterName
+	response := &s.response
+	metrics := s.metrics
+
+	if event.AddResources != nil || event.UpdateResources != nil || event.DeleteResources != nil {
+		if metrics.NodeSyncStart.IsZero() {
+			metrics.NodeSyncStart = time.Now()
 		}
 
-	} else {
 		// INSERT Resources
 
-		metrics.NodeSyncStart = time.Now()
-		insertResponse := db.ChunkedInsert(syncEvent.AddResources, clusterName)
-		response.TotalAdded = insertResponse.SuccessfulResources // could be 0
+		insertResponse := db.ChunkedInsert(s.ctx, event.AddResources, clusterName)
+		response.TotalAdded += insertResponse.SuccessfulResources // could be 0
+		response.TotalRetries += insertResponse.Retries
 		if insertResponse.ConnectionError != nil {
-			respond(http.StatusServiceUnavailable)
-			return
+			return connectionStatusError(insertResponse.ConnectionError)
 		} else if len(insertResponse.ResourceErrors) != 0 {
-			response.AddErrors = processSyncErrors(insertResponse.ResourceErrors, "inserted")
-			respond(http.StatusBadRequest)
-			return
+			response.AddErrors = append(response.AddErrors, processSyncErrors(insertResponse.ResourceErrors, "inserted")...)
+			return syncStatusError{status: http.StatusBadRequest, message: "error inserting resources"}
 		}
 
 		// UPDATE Resources
 
-		updateResponse := db.ChunkedUpdate(syncEvent.UpdateResources)
-		response.TotalUpdated = updateResponse.SuccessfulResources // could be 0
+		updateResponse := db.ChunkedUpdate(s.ctx, event.UpdateResources)
+		response.TotalUpdated += updateResponse.SuccessfulResources // could be 0
+		response.TotalRetries += updateResponse.Retries
 		if updateResponse.ConnectionError != nil {
-			respond(http.StatusServiceUnavailable)
-			return
+			return connectionStatusError(updateResponse.ConnectionError)
 		} else if len(updateResponse.ResourceErrors) != 0 {
-			response.UpdateErrors = processSyncErrors(updateResponse.ResourceErrors, "updated")
-			respond(http.StatusBadRequest)
-			return
+			response.UpdateErrors = append(response.UpdateErrors, processSyncErrors(updateResponse.ResourceErrors, "updated")...)
+			return syncStatusError{status: http.StatusBadRequest, message: "error updating resources"}
 		}
 
 		// DELETE Resources
 
 		// reformat to []string
-		deleteUIDS := make([]string, 0, len(syncEvent.DeleteResources))
-		for _, de := range syncEvent.DeleteResources {
+		deleteUIDS := make([]string, 0, len(event.DeleteResources))
+		for _, de := range event.DeleteResources {
 			deleteUIDS = append(deleteUIDS, de.UID)
 			// If we are deleting any subscriptions better run interclusteredges - Setting flag to true
-			if !subscriptionUpdated {
-				if _, ok := subscriptionUIDMap[de.UID]; ok {
-					subscriptionUpdated = true
+			if !s.subscriptionUpdated {
+				if _, ok := s.subscriptionUIDMap[de.UID]; ok {
+					s.subscriptionUpdated = true
 				}
 			}
 
 		}
 
-		deleteResponse := db.ChunkedDelete(deleteUIDS)
-		response.TotalDeleted = deleteResponse.SuccessfulResources // could be 0
+		deleteResponse := db.ChunkedDelete(s.ctx, deleteUIDS)
+		response.TotalDeleted += deleteResponse.SuccessfulResources // could be 0
+		response.TotalRetries += deleteResponse.Retries
 		if deleteResponse.ConnectionError != nil {
-			respond(http.StatusServiceUnavailable)
-			return
+			return connectionStatusError(deleteResponse.ConnectionError)
 		} else if len(deleteResponse.ResourceErrors) != 0 {
-			response.DeleteErrors = processSyncErrors(deleteResponse.ResourceErrors, "deleted")
-			respond(http.StatusBadRequest)
-			return
+			response.DeleteErrors = append(response.DeleteErrors, processSyncErrors(deleteResponse.ResourceErrors, "deleted")...)
+			return syncStatusError{status: http.StatusBadRequest, message: "error deleting resources"}
 		}
 		metrics.NodeSyncEnd = time.Now()
+	}
+
+	if event.AddEdges != nil || event.DeleteEdges != nil {
+		if metrics.EdgeSyncStart.IsZero() {
+			metrics.EdgeSyncStart = time.Now()
+		}
 
 		// Insert Edges
-		metrics.EdgeSyncStart = time.Now()
-		glog.V(4).Info("Sync cluster ", clusterName, ": Number of edges to insert: ", len(syncEvent.AddEdges))
-		insertEdgeResponse := db.ChunkedInsertEdge(syncEvent.AddEdges, clusterName)
-		response.TotalEdgesAdded = insertEdgeResponse.SuccessfulResources // could be 0
+		glog.V(4).Info("Sync cluster ", clusterName, ": Number of edges to insert: ", len(event.AddEdges))
+		insertEdgeResponse := db.ChunkedInsertEdge(s.ctx, event.AddEdges, clusterName)
+		response.TotalEdgesAdded += insertEdgeResponse.SuccessfulResources // could be 0
+		response.TotalRetries += insertEdgeResponse.Retries
 		if insertEdgeResponse.ConnectionError != nil {
-			respond(http.StatusServiceUnavailable)
-			return
+			return connectionStatusError(insertEdgeResponse.ConnectionError)
 		} else if len(insertEdgeResponse.ResourceErrors) != 0 {
-			response.AddEdgeErrors = processSyncErrors(insertEdgeResponse.ResourceErrors, "inserted by edge")
-			respond(http.StatusBadRequest)
-			return
+			response.AddEdgeErrors = append(response.AddEdgeErrors,
+				processSyncErrors(insertEdgeResponse.ResourceErrors, "inserted by edge")...)
+			return syncStatusError{status: http.StatusBadRequest, message: "error inserting edges"}
 		}
 
 		// Delete Edges
-		glog.V(4).Info("Sync cluster ", clusterName, ": Number of edges to delete: ", len(syncEvent.DeleteEdges))
-		deleteEdgeResponse := db.ChunkedDeleteEdge(syncEvent.DeleteEdges, clusterName)
-		response.TotalEdgesDeleted = deleteEdgeResponse.SuccessfulResources // could be 0
+		glog.V(4).Info("Sync cluster ", clusterName, ": Number of edges to delete: ", len(event.DeleteEdges))
+		deleteEdgeResponse := db.ChunkedDeleteEdge(s.ctx, event.DeleteEdges, clusterName)
+		response.TotalEdgesDeleted += deleteEdgeResponse.SuccessfulResources // could be 0
+		response.TotalRetries += deleteEdgeResponse.Retries
 		if deleteEdgeResponse.ConnectionError != nil {
-			respond(http.StatusServiceUnavailable)
-			return
+			return connectionStatusError(deleteEdgeResponse.ConnectionError)
 		} else if len(deleteEdgeResponse.ResourceErrors) != 0 {
-			response.DeleteEdgeErrors = processSyncErrors(deleteEdgeResponse.ResourceErrors, "removed by edge")
-			respond(http.StatusBadRequest)
-			return
+			response.DeleteEdgeErrors = append(response.DeleteEdgeErrors,
+				processSyncErrors(deleteEdgeResponse.ResourceErrors, "removed by edge")...)
+			return syncStatusError{status: http.StatusBadRequest, message: "error deleting edges"}
 		}
 
 		metrics.EdgeSyncEnd = time.Now()
 	}
-	metrics.SyncEnd = time.Now()
-	metrics.LogPerformanceMetrics(syncEvent)
-
-	glog.V(2).Infof("syncResources complete. Done updating resources for cluster %s, preparing response", clusterName)
-	response.TotalResources = computeNodeCount(clusterName) // This goes out to the DB, so it can take a second
-	response.TotalEdges = computeIntraEdges(clusterName)
-
-	respond(http.StatusOK)
-
-	// update the timestamp if we made any changes Kind = Subscription
+	return nil
+}
 
-	// if any Node with kind Subscription Added then subscriptionUpdated
-	for i := range syncEvent.AddResources {
-		if (!subscriptionUpdated) && (syncEvent.AddResources[i].Properties["kind"] == "Subscription") {
-			glog.V(3).Infof("Will trigger Intercluster - Added Node %s ", syncEvent.AddResources[i].Properties["name"])
-			subscriptionUpdated = true
-			break
+// Completes the sync request and returns the status to respond. The error is the one that stopped
+// applying the SyncEvent, if any.
+func (s *syncRequest) complete(err error) int {
+	if err != nil {
+		if statusErr, ok := err.(syncStatusError); ok {
+			s.retryAfter = statusErr.retryAfter
+			return statusErr.status
 		}
+		if isBodyTooLarge(err) {
+			glog.Error("Rejecting syncEvent larger than MAX_REQUEST_BODY_MB. ", err)
+			return http.StatusRequestEntityTooLarge
+		}
+		glog.Error("Error decoding body of syncEvent: ", err)
+		return http.StatusBadRequest
 	}
-	if !subscriptionUpdated {
-		for i := range syncEvent.UpdateResources {
-			if (!subscriptionUpdated) && (syncEvent.UpdateResources[i].Properties["kind"] == "Subscription") {
-				glog.V(3).Infof("Will trigger Intercluster - Updated Node %s ",
-					syncEvent.UpdateResources[i].Properties["name"])
-				subscriptionUpdated = true
-				break
-			}
+
+	if s.clearAll {
+		stats, err := s.resync.finish()
+		s.response.TotalRetries += stats.TotalRetries
+		if err != nil {
+			glog.Warning("Error on resyncCluster. ", s.clusterName, err)
+		} else {
+			s.response.TotalAdded = stats.TotalAdded
+			s.response.TotalUpdated = stats.TotalUpdated
+			s.response.TotalDeleted = stats.TotalDeleted
+			s.response.TotalEdgesAdded = stats.TotalEdgesAdded
+			s.response.TotalEdgesDeleted = stats.TotalEdgesDeleted
+			s.response.AddErrors = stats.AddErrors
+			s.response.UpdateErrors = stats.UpdateErrors
+			s.response.DeleteErrors = stats.DeleteErrors
+			s.response.AddEdgeErrors = stats.AddEdgeErrors
+			s.response.DeleteEdgeErrors = stats.DeleteEdgeErrors
+		}
+		if s.dryRun {
+			s.response.Diff = &s.resync.diff
 		}
 	}
+	s.metrics.SyncEnd = time.Now()
+	s.metrics.LogPerformanceMetrics(s.response.RequestId, s.counts)
+
+	glog.V(2).Infof("syncResources complete. Done updating resources for cluster %s, preparing response", s.clusterName)
+	s.response.TotalResources = computeNodeCount(s.clusterName) // This goes out to the DB, so it can take a second
+	s.response.TotalEdges = computeIntraEdges(s.clusterName)
+	if !s.dryRun {
+		s.metrics.ObserveSyncMetrics(s.response)
+	}
+	return http.StatusOK
+}
 
-	if subscriptionUpdated {
-		ApplicationLastUpdated = time.Now()
+// Checks if any of the resources is a Subscription, used to trigger building the intercluster edges.
+func hasSubscription(resources []*db.Resource) bool {
+	for _, resource := range resources {
+		if resource.Properties["kind"] == "Subscription" {
+			glog.V(3).Infof("Will trigger Intercluster - Node %s ", resource.Properties["name"])
+			return true
+		}
 	}
+	return false
 }
 
 // internal function to inline the errors
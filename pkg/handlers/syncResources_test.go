@@ -0,0 +1,59 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	db "github.com/stolostron/search-aggregator/pkg/dbconnector"
+	"github.com/stretchr/testify/assert"
+)
+
+// Sync requests fail fast with a Retry-After header while the circuit breaker is open.
+func TestSyncResources_circuitOpen(t *testing.T) {
+	mockCircuitState(t, db.CircuitOpen, 2500*time.Millisecond)
+
+	req, err := http.NewRequest("POST", "/aggregator/clusters/cluster1/sync", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/sync", SyncResources)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "3", rr.Header().Get("Retry-After"))
+	_, recorded := getClusterSyncStatus("cluster1")
+	assert.False(t, recorded, "A request rejected before the cluster is validated doesn't add a cluster status.")
+}
+
+// A rejection before the cluster is validated only updates the status of a cluster that already synced.
+func Test_recordSyncRejection(t *testing.T) {
+	recordSyncRejection("rejected-cluster", http.StatusTooManyRequests)
+	_, recorded := getClusterSyncStatus("rejected-cluster")
+	assert.False(t, recorded)
+
+	recordSyncResult("rejected-cluster", http.StatusOK, SyncResponse{RequestId: 1})
+	recordSyncRejection("rejected-cluster", http.StatusTooManyRequests)
+	status, recorded := getClusterSyncStatus("rejected-cluster")
+	assert.True(t, recorded)
+	assert.Equal(t, "Request rejected with status 429, the aggregator is busy.", status.LastError)
+}
+
+func Test_connectionStatusError(t *testing.T) {
+	err := connectionStatusError(db.CircuitOpenError{RetryAfter: time.Second})
+	assert.Equal(t, http.StatusServiceUnavailable, err.status)
+	assert.Equal(t, time.Second, err.retryAfter)
+
+	err = connectionStatusError(errors.New("EOF"))
+	assert.Equal(t, http.StatusServiceUnavailable, err.status)
+	assert.Equal(t, time.Duration(0), err.retryAfter, "The collector uses its own backoff for other errors.")
+}
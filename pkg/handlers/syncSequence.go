@@ -0,0 +1,19 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+// Checks that an incremental sync request follows the last successful request from the cluster.
+// Returns the RequestId expected from the cluster and false if the request is stale or a request was missed,
+// in that case the collector must send a ClearAll resync. The sequence starts with the first successful
+// request after the aggregator starts, and every successful ClearAll resets it.
+func checkRequestSequence(clusterName string, requestId int) (int, bool) {
+	clusterSyncStatesMutex.RLock()
+	defer clusterSyncStatesMutex.RUnlock()
+	state, exists := clusterSyncStates[clusterName]
+	if !exists || state.lastSuccessfulSync.IsZero() {
+		return requestId, true
+	}
+	expected := state.lastSuccessfulRequestId + 1
+	return expected, requestId == expected
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stolostron/search-aggregator/pkg/config"
+	db "github.com/stolostron/search-aggregator/pkg/dbconnector"
+	"github.com/stolostron/search-aggregator/pkg/dbconnector/memgraph"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_checkRequestSequence(t *testing.T) {
+	// The first request after the aggregator starts is accepted.
+	_, inOrder := checkRequestSequence("sequence-cluster", 7)
+	assert.True(t, inOrder)
+
+	recordSyncResult("sequence-cluster", http.StatusOK, SyncResponse{RequestId: 7})
+
+	_, inOrder = checkRequestSequence("sequence-cluster", 8)
+	assert.True(t, inOrder)
+
+	expected, inOrder := checkRequestSequence("sequence-cluster", 6)
+	assert.False(t, inOrder, "A stale request should be rejected.")
+	assert.Equal(t, 8, expected)
+
+	_, inOrder = checkRequestSequence("sequence-cluster", 10)
+	assert.False(t, inOrder, "A request after a missed request should be rejected.")
+
+	// A failed request doesn't move the sequence forward.
+	recordSyncResult("sequence-cluster", http.StatusServiceUnavailable, SyncResponse{RequestId: 8})
+	_, inOrder = checkRequestSequence("sequence-cluster", 8)
+	assert.True(t, inOrder)
+
+	// A ClearAll resync starts a new sequence.
+	recordSyncResult("sequence-cluster", http.StatusOK, SyncResponse{RequestId: 100})
+	_, inOrder = checkRequestSequence("sequence-cluster", 101)
+	assert.True(t, inOrder)
+}
+
+// Posts sync requests to the in-memory graph with the sequence check on, and returns the response of each.
+func newSequenceTestCluster(t *testing.T, clusterName string, streaming bool) func(body string) (int, SyncResponse) {
+	previousStore, previousCheck, previousStreaming := db.Store, config.Cfg.RequestSequenceCheck,
+		config.Cfg.StreamingDecode
+	db.Store = memgraph.New()
+	config.Cfg.RequestSequenceCheck, config.Cfg.StreamingDecode = "true", fmt.Sprint(streaming)
+	t.Cleanup(func() {
+		db.Store, config.Cfg.RequestSequenceCheck, config.Cfg.StreamingDecode = previousStore, previousCheck,
+			previousStreaming
+	})
+	_, err := db.Store.Query(fmt.Sprintf("CREATE (:Cluster {name: '%s', kind: 'cluster'})", clusterName))
+	assert.Nil(t, err)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/aggregator/clusters/{id}/sync", SyncResources)
+	return func(body string) (int, SyncResponse) {
+		req := httptest.NewRequest("POST", "/aggregator/clusters/"+clusterName+"/sync", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var response SyncResponse
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		return rr.Code, response
+	}
+}
+
+// An out of order request asks for a resync, and the ClearAll resync starts a new sequence with its RequestId.
+func TestSyncResources_sequenceResetByClearAll(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		clusterName := fmt.Sprintf("sequence-reset-%t", streaming)
+		sync := newSequenceTestCluster(t, clusterName, streaming)
+		pod := func(uid string) string {
+			return `{"kind":"Pod","uid":"` + uid + `","properties":{"kind":"Pod","name":"` + uid + `"}}`
+		}
+
+		status, _ := sync(`{"AddResources":[` + pod("uid-a") + `],"RequestId":5}`)
+		assert.Equal(t, http.StatusOK, status, "The first request is accepted with any RequestId.")
+
+		status, response := sync(`{"AddResources":[` + pod("uid-b") + `],"RequestId":7}`)
+		assert.Equal(t, http.StatusConflict, status, "Request 6 was missed.")
+		assert.True(t, response.ResyncRequired)
+
+		status, response = sync(`{"clearAll":true,"AddResources":[` + pod("uid-a") + `,` + pod("uid-b") +
+			`],"RequestId":20}`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.False(t, response.ResyncRequired)
+		assert.Equal(t, 2, response.TotalResources)
+
+		status, _ = sync(`{"DeleteResources":[{"uid":"uid-a"}],"RequestId":21}`)
+		assert.Equal(t, http.StatusOK, status, "The ClearAll RequestId starts the new sequence.")
+
+		status, response = sync(`{"AddResources":[` + pod("uid-c") + `],"RequestId":6}`)
+		assert.Equal(t, http.StatusConflict, status, "A request from the previous sequence is stale.")
+		assert.True(t, response.ResyncRequired)
+		lastStatus, _ := getClusterSyncStatus(clusterName)
+		assert.Equal(t, 21, lastStatus.LastSuccessfulRequestId)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	db "github.com/stolostron/search-aggregator/pkg/dbconnector"
+)
+
+// Receives the parts of a SyncEvent decoded by decodeSyncEventStream.
+type syncEventHandler interface {
+	// Called with the fields decoded before the first list. Returning an error stops the decoding.
+	begin(header SyncEvent) error
+	// Called with a batch of a single list of the SyncEvent. Returning an error stops the decoding.
+	apply(batch SyncEvent) error
+}
+
+// Decodes a SyncEvent token by token and passes each list to the handler in batches of at most batchSize items,
+// so the payload is never held in memory at once. The lists are passed in the order they are received, the
+// collector sends AddResources, UpdateResources, DeleteResources, AddEdges and DeleteEdges in that order.
+// Returns the scalar fields of the SyncEvent, RequestId is usually decoded after all the lists.
+func decodeSyncEventStream(r io.Reader, batchSize int, handler syncEventHandler) (SyncEvent, error) {
+	decoder := json.NewDecoder(r)
+	var header SyncEvent
+	began := false
+	beginOnce := func() error {
+		if began {
+			return nil
+		}
+		began = true
+		return handler.begin(header)
+	}
+
+	if err := expectDelim(decoder, '{'); err != nil {
+		return header, err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return header, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return header, fmt.Errorf("expected an object key, got %v", token)
+		}
+
+		// Keys are matched without case, like json.Unmarshal does.
+		switch {
+		case strings.EqualFold(key, "clearAll"):
+			var clearAll bool
+			if err = decoder.Decode(&clearAll); err != nil {
+				return header, err
+			}
+			if clearAll && began {
+				return header, errors.New("clearAll must be sent before the resource and edge lists")
+			}
+			header.ClearAll = clearAll
+		case strings.EqualFold(key, "RequestId"):
+			err = decoder.Decode(&header.RequestId)
+		case strings.EqualFold(key, "AddResources"):
+			if err = beginOnce(); err == nil {
+				err = decodeListInBatches(decoder, batchSize, func(batch []*db.Resource) error {
+					return handler.apply(SyncEvent{AddResources: batch})
+				})
+			}
+		case strings.EqualFold(key, "UpdateResources"):
+			if err = beginOnce(); err == nil {
+				err = decodeListInBatches(decoder, batchSize, func(batch []*db.Resource) error {
+					return handler.apply(SyncEvent{UpdateResources: batch})
+				})
+			}
+		case strings.EqualFold(key, "DeleteResources"):
+			if err = beginOnce(); err == nil {
+				err = decodeListInBatches(decoder, batchSize, func(batch []DeleteResourceEvent) error {
+					return handler.apply(SyncEvent{DeleteResources: batch})
+				})
+			}
+		case strings.EqualFold(key, "AddEdges"):
+			if err = beginOnce(); err == nil {
+				err = decodeListInBatches(decoder, batchSize, func(batch []db.Edge) error {
+					return handler.apply(SyncEvent{AddEdges: batch})
+				})
+			}
+		case strings.EqualFold(key, "DeleteEdges"):
+			if err = beginOnce(); err == nil {
+				err = decodeListInBatches(decoder, batchSize, func(batch []db.Edge) error {
+					return handler.apply(SyncEvent{DeleteEdges: batch})
+				})
+			}
+		default: // Unknown fields are ignored, like json.Unmarshal does.
+			var ignored json.RawMessage
+			err = decoder.Decode(&ignored)
+		}
+		if err != nil {
+			return header, err
+		}
+	}
+	if err := expectDelim(decoder, '}'); err != nil {
+		return header, err
+	}
+	// A SyncEvent without lists still needs to be processed.
+	return header, beginOnce()
+}
+
+// Decodes a JSON array one item at a time, passing the items to apply in batches of at most batchSize.
+// A null value is treated as an empty list.
+func decodeListInBatches[T any](decoder *json.Decoder, batchSize int, apply func([]T) error) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected a list, got %v", token)
+	}
+
+	batch := make([]T, 0, batchSize)
+	for decoder.More() {
+		var item T
+		if err = decoder.Decode(&item); err != nil {
+			return err
+		}
+		batch = append(batch, item)
+		if len(batch) == batchSize {
+			if err = apply(batch); err != nil {
+				return err
+			}
+			batch = make([]T, 0, batchSize)
+		}
+	}
+	if err = expectDelim(decoder, ']'); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return apply(batch)
+	}
+	return nil
+}
+
+func expectDelim(decoder *json.Decoder, expected json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("expected %s, got %v", expected, token)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2022 Red Hat, Inc.
+// Copyright Contributors to the Open Cluster Management project
+
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Records the calls from decodeSyncEventStream.
+type fakeSyncEventHandler struct {
+	calls    []string
+	header   SyncEvent
+	batches  []SyncEvent
+	applyErr error
+}
+
+func (h *fakeSyncEventHandler) begin(header SyncEvent) error {
+	h.calls = append(h.calls, "begin")
+	h.header = header
+	return nil
+}
+
+func (h *fakeSyncEventHandler) apply(batch SyncEvent) error {
+	h.calls = append(h.calls, "apply")
+	h.batches = append(h.batches, batch)
+	return h.applyErr
+}
+
+func Test_decodeSyncEventStream_batches(t *testing.T) {
+	body := `{"clearAll":true,
+		"addResources":[{"kind":"Pod","uid":"a"},{"kind":"Pod","uid":"b"},{"kind":"Pod","uid":"c"}],
+		"UpdateResources":null,
+		"DeleteResources":[{"uid":"d"}],
+		"AddEdges":[{"SourceUID":"a","DestUID":"b","EdgeType":"ownedBy"}],
+		"Unknown":{"ignored":[1,2]},
+		"RequestId":7}`
+	handler := &fakeSyncEventHandler{}
+
+	header, err := decodeSyncEventStream(strings.NewReader(body), 2, handler)
+
+	assert.Nil(t, err)
+	assert.True(t, header.ClearAll)
+	assert.Equal(t, 7, header.RequestId)
+	assert.True(t, handler.header.ClearAll, "begin() should receive the fields sent before the lists.")
+	assert.Equal(t, []string{"begin", "apply", "apply", "apply", "apply"}, handler.calls)
+	assert.Len(t, handler.batches[0].AddResources, 2)
+	assert.Len(t, handler.batches[1].AddResources, 1)
+	assert.Equal(t, "c", handler.batches[1].AddResources[0].UID)
+	assert.Equal(t, "d", handler.batches[2].DeleteResources[0].UID)
+	assert.Equal(t, "ownedBy", handler.batches[3].AddEdges[0].EdgeType)
+}
+
+func Test_decodeSyncEventStream_noLists(t *testing.T) {
+	handler := &fakeSyncEventHandler{}
+
+	header, err := decodeSyncEventStream(strings.NewReader(`{"RequestId":3}`), 2, handler)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, header.RequestId)
+	assert.Equal(t, []string{"begin"}, handler.calls)
+}
+
+func Test_decodeSyncEventStream_clearAllAfterLists(t *testing.T) {
+	handler := &fakeSyncEventHandler{}
+
+	_, err := decodeSyncEventStream(strings.NewReader(`{"AddResources":[],"clearAll":true}`), 2, handler)
+
+	assert.NotNil(t, err)
+}
+
+func Test_decodeSyncEventStream_applyError(t *testing.T) {
+	handler := &fakeSyncEventHandler{applyErr: errors.New("apply failed")}
+
+	_, err := decodeSyncEventStream(strings.NewReader(`{"DeleteResources":[{"uid":"a"},{"uid":"b"},{"uid":"c"}]}`), 2, handler)
+
+	assert.EqualError(t, err, "apply failed")
+	assert.Equal(t, []string{"begin", "apply"}, handler.calls, "Decoding should stop after the first error.")
+}
+
+func Test_decodeSyncEventStream_invalidJSON(t *testing.T) {
+	handler := &fakeSyncEventHandler{}
+
+	_, err := decodeSyncEventStream(strings.NewReader(`{"AddResources":{}}`), 2, handler)
+
+	assert.NotNil(t, err)
+}